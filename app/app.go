@@ -32,8 +32,18 @@ func (a *App) Startup(ctx context.Context) {
 		runtime.MessageDialog(a.Ctx, runtime.MessageDialogOptions{Title: err.Error()})
 		log.Fatal(err)
 	}
+
+	// NOTE: without a keyring, the master password is asked by the frontend
+	err = openSecrets(metadataDB)
+	if err != nil {
+		log.Println(err)
+	}
 }
 
 func (a *App) Shutdown(ctx context.Context) {
+	// NOTE: disconnecting rolls back the transactions left open in the editor
+	for id := range activeConnections {
+		disconnect(activeConnections, id)
+	}
 	CloseMetadataDB()
 }
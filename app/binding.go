@@ -3,6 +3,7 @@ package app
 import (
 	"dbisous/app/client"
 	"fmt"
+	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -31,8 +32,24 @@ func (a *App) Disconnect(id string) error {
 	return disconnect(activeConnections, id)
 }
 
-func (a *App) TestConnection(dbType ConnectionType, connectionString string) error {
-	return testConnection(dbType, connectionString)
+func (a *App) TestConnection(connection Connection) error {
+	return testConnection(connection)
+}
+
+func (a *App) ParseConnectionString(dbType ConnectionType, connectionString string) (ConnectionSettings, error) {
+	return parseConnectionString(dbType, connectionString)
+}
+
+func (a *App) BuildConnectionString(dbType ConnectionType, settings ConnectionSettings) (string, error) {
+	return buildConnectionString(dbType, settings)
+}
+
+func (a *App) GetSecretsStatus() (SecretsStatus, error) {
+	return getSecretsStatus(metadataDB)
+}
+
+func (a *App) UnlockSecrets(password string) error {
+	return unlockSecrets(metadataDB, password)
 }
 
 func (a *App) GetPastQueries() ([]PastQuery, error) {
@@ -43,7 +60,7 @@ func (a *App) DeletePastQuery(id string) error {
 	return deletePastQuery(metadataDB, id)
 }
 
-func (a *App) ExportDatabase(id string, options client.ExportOptions) (string, error) {
+func (a *App) ExportDatabase(id string, queryID string, options client.ExportOptions) (string, error) {
 	file, err := runtime.SaveFileDialog(a.Ctx, runtime.SaveDialogOptions{})
 	if err != nil {
 		return "", err
@@ -51,11 +68,10 @@ func (a *App) ExportDatabase(id string, options client.ExportOptions) (string, e
 	if file == "" {
 		return "", fmt.Errorf("No file selected")
 	}
-	return exportDatabase(file, id, options)
+	return exportDatabase(file, id, queryID, options)
 }
 
-func (a *App) ImportDatabase(id string) (string, error) {
-	// TODO: buffered read and do it step by step to avoid memory overload
+func (a *App) ExportQuery(id string, queryID string, query string, options client.ExportOptions) (string, error) {
 	file, err := runtime.SaveFileDialog(a.Ctx, runtime.SaveDialogOptions{})
 	if err != nil {
 		return "", err
@@ -63,8 +79,49 @@ func (a *App) ImportDatabase(id string) (string, error) {
 	if file == "" {
 		return "", fmt.Errorf("No file selected")
 	}
+	return exportQuery(file, id, queryID, query, options)
+}
+
+func (a *App) ImportDatabase(id string, queryID string, options client.ImportOptions) (string, error) {
+	file, err := runtime.OpenFileDialog(a.Ctx, runtime.OpenDialogOptions{})
+	if err != nil {
+		return "", err
+	}
+	if file == "" {
+		return "", fmt.Errorf("No file selected")
+	}
+
+	return importDatabase(file, id, queryID, options, a.importProgress())
+}
+
+// importProgress emits the progress of an import as "import:progress" events,
+// throttled as a dump can hold millions of statements.
+func (a *App) importProgress() func(client.ImportProgress) {
+	return emitProgress[client.ImportProgress](a, "import:progress")
+}
+
+// emitProgress emits progress reports as events, at most one every 100ms.
+func emitProgress[T any](a *App, event string) func(T) {
+	var last time.Time
+	return func(progress T) {
+		if time.Since(last) < 100*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		runtime.EventsEmit(a.Ctx, event, progress)
+	}
+}
 
-	return importDatabase(file, id)
+func (a *App) PreviewCSV(id string, file string, options client.CSVImportOptions) (client.CSVPreview, error) {
+	return previewCSV(file, id, options)
+}
+
+func (a *App) ImportCSV(id string, queryID string, file string, options client.CSVImportOptions) (string, error) {
+	return importCSV(file, id, queryID, options, a.importProgress())
+}
+
+func (a *App) CopyTables(sourceID string, targetID string, queryID string, options client.CopyOptions) error {
+	return copyTables(sourceID, targetID, queryID, options, emitProgress[client.CopyProgress](a, "copy:progress"))
 }
 
 func (a *App) SelectFile() (string, error) {
@@ -92,14 +149,119 @@ func (a *App) GetSchemaTables(id string, params client.QueryParams, schema strin
 	return getSchemaTables(id, params, schema)
 }
 
-func (a *App) GetTableRows(id string, params client.QueryParams, schema string, table string) (client.QueryResult, error) {
-	return getTableRows(id, params, schema, table)
+func (a *App) GetTableRows(id string, queryID string, params client.QueryParams, schema string, table string) (client.QueryResult, error) {
+	return getTableRows(id, queryID, params, schema, table)
+}
+
+func (a *App) GetTableMetadata(id string, schema string, table string) (client.TableMetadata, error) {
+	return getTableMetadata(id, schema, table)
+}
+
+func (a *App) GetTableDDL(id string, schema string, table string) (string, error) {
+	return getTableDDL(id, schema, table)
+}
+
+func (a *App) GetSchemaMetadata(id string, schema string) (client.SchemaMetadata, error) {
+	return getSchemaMetadata(id, schema)
+}
+
+func (a *App) DiffSchemas(sourceID string, sourceSchema string, targetID string, targetSchema string) (client.SchemaDiff, error) {
+	return diffSchemas(sourceID, sourceSchema, targetID, targetSchema)
+}
+
+// DiffTableData compares the table data, asking where to save the sync
+// script when script is set.
+func (a *App) DiffTableData(sourceID string, sourceSchema string, targetID string, targetSchema string, table string, options client.DataDiffOptions, script bool) (client.DataDiff, error) {
+	file := ""
+	if script {
+		var err error
+		file, err = runtime.SaveFileDialog(a.Ctx, runtime.SaveDialogOptions{DefaultFilename: table + "_sync.sql"})
+		if err != nil {
+			return client.DataDiff{}, err
+		}
+		if file == "" {
+			return client.DataDiff{}, fmt.Errorf("No file selected")
+		}
+	}
+	return diffTableData(sourceID, sourceSchema, targetID, targetSchema, table, options, file)
+}
+
+func (a *App) ExecuteQuery(id string, queryID string, query string) (client.QueryResult, error) {
+	return executeQuery(id, queryID, query)
+}
+
+func (a *App) ExecuteScript(id string, queryID string, script string, stopOnError bool) ([]client.ScriptResult, error) {
+	return executeScript(id, queryID, script, stopOnError)
+}
+
+func (a *App) BeginSession(id string, sessionID string) (bool, error) {
+	return beginSession(id, sessionID)
+}
+
+func (a *App) CommitSession(id string, sessionID string) (bool, error) {
+	return commitSession(id, sessionID)
+}
+
+func (a *App) RollbackSession(id string, sessionID string) (bool, error) {
+	return rollbackSession(id, sessionID)
+}
+
+func (a *App) InTransaction(id string, sessionID string) bool {
+	return inTransaction(id, sessionID)
+}
+
+func (a *App) ExecuteSessionQuery(id string, sessionID string, queryID string, query string) (client.QueryResult, error) {
+	return executeSessionQuery(id, sessionID, queryID, query)
+}
+
+func (a *App) ExecuteSessionScript(id string, sessionID string, queryID string, script string, stopOnError bool) ([]client.ScriptResult, error) {
+	return executeSessionScript(id, sessionID, queryID, script, stopOnError)
+}
+
+func (a *App) CloseSession(id string, sessionID string) error {
+	return closeSession(id, sessionID)
+}
+
+func (a *App) Execute(id string, queryID string, query string) error {
+	return execute(id, queryID, query)
+}
+
+func (a *App) CancelQuery(id string, queryID string) error {
+	return cancelQuery(id, queryID)
+}
+
+func (a *App) UpdateRows(id string, queryID string, schema string, table string, changes []client.RowChange) ([]int64, error) {
+	return updateRows(id, queryID, schema, table, changes)
+}
+
+func (a *App) InsertRows(id string, queryID string, schema string, table string, rows []client.Row) ([]int64, error) {
+	return insertRows(id, queryID, schema, table, rows)
+}
+
+func (a *App) DeleteRows(id string, queryID string, schema string, table string, keys []client.Row) ([]int64, error) {
+	return deleteRows(id, queryID, schema, table, keys)
+}
+
+func (a *App) GetChanges(id string) []client.Change {
+	return getChanges(id)
+}
+
+func (a *App) AddChange(id string, change client.Change) ([]client.Change, error) {
+	return addChange(id, change)
+}
+
+func (a *App) RemoveChange(id string, index int) ([]client.Change, error) {
+	return removeChange(id, index)
+}
+
+func (a *App) PreviewChanges(id string) (string, error) {
+	return previewChanges(id)
 }
 
-func (a *App) ExecuteQuery(id string, query string) (client.QueryResult, error) {
-	return executeQuery(id, query)
+func (a *App) CommitChanges(id string, queryID string) ([]int64, error) {
+	return commitChanges(id, queryID)
 }
 
-func (a *App) Execute(id string, query string) error {
-	return execute(id, query)
+func (a *App) DiscardChanges(id string) {
+	discardChanges(id)
 }
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"dbisous/app/client"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// changeSets holds the grid edits of each connection until they are
+// committed or discarded.
+var changeSetsMu sync.Mutex
+var changeSets = make(map[string][]client.Change)
+
+func getChanges(id string) []client.Change {
+	changeSetsMu.Lock()
+	defer changeSetsMu.Unlock()
+
+	return slices.Clone(changeSets[id])
+}
+
+// addChange adds the change to the change set, folding it into the pending
+// change of the same row when there is one.
+func addChange(id string, change client.Change) ([]client.Change, error) {
+	if _, exists := dbClients[id]; !exists {
+		return nil, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	changeSetsMu.Lock()
+	defer changeSetsMu.Unlock()
+
+	changes := changeSets[id]
+	i := slices.IndexFunc(changes, func(pending client.Change) bool {
+		return pending.Schema == change.Schema && pending.Table == change.Table && change.Kind != client.ChangeInsert && sameRow(pending, change.Key)
+	})
+	switch {
+	case i < 0:
+		changes = append(changes, change)
+	case change.Kind == client.ChangeUpdate:
+		pending := &changes[i]
+		if pending.Kind == client.ChangeDelete {
+			return nil, fmt.Errorf("the row is already deleted")
+		}
+		values := make(client.Row)
+		for column, value := range pending.Values {
+			values[column] = value
+		}
+		for column, value := range change.Values {
+			values[column] = value
+		}
+		pending.Values = values
+	case changes[i].Kind == client.ChangeInsert:
+		// NOTE: deleting a pending row just drops it
+		changes = slices.Delete(changes, i, i+1)
+	default:
+		changes = append(slices.Delete(changes, i, i+1), change)
+	}
+	changeSets[id] = changes
+
+	return slices.Clone(changes), nil
+}
+
+// sameRow tells whether the pending change is on the row identified by key,
+// a pending insert being identified by its values.
+func sameRow(pending client.Change, key client.Row) bool {
+	if len(key) == 0 {
+		return false
+	}
+	row := pending.Key
+	if pending.Kind == client.ChangeInsert {
+		row = pending.Values
+	} else if len(row) != len(key) {
+		return false
+	}
+	for column, value := range key {
+		other, exists := row[column]
+		if !exists || !reflect.DeepEqual(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+func removeChange(id string, index int) ([]client.Change, error) {
+	changeSetsMu.Lock()
+	defer changeSetsMu.Unlock()
+
+	changes := changeSets[id]
+	if index < 0 || index >= len(changes) {
+		return nil, fmt.Errorf("no pending change %d for database ID: %s", index, id)
+	}
+	changeSets[id] = slices.Delete(changes, index, index+1)
+
+	return slices.Clone(changeSets[id]), nil
+}
+
+func previewChanges(id string) (string, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return "", fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	return client.PreviewChanges(context.Background(), dbClient, getChanges(id))
+}
+
+// commitChanges applies the change set in one transaction, it is kept as is
+// when the transaction fails so it can be fixed.
+func commitChanges(id string, queryID string) ([]int64, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return nil, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	changes := getChanges(id)
+	if len(changes) == 0 {
+		return []int64{}, nil
+	}
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	counts, err := client.ApplyChanges(ctx, dbClient, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	discardChanges(id)
+
+	return counts, nil
+}
+
+func discardChanges(id string) {
+	changeSetsMu.Lock()
+	defer changeSetsMu.Unlock()
+
+	delete(changeSets, id)
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"context"
+	"dbisous/app/client"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeSet(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+
+	connection := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName, ConnectionString: filepath.Join(t.TempDir(), "data.db")})
+	_, err := connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	defer disconnect(activeConnections, connection.ID)
+
+	err = execute(connection.ID, "setup", "CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT NOT NULL, note TEXT); INSERT INTO t VALUES (1, 'a', NULL), (2, 'b', NULL)")
+	r.NoError(err)
+
+	update := func(id float64, values client.Row) client.Change {
+		return client.Change{Kind: client.ChangeUpdate, Schema: "main", Table: "t", Key: client.Row{"id": id}, Values: values}
+	}
+	_, err = addChange(connection.ID, update(1, client.Row{"name": "x"}))
+	r.NoError(err)
+	_, err = addChange(connection.ID, update(1, client.Row{"note": "y"}))
+	r.NoError(err)
+	_, err = addChange(connection.ID, client.Change{Kind: client.ChangeInsert, Schema: "main", Table: "t", Values: client.Row{"id": 3.0, "name": "c"}})
+	r.NoError(err)
+	_, err = addChange(connection.ID, update(3, client.Row{"name": "new"}))
+	r.NoError(err)
+	changes, err := addChange(connection.ID, update(2, client.Row{"name": nil}))
+	r.NoError(err)
+	r.Len(changes, 3, "Expected changes of the same row to be merged")
+
+	preview, err := previewChanges(connection.ID)
+	r.NoError(err)
+	r.Equal(`UPDATE "main"."t" SET "name" = 'x', "note" = 'y' WHERE "id" = 1;
+INSERT INTO "main"."t" ("id", "name") VALUES (3, 'new');
+UPDATE "main"."t" SET "name" = NULL WHERE "id" = 2;
+`, preview)
+
+	_, err = commitChanges(connection.ID, "commit")
+	r.Error(err, "Expected the NOT NULL constraint to fail")
+	r.Len(getChanges(connection.ID), 3, "Expected the change set to be kept")
+	result, err := dbClients[connection.ID].ExecuteQuery(context.Background(), "SELECT name FROM t ORDER BY id")
+	r.NoError(err)
+	r.Equal([]client.Row{{"name": "a"}, {"name": "b"}}, result.Rows, "Expected no change to be applied")
+
+	_, err = removeChange(connection.ID, 2)
+	r.NoError(err)
+	counts, err := commitChanges(connection.ID, "commit")
+	r.NoError(err)
+	r.Equal([]int64{1, 1}, counts)
+	r.Empty(getChanges(connection.ID))
+	result, err = dbClients[connection.ID].ExecuteQuery(context.Background(), "SELECT name FROM t ORDER BY id")
+	r.NoError(err)
+	r.Equal([]client.Row{{"name": "x"}, {"name": "b"}, {"name": "new"}}, result.Rows)
+
+	_, err = addChange(connection.ID, client.Change{Kind: client.ChangeDelete, Schema: "main", Table: "t", Key: client.Row{"id": 2.0}})
+	r.NoError(err)
+	discardChanges(connection.ID)
+	r.Empty(getChanges(connection.ID))
+}
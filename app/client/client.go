@@ -1,15 +1,34 @@
 package client
 
+import (
+	"context"
+	"io"
+	"time"
+)
+
 type DatabaseClient interface {
-	GetDatabaseMetadata() (DatabaseMetadata, error)
-	GetConnectionDatabases(QueryParams) (QueryResult, error)
-	GetDatabaseSchemas(QueryParams) (QueryResult, error)
-	GetSchemaTables(QueryParams, string) (QueryResult, error)
-	GetTableRows(QueryParams, string, string) (QueryResult, error)
-	ExecuteQuery(string) (QueryResult, error)
-	Execute(string) error
-	Export(ExportOptions) (string, error)
-	Import(string) error
+	GetDatabaseMetadata(context.Context) (DatabaseMetadata, error)
+	GetConnectionDatabases(context.Context, QueryParams) (QueryResult, error)
+	GetDatabaseSchemas(context.Context, QueryParams) (QueryResult, error)
+	GetSchemaTables(context.Context, QueryParams, string) (QueryResult, error)
+	GetTableRows(context.Context, QueryParams, string, string) (QueryResult, error)
+	GetTableMetadata(context.Context, string, string) (TableMetadata, error)
+	GetSchemaMetadata(context.Context, string) (SchemaMetadata, error)
+	GetTableDDL(context.Context, string, string) (string, error)
+	ExecuteQuery(context.Context, string) (QueryResult, error)
+	ExecuteScript(context.Context, string, bool) ([]ScriptResult, error)
+	Execute(context.Context, string) error
+	Export(context.Context, io.Writer, ExportOptions) error
+	ExportQuery(context.Context, io.Writer, string, ExportOptions) error
+	Import(context.Context, io.Reader, ImportOptions, func(ImportProgress)) error
+	PreviewCSV(context.Context, io.Reader, CSVImportOptions) (CSVPreview, error)
+	ImportCSV(context.Context, io.Reader, CSVImportOptions, func(ImportProgress)) error
+}
+
+// Limits caps what a single statement is allowed to cost, zero values mean no limit.
+type Limits struct {
+	StatementTimeout time.Duration
+	MaxRows          int
 }
 
 type ColumnMetadata struct {
@@ -29,12 +48,17 @@ type EnumMetadata struct {
 }
 
 type QueryResult struct {
-	Query    string           `json:"query"`
-	Rows     []Row            `json:"rows"`
-	Columns  []ColumnMetadata `json:"columns"`
-	Enums    []EnumMetadata   `json:"enums"`
-	Total    int              `json:"total"`
-	Duration string           `json:"duration"`
+	Query        string           `json:"query"`
+	Rows         []Row            `json:"rows"`
+	Columns      []ColumnMetadata `json:"columns"`
+	Enums        []EnumMetadata   `json:"enums"`
+	Total        int              `json:"total"`
+	Estimated    bool             `json:"estimated"` // Total comes from table statistics
+	Cursor       []any            `json:"cursor"`    // primary key values of the last row, to fetch the next page
+	Truncated    bool             `json:"truncated"`
+	RowsAffected int64            `json:"rows_affected"`
+	LastInsertID *int64           `json:"last_insert_id"` // nil when the driver can't tell (postgres)
+	Duration     string           `json:"duration"`
 }
 
 type DatabaseMetadata struct {
@@ -61,23 +85,92 @@ type QueryOrder struct {
 	Direction OrderDirection `json:"direction"`
 }
 
+type FilterOperator string
+
+const (
+	Equal       FilterOperator = "="
+	NotEqual    FilterOperator = "<>"
+	LessThan    FilterOperator = "<"
+	GreaterThan FilterOperator = ">"
+	Like        FilterOperator = "LIKE"
+	ILike       FilterOperator = "ILIKE"
+	In          FilterOperator = "IN"
+	IsNull      FilterOperator = "IS NULL"
+	Between     FilterOperator = "BETWEEN"
+)
+
+var FilterOperators = []struct {
+	Value  FilterOperator
+	TSName string
+}{
+	{Equal, "Equal"},
+	{NotEqual, "Not_equal"},
+	{LessThan, "Less_than"},
+	{GreaterThan, "Greater_than"},
+	{Like, "Like"},
+	{ILike, "ILike"},
+	{In, "In"},
+	{IsNull, "Is_null"},
+	{Between, "Between"},
+}
+
+// QueryFilter compares a column to Value, or to Values for IN and BETWEEN
+// (lower and upper bounds), values are always sent as bind parameters.
 type QueryFilter struct {
-	Column string `json:"column"`
-	Value  string `json:"value"`
+	Column   string         `json:"column"`
+	Operator FilterOperator `json:"operator"`
+	Value    any            `json:"value"`
+	Values   []any          `json:"values"`
+}
+
+type FilterLogic string
+
+const (
+	And FilterLogic = "AND"
+	Or  FilterLogic = "OR"
+)
+
+var FilterLogics = []struct {
+	Value  FilterLogic
+	TSName string
+}{
+	{And, "And"},
+	{Or, "Or"},
+}
+
+// FilterGroup combines its filters and nested groups with the same logic,
+// e.g. (status = 'open' OR status = 'pending') AND created_at > X.
+type FilterGroup struct {
+	Logic   FilterLogic   `json:"logic"`
+	Filters []QueryFilter `json:"filters"`
+	Groups  []FilterGroup `json:"groups"`
+}
+
+// QueryCursor switches to keyset pagination: rows are sought by primary key
+// instead of skipped with OFFSET, which stays fast deep into large tables.
+type QueryCursor struct {
+	After     []any          `json:"after"` // primary key values of the last row of the previous page, empty for the first page
+	Direction OrderDirection `json:"direction"`
 }
 
 type QueryParams struct {
-	Columns []string      `json:"columns"`
-	Limit   int           `json:"limit"`
-	Offset  int           `json:"offset"`
-	Order   []QueryOrder  `json:"order"`
-	Filter  []QueryFilter `json:"filter"`
+	Columns       []string      `json:"columns"`
+	Limit         int           `json:"limit"`
+	Offset        int           `json:"offset"` // ignored when Cursor is set
+	Order         []QueryOrder  `json:"order"`
+	Filter        []QueryFilter `json:"filter"`
+	Where         *FilterGroup  `json:"where"` // ANDed with Filter
+	Cursor        *QueryCursor  `json:"cursor"`
+	EstimateCount bool          `json:"estimate_count"` // use table statistics rather than COUNT(*) when nothing is filtered
 }
 
 type ExportType string
 
 const (
-	SQL ExportType = "sql"
+	SQL    ExportType = "sql"
+	CSV    ExportType = "csv"
+	JSON   ExportType = "json"
+	NDJSON ExportType = "ndjson"
 )
 
 var ExportTypes = []struct {
@@ -85,6 +178,9 @@ var ExportTypes = []struct {
 	TSName string
 }{
 	{SQL, "SQL"},
+	{CSV, "CSV"},
+	{JSON, "JSON"},
+	{NDJSON, "NDJSON"},
 }
 
 type ExportDrop string
@@ -114,4 +210,6 @@ type ExportOptions struct {
 	WrapInTransaction bool       `json:"wrap_in_transaction"`
 	DropTable         ExportDrop `json:"drop_table"`
 	Selected          []string   `json:"selected"`
+	BatchSize         int        `json:"batch_size"` // rows per INSERT in SQL dumps, defaults to 100
+	CSV               CSVOptions `json:"csv"`
 }
@@ -0,0 +1,392 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CopyTable selects a source table, Where optionally filtering its rows.
+type CopyTable struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Where  string `json:"where"` // SQL condition in the source dialect
+}
+
+type CopyOptions struct {
+	Tables       []CopyTable `json:"tables"`
+	TargetSchema string      `json:"target_schema"`
+	Replace      bool        `json:"replace"`    // drop the existing target tables, rows are appended to them otherwise
+	BatchSize    int         `json:"batch_size"` // defaults to 1000
+}
+
+type CopyProgress struct {
+	Table  string `json:"table"`
+	Tables int    `json:"tables"` // tables copied so far
+	Rows   int    `json:"rows"`   // rows copied so far in Table
+}
+
+const defaultCopyBatchSize = 1000
+
+// CopyTables copies the selected tables from source to target, creating the
+// missing target tables with their column types mapped to the target dialect.
+// Each table is copied in its own transaction.
+func CopyTables(ctx context.Context, source DatabaseClient, target DatabaseClient, options CopyOptions, onProgress func(CopyProgress)) error {
+	if len(options.Tables) == 0 {
+		return fmt.Errorf("no table to copy")
+	}
+	from, to := dialectOf(source), dialectOf(target)
+	if options.TargetSchema == "" && to == sqliteDialect {
+		options.TargetSchema = "main"
+	}
+
+	progress := CopyProgress{}
+	for _, table := range options.Tables {
+		sourceTable, err := source.GetTableMetadata(ctx, table.Schema, table.Name)
+		if err != nil {
+			return err
+		}
+		targetTable, err := target.GetTableMetadata(ctx, options.TargetSchema, table.Name)
+		exists := err == nil
+		if err != nil && !errors.Is(err, errUnknownTable) {
+			return err
+		}
+
+		progress.Table = table.Name
+		progress.Rows = 0
+		err = withCancelOf(ctx, source, func(sourceDB txBeginner) error {
+			return withCancelOf(ctx, target, func(targetDB txBeginner) error {
+				return copyTable(ctx, sourceDB, from, targetDB, to, table, sourceTable, targetTable, exists, options, func(rows int) {
+					progress.Rows = rows
+					if onProgress != nil {
+						onProgress(progress)
+					}
+				})
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("copying %s.%s: %w", table.Schema, table.Name, err)
+		}
+		progress.Tables++
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+	return nil
+}
+
+func copyTable(ctx context.Context, sourceDB querier, from dialect, targetDB txBeginner, to dialect, table CopyTable, sourceTable TableMetadata, targetTable TableMetadata, exists bool, options CopyOptions, onRows func(int)) (err error) {
+	tx, err := targetDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	m := &migration{dialect: to, target: options.TargetSchema}
+	if exists && options.Replace {
+		_, err = tx.ExecContext(ctx, "DROP TABLE "+m.table(table.Name))
+		if err != nil {
+			return err
+		}
+		exists = false
+	}
+
+	columns := make([]string, 0)
+	if exists {
+		// NOTE: rows go to the columns both tables have
+		for _, column := range sourceTable.Columns {
+			if columnExists(targetTable.Columns, column.Name) {
+				columns = append(columns, column.Name)
+			}
+		}
+		if len(columns) == 0 {
+			return fmt.Errorf("no column in common with %s.%s", options.TargetSchema, table.Name)
+		}
+	} else {
+		created := TableMetadata{Name: table.Name}
+		for _, column := range sourceTable.Columns {
+			columns = append(columns, column.Name)
+			column.Type = copyColumnType(from, to, column.Type, column.PrimaryKey)
+			if from != to {
+				// NOTE: defaults are expressions of the source dialect
+				column.DefaultValue = ""
+			}
+			created.Columns = append(created.Columns, column)
+		}
+		m.createTable(created)
+		_, err = tx.ExecContext(ctx, m.createTables[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = from.quoteIdentifier(column)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s.%s", strings.Join(quoted, ", "), from.quoteIdentifier(table.Schema), from.quoteIdentifier(table.Name))
+	if strings.TrimSpace(table.Where) != "" {
+		query += " WHERE " + table.Where
+	}
+	rows, err := sourceDB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	kinds := make([]valueKind, len(columnTypes))
+	for i, col := range columnTypes {
+		kinds[i] = columnKind(col)
+	}
+
+	inserter, err := newBulkInserter(ctx, tx, to, options.TargetSchema, table.Name, columns)
+	if err != nil {
+		return err
+	}
+	defer inserter.close()
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCopyBatchSize
+	}
+	if to == mysqlDialect {
+		// NOTE: mysql allows 65535 placeholders per statement
+		batchSize = min(batchSize, 65535/len(columns))
+	}
+
+	copied := 0
+	batch := make([][]any, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := inserter.insert(ctx, batch)
+		if err != nil {
+			return err
+		}
+		copied += len(batch)
+		onRows(copied)
+		batch = batch[:0]
+		return nil
+	}
+
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for i, value := range values {
+			// NOTE: drivers return text as []byte, which would be written as binary
+			if b, ok := value.([]byte); ok && kinds[i] != binaryKind {
+				values[i] = string(b)
+			}
+		}
+
+		batch = append(batch, values)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// typeFamilies groups the declared types of every dialect by what they hold.
+var typeFamilies = map[string]string{
+	"smallint": "smallint", "int2": "smallint", "tinyint": "smallint", "smallserial": "smallint",
+	"int": "integer", "integer": "integer", "int4": "integer", "mediumint": "integer", "serial": "integer",
+	"bigint": "bigint", "int8": "bigint", "bigserial": "bigint",
+	"real": "real", "float4": "real", "float": "real",
+	"double": "double", "double precision": "double", "float8": "double",
+	"numeric": "decimal", "decimal": "decimal",
+	"boolean": "boolean", "bool": "boolean",
+	"char": "char", "character": "char", "nchar": "char", "bpchar": "char",
+	"varchar": "varchar", "character varying": "varchar", "nvarchar": "varchar",
+	"text": "text", "tinytext": "text", "mediumtext": "text", "longtext": "text", "clob": "text", "citext": "text",
+	"blob": "binary", "tinyblob": "binary", "mediumblob": "binary", "longblob": "binary",
+	"bytea": "binary", "binary": "binary", "varbinary": "binary",
+	"date": "date",
+	"time": "time", "time without time zone": "time", "time with time zone": "time", "timetz": "time",
+	"timestamp": "timestamp", "timestamp without time zone": "timestamp", "datetime": "timestamp",
+	"timestamptz": "timestamptz", "timestamp with time zone": "timestamptz",
+	"json": "json", "jsonb": "json",
+	"uuid": "uuid",
+}
+
+// splitType splits a declared type into its family and its arguments,
+// "character varying(20)" giving ("varchar", "20").
+func splitType(declared string) (string, string) {
+	name := strings.ToLower(strings.TrimSpace(declared))
+	if strings.HasSuffix(name, "[]") {
+		return "", ""
+	}
+	args := ""
+	if open := strings.Index(name, "("); open >= 0 {
+		if length := strings.Index(name[open:], ")"); length >= 0 {
+			args = strings.ReplaceAll(name[open+1:open+length], " ", "")
+			name = name[:open] + name[open+length+1:]
+		}
+	}
+	name = strings.TrimSuffix(strings.Join(strings.Fields(name), " "), " zerofill")
+	unsigned := strings.HasSuffix(name, " unsigned")
+	name = strings.TrimSuffix(name, " unsigned")
+	if name == "tinyint" && args == "1" {
+		// NOTE: mysql booleans are tinyint(1)
+		return "boolean", ""
+	}
+	family := typeFamilies[name]
+	if unsigned && family == "integer" {
+		family = "bigint"
+	}
+	return family, args
+}
+
+// copyColumnType maps a declared type to the closest type of the target
+// dialect, what has no equivalent being copied as text. key columns get a
+// type mysql can index.
+func copyColumnType(from dialect, to dialect, declared string, key bool) string {
+	if from == to {
+		return declared
+	}
+
+	family, args := splitType(declared)
+	if from == sqliteDialect {
+		// NOTE: sqlite integers and reals are 64 bits
+		switch family {
+		case "smallint", "integer":
+			family = "bigint"
+		case "real":
+			family = "double"
+		}
+	}
+	withArgs := func(name string) string {
+		if args == "" {
+			return name
+		}
+		return name + "(" + args + ")"
+	}
+
+	switch to {
+	case sqliteDialect:
+		switch family {
+		case "smallint", "integer", "bigint":
+			return "INTEGER"
+		case "real", "double":
+			return "REAL"
+		case "decimal":
+			return "NUMERIC"
+		case "boolean":
+			return "BOOLEAN"
+		case "binary":
+			return "BLOB"
+		case "date":
+			return "DATE"
+		case "timestamp", "timestamptz":
+			return "DATETIME"
+		}
+		// NOTE: a JSON column would get numeric affinity
+		return "TEXT"
+	case postgresDialect:
+		switch family {
+		case "smallint":
+			return "SMALLINT"
+		case "integer":
+			return "INTEGER"
+		case "bigint":
+			return "BIGINT"
+		case "real":
+			return "REAL"
+		case "double":
+			return "DOUBLE PRECISION"
+		case "decimal":
+			return withArgs("NUMERIC")
+		case "boolean":
+			return "BOOLEAN"
+		case "char":
+			return withArgs("CHAR")
+		case "varchar":
+			return withArgs("VARCHAR")
+		case "binary":
+			return "BYTEA"
+		case "date":
+			return "DATE"
+		case "time":
+			return "TIME"
+		case "timestamp":
+			return "TIMESTAMP"
+		case "timestamptz":
+			return "TIMESTAMPTZ"
+		case "json":
+			return "JSON"
+		case "uuid":
+			return "UUID"
+		}
+		return "TEXT"
+	default:
+		switch family {
+		case "smallint":
+			return "SMALLINT"
+		case "integer":
+			return "INT"
+		case "bigint":
+			return "BIGINT"
+		case "real":
+			return "FLOAT"
+		case "double":
+			return "DOUBLE"
+		case "decimal":
+			if args == "" {
+				// NOTE: mysql would default to DECIMAL(10, 0)
+				return "DECIMAL(65, 30)"
+			}
+			return withArgs("DECIMAL")
+		case "boolean":
+			return "BOOLEAN"
+		case "char":
+			return withArgs("CHAR")
+		case "varchar":
+			if args != "" {
+				return withArgs("VARCHAR")
+			}
+		case "binary":
+			if key {
+				return "VARBINARY(255)"
+			}
+			return "LONGBLOB"
+		case "date":
+			return "DATE"
+		case "time":
+			return "TIME"
+		case "timestamp", "timestamptz":
+			return "DATETIME(6)"
+		case "json":
+			return "JSON"
+		case "uuid":
+			return "CHAR(36)"
+		}
+		if key {
+			return "VARCHAR(255)"
+		}
+		return "LONGTEXT"
+	}
+}
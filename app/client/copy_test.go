@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCopyTables(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	open := func(script string) *SqliteClient {
+		db, err := sql.Open("sqlite3", ":memory:")
+		r.NoError(err)
+		t.Cleanup(func() { db.Close() })
+		db.SetMaxOpenConns(1)
+		_, err = db.Exec(script)
+		r.NoError(err)
+		return &SqliteClient{Db: db}
+	}
+
+	source := open(`
+CREATE TABLE author (id INTEGER PRIMARY KEY, name VARCHAR(20) NOT NULL, photo BLOB);
+INSERT INTO author VALUES (1, 'Ann', x'00ff'), (2, 'Bob', NULL), (3, 'Cid', NULL);
+CREATE TABLE book (id INTEGER PRIMARY KEY, title TEXT, extra TEXT);
+INSERT INTO book VALUES (1, 'Dune', 'x'), (2, 'Emma', 'y');
+`)
+	target := open(`CREATE TABLE book (id INTEGER PRIMARY KEY, title TEXT);`)
+
+	progress := make([]CopyProgress, 0)
+	err := CopyTables(ctx, source, target, CopyOptions{
+		Tables:    []CopyTable{{Schema: "main", Name: "author", Where: "id < 3"}, {Schema: "main", Name: "book"}},
+		BatchSize: 1,
+	}, func(p CopyProgress) { progress = append(progress, p) })
+	r.NoError(err)
+	r.Equal([]CopyProgress{
+		{Table: "author", Rows: 1},
+		{Table: "author", Rows: 2},
+		{Table: "author", Tables: 1, Rows: 2},
+		{Table: "book", Tables: 1, Rows: 1},
+		{Table: "book", Tables: 1, Rows: 2},
+		{Table: "book", Tables: 2, Rows: 2},
+	}, progress)
+
+	author, err := target.GetTableMetadata(ctx, "main", "author")
+	r.NoError(err)
+	r.Equal([]ColumnMetadata{
+		{Name: "id", Type: "INTEGER", DefaultValue: "NULL", Nullable: true, PrimaryKey: true},
+		{Name: "name", Type: "VARCHAR(20)", DefaultValue: "NULL"},
+		{Name: "photo", Type: "BLOB", DefaultValue: "NULL", Nullable: true},
+	}, author.Columns)
+	var photo []byte
+	r.NoError(target.Db.QueryRow("SELECT photo FROM author WHERE id = 1").Scan(&photo))
+	r.Equal([]byte{0, 255}, photo)
+
+	var count int
+	r.NoError(target.Db.QueryRow("SELECT count(*) FROM book WHERE title IS NOT NULL").Scan(&count))
+	r.Equal(2, count, "Expected the rows to be appended to the common columns")
+
+	err = CopyTables(ctx, source, target, CopyOptions{Tables: []CopyTable{{Schema: "main", Name: "book"}}, Replace: true}, nil)
+	r.NoError(err)
+	var extra string
+	r.NoError(target.Db.QueryRow("SELECT extra FROM book WHERE id = 2").Scan(&extra))
+	r.Equal("y", extra, "Expected the table to be recreated")
+
+	err = CopyTables(ctx, source, target, CopyOptions{Tables: []CopyTable{{Schema: "main", Name: "author"}}}, nil)
+	r.Error(err, "Expected duplicate keys to fail")
+	r.NoError(target.Db.QueryRow("SELECT count(*) FROM author").Scan(&count))
+	r.Equal(2, count, "Expected the failed copy to be rolled back")
+}
+
+func TestCopyColumnType(t *testing.T) {
+	testCases := []struct {
+		from     dialect
+		to       dialect
+		declared string
+		key      bool
+		expected string
+	}{
+		{postgresDialect, sqliteDialect, "character varying(20)", false, "TEXT"},
+		{postgresDialect, sqliteDialect, "jsonb", false, "TEXT"},
+		{postgresDialect, sqliteDialect, "timestamp(3) with time zone", false, "DATETIME"},
+		{postgresDialect, sqliteDialect, "numeric(10,2)", false, "NUMERIC"},
+		{postgresDialect, sqliteDialect, "integer[]", false, "TEXT"},
+		{postgresDialect, mysqlDialect, "character varying(20)", false, "VARCHAR(20)"},
+		{postgresDialect, mysqlDialect, "text", false, "LONGTEXT"},
+		{postgresDialect, mysqlDialect, "text", true, "VARCHAR(255)"},
+		{postgresDialect, mysqlDialect, "numeric", false, "DECIMAL(65, 30)"},
+		{postgresDialect, mysqlDialect, "uuid", false, "CHAR(36)"},
+		{mysqlDialect, postgresDialect, "tinyint(1)", false, "BOOLEAN"},
+		{mysqlDialect, postgresDialect, "int(10)", false, "INTEGER"},
+		{mysqlDialect, postgresDialect, "int(10) unsigned", false, "BIGINT"},
+		{mysqlDialect, postgresDialect, "decimal(10, 2)", false, "NUMERIC(10,2)"},
+		{mysqlDialect, postgresDialect, "datetime", false, "TIMESTAMP"},
+		{mysqlDialect, postgresDialect, "enum('a','b')", false, "TEXT"},
+		{mysqlDialect, postgresDialect, "mediumblob", false, "BYTEA"},
+		{sqliteDialect, postgresDialect, "INTEGER", false, "BIGINT"},
+		{sqliteDialect, postgresDialect, "", false, "TEXT"},
+		{sqliteDialect, mysqlDialect, "REAL", false, "DOUBLE"},
+		{postgresDialect, postgresDialect, "character varying(20)", false, "character varying(20)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.declared, func(t *testing.T) {
+			require.Equal(t, tc.expected, copyColumnType(tc.from, tc.to, tc.declared, tc.key))
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+type CSVQuote string
+
+const (
+	QuoteMinimal    CSVQuote = "minimal"
+	QuoteAll        CSVQuote = "all"
+	QuoteNonNumeric CSVQuote = "non_numeric"
+)
+
+var CSVQuotes = []struct {
+	Value  CSVQuote
+	TSName string
+}{
+	{QuoteMinimal, "Minimal"},
+	{QuoteAll, "All"},
+	{QuoteNonNumeric, "Non_numeric"},
+}
+
+type CSVEncoding string
+
+const (
+	UTF8        CSVEncoding = "utf-8"
+	UTF8BOM     CSVEncoding = "utf-8-bom"
+	UTF16LE     CSVEncoding = "utf-16le"
+	Latin1      CSVEncoding = "iso-8859-1"
+	Windows1252 CSVEncoding = "windows-1252"
+)
+
+var CSVEncodings = []struct {
+	Value  CSVEncoding
+	TSName string
+}{
+	{UTF8, "UTF_8"},
+	{UTF8BOM, "UTF_8_BOM"},
+	{UTF16LE, "UTF_16LE"},
+	{Latin1, "ISO_8859_1"},
+	{Windows1252, "Windows_1252"},
+}
+
+// CSVOptions configure CSV exports, NULL is written as Null and never quoted
+// so it can be told apart from an empty string.
+type CSVOptions struct {
+	Delimiter string      `json:"delimiter"` // defaults to a comma
+	Quote     CSVQuote    `json:"quote"`
+	Header    bool        `json:"header"`
+	Null      string      `json:"null"`
+	Encoding  CSVEncoding `json:"encoding"`
+}
+
+func (o CSVOptions) encoding() (encoding.Encoding, error) {
+	switch o.Encoding {
+	case "", UTF8:
+		return encoding.Nop, nil
+	case UTF8BOM:
+		return unicode.UTF8BOM, nil
+	case UTF16LE:
+		// NOTE: spreadsheets need the BOM to detect it
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), nil
+	case Latin1:
+		return charmap.ISO8859_1, nil
+	case Windows1252:
+		return charmap.Windows1252, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %s", o.Encoding)
+}
+
+// csvWriter streams rows as CSV, encoding them on the fly.
+type csvWriter struct {
+	options   CSVOptions
+	delimiter string
+	w         *transform.Writer
+	numeric   []bool
+	line      strings.Builder
+}
+
+func newCSVWriter(w io.Writer, options CSVOptions) (*csvWriter, error) {
+	delimiter := options.Delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+	if utf8.RuneCountInString(delimiter) != 1 || strings.ContainsAny(delimiter, "\"\r\n") {
+		return nil, fmt.Errorf("invalid CSV delimiter: %q", delimiter)
+	}
+	switch options.Quote {
+	case "", QuoteMinimal, QuoteAll, QuoteNonNumeric:
+	default:
+		return nil, fmt.Errorf("unsupported CSV quoting: %s", options.Quote)
+	}
+
+	enc, err := options.encoding()
+	if err != nil {
+		return nil, err
+	}
+
+	return &csvWriter{
+		options:   options,
+		delimiter: delimiter,
+		// NOTE: characters the encoding can't represent are replaced rather than failing the export
+		w: transform.NewWriter(w, encoding.ReplaceUnsupported(enc.NewEncoder())),
+	}, nil
+}
+
+func (c *csvWriter) begin(columns []*sql.ColumnType) error {
+	c.numeric = make([]bool, len(columns))
+	for i, col := range columns {
+		c.numeric[i] = isNumeric(col)
+	}
+
+	if !c.options.Header {
+		return nil
+	}
+	names := make([]any, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name()
+	}
+	return c.writeLine(names, make([]bool, len(columns)))
+}
+
+func (c *csvWriter) write(values []any) error {
+	return c.writeLine(values, c.numeric)
+}
+
+func (c *csvWriter) writeLine(values []any, numeric []bool) error {
+	c.line.Reset()
+	for i, value := range values {
+		if i > 0 {
+			c.line.WriteString(c.delimiter)
+		}
+		if value == nil {
+			c.line.WriteString(c.options.Null)
+			continue
+		}
+
+		field := csvValue(value)
+		if c.needsQuotes(field, numeric[i]) {
+			c.line.WriteString(`"` + strings.ReplaceAll(field, `"`, `""`) + `"`)
+		} else {
+			c.line.WriteString(field)
+		}
+	}
+	c.line.WriteString("\n")
+
+	_, err := io.WriteString(c.w, c.line.String())
+	return err
+}
+
+// end flushes what the encoder still holds.
+func (c *csvWriter) end() error {
+	return c.w.Close()
+}
+
+func (c *csvWriter) needsQuotes(field string, numeric bool) bool {
+	switch c.options.Quote {
+	case QuoteAll:
+		return true
+	case QuoteNonNumeric:
+		if !numeric {
+			return true
+		}
+	}
+	if field == "" {
+		// NOTE: an empty string would read back as NULL when NULL is empty too
+		return c.options.Null == ""
+	}
+	return field == c.options.Null ||
+		strings.Contains(field, c.delimiter) ||
+		strings.ContainsAny(field, "\"\r\n") ||
+		field[0] == ' ' || field[0] == '\t'
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return base64.StdEncoding.EncodeToString(v)
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
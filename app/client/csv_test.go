@@ -0,0 +1,87 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestExportCSV(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, score REAL); INSERT INTO t VALUES (1, 'plain', 1.5), (2, 'with, "quotes"', NULL), (3, '', 2), (4, 'café', 3)`)
+	r.NoError(err)
+
+	testCases := []struct {
+		name     string
+		options  CSVOptions
+		query    string
+		expected string
+	}{
+		{"Defaults", CSVOptions{}, "SELECT id, name FROM t WHERE id < 3", "1,plain\n2,\"with, \"\"quotes\"\"\"\n"},
+		{"Header", CSVOptions{Header: true}, "SELECT id FROM t WHERE id = 1", "id\n1\n"},
+		{"Delimiter", CSVOptions{Delimiter: ";"}, "SELECT id, name, score FROM t WHERE id < 3", "1;plain;1.5\n2;\"with, \"\"quotes\"\"\";\n"},
+		{"Empty string and NULL", CSVOptions{}, "SELECT name, score FROM t WHERE id IN (2, 3)", "\"with, \"\"quotes\"\"\",\n\"\",2\n"},
+		{"NULL representation", CSVOptions{Null: `\N`}, "SELECT name, score FROM t WHERE id IN (2, 3)", "\"with, \"\"quotes\"\"\",\\N\n,2\n"},
+		{"Quote all", CSVOptions{Quote: QuoteAll}, "SELECT id, name, score FROM t WHERE id = 2", "\"2\",\"with, \"\"quotes\"\"\",\n"},
+		{"Quote non numeric", CSVOptions{Quote: QuoteNonNumeric, Header: true}, "SELECT id, name FROM t WHERE id = 1", "\"id\",\"name\"\n1,\"plain\"\n"},
+		{"Latin-1", CSVOptions{Encoding: Latin1}, "SELECT name FROM t WHERE id = 4", "caf\xe9\n"},
+		{"UTF-8 BOM", CSVOptions{Encoding: UTF8BOM}, "SELECT name FROM t WHERE id = 1", "\xef\xbb\xbfplain\n"},
+		{"UTF-16", CSVOptions{Encoding: UTF16LE}, "SELECT id FROM t WHERE id = 1", "\xff\xfe1\x00\n\x00"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			var buf bytes.Buffer
+			err := exportQuery(context.Background(), db, sqliteDialect, &buf, tc.query, ExportOptions{Type: CSV, CSV: tc.options})
+			r.NoError(err)
+			r.Equal(tc.expected, buf.String())
+		})
+	}
+
+	var buf bytes.Buffer
+	err = exportQuery(context.Background(), db, sqliteDialect, &buf, "SELECT 1", ExportOptions{Type: CSV, CSV: CSVOptions{Delimiter: `"`}})
+	r.Error(err, "Expected an invalid delimiter to be refused")
+
+	err = exportQuery(context.Background(), db, sqliteDialect, &buf, "DELETE FROM t", ExportOptions{Type: CSV})
+	r.Error(err, "Expected only queries returning rows to be exported")
+	r.Empty(buf.String())
+}
+
+func TestExportData(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, secret TEXT); INSERT INTO t VALUES (1, 'a', 'x'), (2, 'b', 'y'); CREATE TABLE u (id INTEGER)`)
+	r.NoError(err)
+
+	c := &SqliteClient{Db: db}
+	var buf bytes.Buffer
+	err = c.Export(context.Background(), &buf, ExportOptions{Type: CSV, Selected: []string{"main", "main.t", "main.t.id", "main.t.name"}, CSV: CSVOptions{Header: true}})
+	r.NoError(err)
+	r.Equal("id,name\n1,a\n2,b\n", buf.String(), "Expected only the selected columns")
+
+	err = c.Export(context.Background(), &buf, ExportOptions{Type: CSV, Selected: []string{"main.t", "main.t.id", "main.u", "main.u.id"}})
+	r.Error(err, "Expected a CSV export to hold a single table")
+}
+
+func TestSelectedTables(t *testing.T) {
+	r := require.New(t)
+
+	selected := []string{"main", "main.t", "main.t.id", "main.u", "main.u.id", "main.t.a.b"}
+	r.Equal([][]string{{"main.t", "main.t.id", "main.t.a.b"}, {"main.u", "main.u.id"}}, SelectedTables(selected), "Expected the columns grouped by table, dots kept in column names")
+	r.Equal([]exportTable{{schema: "main", name: "t", columns: []string{"id", "a.b"}}, {schema: "main", name: "u", columns: []string{"id"}}}, exportTables(selected))
+}
@@ -0,0 +1,456 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultDiffLimit = 1000
+
+type DataDiffOptions struct {
+	Limit int `json:"limit"` // rows reported at most, defaults to 1000, the counts cover the whole table
+}
+
+// RowDiff is a row only in the source (Added), only in the target (Removed)
+// or in both with different values (Changed).
+type RowDiff struct {
+	Kind    DiffKind `json:"kind"`
+	Key     []any    `json:"key"`
+	Source  Row      `json:"source"`
+	Target  Row      `json:"target"`
+	Changes []string `json:"changes"` // the columns that differ
+}
+
+type DataDiff struct {
+	Table     string    `json:"table"`
+	Columns   []string  `json:"columns"` // the columns both tables have
+	Key       []string  `json:"key"`
+	Rows      []RowDiff `json:"rows"`
+	Added     int       `json:"added"`
+	Removed   int       `json:"removed"`
+	Changed   int       `json:"changed"`
+	Unchanged int       `json:"unchanged"`
+	Truncated bool      `json:"truncated"`
+	Script    string    `json:"script"` // the file the sync script was saved to, if any
+}
+
+// diffSide streams the rows of one of the compared tables.
+type diffSide struct {
+	rows    *sql.Rows
+	values  []any
+	key     []any
+	kinds   []valueKind
+	numeric []bool
+	done    bool
+}
+
+func (s *diffSide) next(keyIndexes []int) error {
+	if !s.rows.Next() {
+		s.done = true
+		return s.rows.Err()
+	}
+	values := make([]any, len(s.kinds))
+	pointers := make([]any, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	err := s.rows.Scan(pointers...)
+	if err != nil {
+		return err
+	}
+
+	key := make([]any, len(keyIndexes))
+	for i, index := range keyIndexes {
+		key[i] = values[index]
+	}
+	// NOTE: merging both sides is only right as long as the database orders keys the way compareKeys does
+	if s.key != nil && compareKeys(s.key, key, s.numeric, keyIndexes) >= 0 {
+		return fmt.Errorf("rows are not ordered by primary key the way they are compared, the key collation is not supported")
+	}
+	s.values = values
+	s.key = key
+	return nil
+}
+
+// DiffTableData compares the rows of a table on two connections by primary
+// key, streaming both sides ordered by key so memory stays flat whatever the
+// size of the table. The statements syncing the target with the source are
+// written to script, when not nil, and cover every difference even past the
+// limit.
+func DiffTableData(ctx context.Context, source DatabaseClient, sourceSchema string, target DatabaseClient, targetSchema string, table string, options DataDiffOptions, script io.Writer) (DataDiff, error) {
+	diff := DataDiff{Table: table, Rows: make([]RowDiff, 0)}
+	if options.Limit <= 0 {
+		options.Limit = defaultDiffLimit
+	}
+
+	sourceTable, err := source.GetTableMetadata(ctx, sourceSchema, table)
+	if err != nil {
+		return diff, err
+	}
+	targetTable, err := target.GetTableMetadata(ctx, targetSchema, table)
+	if err != nil {
+		return diff, err
+	}
+
+	diff.Key = primaryKeyColumns(sourceTable.Columns)
+	targetKey := primaryKeyColumns(targetTable.Columns)
+	if len(diff.Key) == 0 {
+		return diff, fmt.Errorf("%s.%s has no primary key to match rows by", sourceSchema, table)
+	}
+	if len(diff.Key) != len(targetKey) || !containsAll(targetKey, diff.Key) {
+		return diff, fmt.Errorf("%s.%s and %s.%s have different primary keys", sourceSchema, table, targetSchema, table)
+	}
+
+	diff.Columns = make([]string, 0)
+	types := make(map[string]string)
+	for _, column := range targetTable.Columns {
+		types[column.Name] = column.Type
+	}
+	for _, column := range sourceTable.Columns {
+		if _, exists := types[column.Name]; exists {
+			diff.Columns = append(diff.Columns, column.Name)
+		}
+	}
+	keyIndexes := make([]int, len(diff.Key))
+	for i, key := range diff.Key {
+		keyIndexes[i] = slices.Index(diff.Columns, key)
+	}
+
+	sd, td := dialectOf(source), dialectOf(target)
+	s, err := openDiffSide(ctx, dbOf(source), sd, sourceSchema, table, diff.Columns, diff.Key, sourceTable.Columns)
+	if err != nil {
+		return diff, err
+	}
+	defer s.rows.Close()
+	t, err := openDiffSide(ctx, dbOf(target), td, targetSchema, table, diff.Columns, diff.Key, targetTable.Columns)
+	if err != nil {
+		return diff, err
+	}
+	defer t.rows.Close()
+
+	sync := &syncWriter{out: &dumpWriter{w: script}, dialect: td, table: td.quoteIdentifier(targetSchema) + "." + td.quoteIdentifier(table), columns: diff.Columns, key: diff.Key, keyIndexes: keyIndexes}
+	report := func(row RowDiff) {
+		if len(diff.Rows) < options.Limit {
+			diff.Rows = append(diff.Rows, row)
+		} else {
+			diff.Truncated = true
+		}
+	}
+
+	if err := s.next(keyIndexes); err != nil {
+		return diff, err
+	}
+	if err := t.next(keyIndexes); err != nil {
+		return diff, err
+	}
+	for !s.done || !t.done {
+		var order int
+		switch {
+		case t.done:
+			order = -1
+		case s.done:
+			order = 1
+		default:
+			order = compareKeys(s.key, t.key, s.numeric, keyIndexes)
+		}
+
+		switch {
+		case order < 0:
+			diff.Added++
+			report(RowDiff{Kind: Added, Key: diffKey(s.key), Source: diffRow(diff.Columns, s.values)})
+			if script != nil {
+				sync.insert(s.values, s.kinds)
+			}
+			err = s.next(keyIndexes)
+		case order > 0:
+			diff.Removed++
+			report(RowDiff{Kind: Removed, Key: diffKey(t.key), Target: diffRow(diff.Columns, t.values)})
+			if script != nil {
+				sync.delete(t.values, t.kinds)
+			}
+			err = t.next(keyIndexes)
+		default:
+			changes := make([]string, 0)
+			for i, column := range diff.Columns {
+				if !valuesEqual(s.values[i], t.values[i], s.numeric[i] && t.numeric[i]) {
+					changes = append(changes, column)
+				}
+			}
+			if len(changes) == 0 {
+				diff.Unchanged++
+			} else {
+				diff.Changed++
+				report(RowDiff{Kind: Changed, Key: diffKey(s.key), Source: diffRow(diff.Columns, s.values), Target: diffRow(diff.Columns, t.values), Changes: changes})
+				if script != nil {
+					sync.update(s.values, s.kinds, t.values, t.kinds, changes)
+				}
+			}
+			err = s.next(keyIndexes)
+			if err == nil {
+				err = t.next(keyIndexes)
+			}
+		}
+		if err != nil {
+			return diff, err
+		}
+	}
+
+	return diff, sync.out.err
+}
+
+func containsAll(values []string, wanted []string) bool {
+	for _, value := range wanted {
+		if !slices.Contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// openDiffSide selects the compared columns ordered by key, text keys being
+// ordered byte by byte whatever the collation of the column.
+func openDiffSide(ctx context.Context, db *sql.DB, d dialect, schema string, table string, columns []string, key []string, metadata []ColumnMetadata) (*diffSide, error) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = d.quoteIdentifier(column)
+	}
+	orders := make([]string, len(key))
+	for i, column := range key {
+		orders[i] = d.quoteIdentifier(column)
+		index := slices.IndexFunc(metadata, func(c ColumnMetadata) bool { return c.Name == column })
+		if index < 0 || !isTextType(metadata[index].Type) {
+			continue
+		}
+		switch d {
+		case postgresDialect:
+			orders[i] += ` COLLATE "C"`
+		case mysqlDialect:
+			orders[i] = "CAST(" + orders[i] + " AS BINARY)"
+		default:
+			orders[i] += " COLLATE BINARY"
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s.%s ORDER BY %s", strings.Join(quoted, ", "), d.quoteIdentifier(schema), d.quoteIdentifier(table), strings.Join(orders, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+
+	side := &diffSide{rows: rows, kinds: make([]valueKind, len(columnTypes)), numeric: make([]bool, len(columnTypes))}
+	for i, col := range columnTypes {
+		side.kinds[i] = columnKind(col)
+		side.numeric[i] = isNumeric(col)
+	}
+	return side, nil
+}
+
+func isTextType(columnType string) bool {
+	columnType = strings.ToLower(columnType)
+	return strings.Contains(columnType, "char") || strings.Contains(columnType, "text") || strings.Contains(columnType, "clob")
+}
+
+func diffRow(columns []string, values []any) Row {
+	row := make(Row)
+	for i, column := range columns {
+		value := values[i]
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		row[column] = value
+	}
+	return row
+}
+
+func diffKey(key []any) []any {
+	values := make([]any, len(key))
+	for i, value := range key {
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// compareKeys orders two keys, numeric columns by value and the others
+// byte by byte, as the diff queries order them.
+func compareKeys(a []any, b []any, numeric []bool, keyIndexes []int) int {
+	for i := range a {
+		if order := compareValues(a[i], b[i], numeric[keyIndexes[i]]); order != 0 {
+			return order
+		}
+	}
+	return 0
+}
+
+func compareValues(a any, b any, numeric bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if numeric {
+		if x, ok := asInt(a); ok {
+			if y, ok := asInt(b); ok {
+				return compareOrdered(x, y)
+			}
+		}
+		if x, ok := asFloat(a); ok {
+			if y, ok := asFloat(b); ok {
+				return compareOrdered(x, y)
+			}
+		}
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(asText(a), asText(b))
+}
+
+func compareOrdered[T int64 | float64](a T, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// valuesEqual compares values that may come from different databases, which
+// scan the same value in different ways (booleans as integers, numbers as
+// text, ...).
+func valuesEqual(a any, b any, numeric bool) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Equal(y)
+		}
+	}
+	if asText(a) == asText(b) {
+		return true
+	}
+	if x, ok := asFloat(a); ok && numeric {
+		if y, ok := asFloat(b); ok {
+			return x == y
+		}
+	}
+	return false
+}
+
+func asInt(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case []byte:
+		i, err := strconv.ParseInt(string(v), 10, 64)
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func asFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case []byte:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func asText(value any) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// syncWriter writes the statements bringing the target rows in line with
+// the source.
+type syncWriter struct {
+	out        *dumpWriter
+	dialect    dialect
+	table      string // already quoted
+	columns    []string
+	key        []string
+	keyIndexes []int
+}
+
+func (w *syncWriter) where(values []any, kinds []valueKind) string {
+	conditions := make([]string, len(w.key))
+	for i, column := range w.key {
+		index := w.keyIndexes[i]
+		if values[index] == nil {
+			conditions[i] = w.dialect.quoteIdentifier(column) + " IS NULL"
+			continue
+		}
+		conditions[i] = w.dialect.quoteIdentifier(column) + " = " + sqlLiteral(w.dialect, values[index], kinds[index])
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+func (w *syncWriter) insert(values []any, kinds []valueKind) {
+	columns := make([]string, len(w.columns))
+	literals := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		columns[i] = w.dialect.quoteIdentifier(column)
+		literals[i] = sqlLiteral(w.dialect, values[i], kinds[i])
+	}
+	w.out.printf("INSERT INTO %s (%s) VALUES (%s);\n", w.table, strings.Join(columns, ", "), strings.Join(literals, ", "))
+}
+
+func (w *syncWriter) update(values []any, kinds []valueKind, targetValues []any, targetKinds []valueKind, changes []string) {
+	assignments := make([]string, len(changes))
+	for i, column := range changes {
+		index := slices.Index(w.columns, column)
+		assignments[i] = w.dialect.quoteIdentifier(column) + " = " + sqlLiteral(w.dialect, values[index], kinds[index])
+	}
+	w.out.printf("UPDATE %s SET %s WHERE %s;\n", w.table, strings.Join(assignments, ", "), w.where(targetValues, targetKinds))
+}
+
+func (w *syncWriter) delete(values []any, kinds []valueKind) {
+	w.out.printf("DELETE FROM %s WHERE %s;\n", w.table, w.where(values, kinds))
+}
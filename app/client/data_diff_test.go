@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestDiffTableData(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	open := func(script string) *SqliteClient {
+		db, err := sql.Open("sqlite3", ":memory:")
+		r.NoError(err)
+		t.Cleanup(func() { db.Close() })
+		db.SetMaxOpenConns(1)
+		_, err = db.Exec(script)
+		r.NoError(err)
+		return &SqliteClient{Db: db}
+	}
+
+	source := open(`
+CREATE TABLE t (code TEXT COLLATE NOCASE, n INTEGER, label TEXT, price REAL, extra TEXT, PRIMARY KEY (code, n));
+INSERT INTO t VALUES ('a', 1, 'same', 1.5, 'x'), ('a', 2, 'new', NULL, 'x'), ('B', 10, 'changed', 2, 'x'), ('b', 9, 'same', NULL, 'x');
+`)
+	target := open(`
+CREATE TABLE t (code TEXT, n INTEGER, label TEXT, price REAL, PRIMARY KEY (code, n));
+INSERT INTO t VALUES ('a', 1, 'same', 1.5), ('B', 10, 'old', 2.0), ('b', 9, 'same', NULL), ('c', 1, 'gone', NULL);
+`)
+
+	var script strings.Builder
+	diff, err := DiffTableData(ctx, source, "main", target, "main", "t", DataDiffOptions{}, &script)
+	r.NoError(err)
+	r.Equal([]string{"code", "n", "label", "price"}, diff.Columns, "Expected columns missing from a side to be left out")
+	r.Equal([]string{"code", "n"}, diff.Key)
+	r.Equal(1, diff.Added)
+	r.Equal(1, diff.Removed)
+	r.Equal(1, diff.Changed)
+	r.Equal(2, diff.Unchanged)
+	r.Len(diff.Rows, 3)
+	r.Equal(RowDiff{Kind: Changed, Key: []any{"B", int64(10)}, Source: Row{"code": "B", "n": int64(10), "label": "changed", "price": 2.0}, Target: Row{"code": "B", "n": int64(10), "label": "old", "price": 2.0}, Changes: []string{"label"}}, diff.Rows[0])
+	r.Equal(Added, diff.Rows[1].Kind)
+	r.Equal([]any{"a", int64(2)}, diff.Rows[1].Key)
+	r.Equal(Removed, diff.Rows[2].Kind)
+	r.Equal(`UPDATE "main"."t" SET "label" = 'changed' WHERE "code" = 'B' AND "n" = 10;
+INSERT INTO "main"."t" ("code", "n", "label", "price") VALUES ('a', 2, 'new', NULL);
+DELETE FROM "main"."t" WHERE "code" = 'c' AND "n" = 1;
+`, script.String())
+
+	_, err = target.Db.Exec(script.String())
+	r.NoError(err)
+	script.Reset()
+	diff, err = DiffTableData(ctx, source, "main", target, "main", "t", DataDiffOptions{Limit: 1}, &script)
+	r.NoError(err)
+	r.Empty(diff.Rows, "Expected the script to sync the tables")
+	r.Equal(4, diff.Unchanged)
+	r.Empty(script.String())
+
+	_, err = target.Db.Exec("DELETE FROM t")
+	r.NoError(err)
+	diff, err = DiffTableData(ctx, source, "main", target, "main", "t", DataDiffOptions{Limit: 1}, &script)
+	r.NoError(err)
+	r.Equal(4, diff.Added)
+	r.Len(diff.Rows, 1)
+	r.True(diff.Truncated)
+	r.Equal(4, strings.Count(script.String(), "INSERT INTO"), "Expected the script to cover the rows past the limit")
+
+	noKey := open("CREATE TABLE t (a INTEGER)")
+	_, err = DiffTableData(ctx, noKey, "main", noKey, "main", "t", DataDiffOptions{}, nil)
+	r.Error(err)
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type dialect int
+
+const (
+	sqliteDialect dialect = iota
+	postgresDialect
+	mysqlDialect
+)
+
+func dialectOf(c DatabaseClient) dialect {
+	switch c.(type) {
+	case *PostgresClient:
+		return postgresDialect
+	case *MysqlClient:
+		return mysqlDialect
+	default:
+		return sqliteDialect
+	}
+}
+
+// dbOf returns the connection pool behind a client.
+func dbOf(c DatabaseClient) *sql.DB {
+	switch c := c.(type) {
+	case *PostgresClient:
+		return c.Db
+	case *MysqlClient:
+		return c.Db
+	case *SqliteClient:
+		return c.Db
+	}
+	return nil
+}
+
+// withCancelOf runs fn on a connection of the client whose statements are
+// cancelled server side along with ctx, without the connection limits. sqlite
+// runs fn on the pool as the driver interrupts statements itself.
+func withCancelOf(ctx context.Context, c DatabaseClient, fn func(txBeginner) error) error {
+	switch c := c.(type) {
+	case *PostgresClient:
+		return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+			return fn(conn)
+		})
+	case *MysqlClient:
+		return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+			return fn(conn)
+		})
+	}
+	return fn(dbOf(c))
+}
+
+// limitsOf returns the limits the client applies to each statement.
+func limitsOf(c DatabaseClient) Limits {
+	switch c := c.(type) {
+	case *PostgresClient:
+		return c.Limits
+	case *MysqlClient:
+		return c.Limits
+	case *SqliteClient:
+		return c.Limits
+	}
+	return Limits{}
+}
+
+// cancelQueries returns the query reading the backend id of a connection and
+// the one cancelling the statement of a backend id, sqlite having neither as
+// the driver interrupts statements itself.
+func (d dialect) cancelQueries() (string, string) {
+	switch d {
+	case postgresDialect:
+		return "SELECT pg_backend_pid()", "SELECT pg_cancel_backend(%d)"
+	case mysqlDialect:
+		return "SELECT CONNECTION_ID()", "KILL QUERY %d"
+	}
+	return "", ""
+}
+
+func (d dialect) quoteIdentifier(name string) string {
+	if d == mysqlDialect {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// placeholder returns the bind parameter for the n-th argument, starting at 1.
+func (d dialect) placeholder(n int) string {
+	if d == postgresDialect {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// estimateCountQuery returns the query reading a table's row count from the
+// statistics gathered by the database, given the schema and table as arguments.
+func (d dialect) estimateCountQuery() string {
+	switch d {
+	case postgresDialect:
+		return "SELECT c.reltuples::bigint FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = $1 AND c.relname = $2"
+	case mysqlDialect:
+		return "SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+	default:
+		// NOTE: the first number of any sqlite_stat1 entry is the table row count, there's a single schema
+		return "SELECT CAST(stat AS INTEGER) FROM sqlite_stat1 WHERE ? IS NOT NULL AND tbl = ? LIMIT 1"
+	}
+}
+
+func (d dialect) quoteString(s string) string {
+	if d == mysqlDialect {
+		// NOTE: mysql treats backslashes as escapes unless NO_BACKSLASH_ESCAPES is set
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (d dialect) quoteBinary(b []byte) string {
+	if d == postgresDialect {
+		return fmt.Sprintf(`'\x%x'`, b)
+	}
+	return fmt.Sprintf("X'%x'", b)
+}
+
+// timeLayout returns how timestamps are written in literals, the way each
+// database (and the sqlite driver) reads them back.
+func (d dialect) timeLayout() string {
+	switch d {
+	case postgresDialect:
+		return time.RFC3339Nano
+	case mysqlDialect:
+		return "2006-01-02 15:04:05.999999"
+	default:
+		return "2006-01-02 15:04:05.999999999-07:00"
+	}
+}
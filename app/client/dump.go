@@ -0,0 +1,286 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultBatchSize = 100
+
+// dumpWriter keeps the first write error so the dump can be written without
+// checking every line.
+type dumpWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *dumpWriter) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+// tableDDL holds the statements recreating a table, split so a dump can
+// create every table first and only add foreign keys, indexes and triggers
+// once the data is in, like pg_dump does.
+type tableDDL struct {
+	create []string
+	after  []string
+
+	// NOTE: what the INSERTs of the data need to know about the table
+	generated  []string // columns computed by the database, they can't be inserted into
+	overriding bool     // GENERATED ALWAYS identity columns only take the dumped values when overridden
+	sequences  []string // statements moving the sequences past the inserted rows
+}
+
+func (t tableDDL) String(d dialect) string {
+	var b strings.Builder
+	out := &dumpWriter{w: &b}
+	for _, statement := range append(t.create, t.after...) {
+		writeStatement(out, d, statement)
+	}
+	return b.String()
+}
+
+func writeStatement(out *dumpWriter, d dialect, statement string) {
+	// NOTE: mysql trigger bodies hold semicolons, the mysql client needs another delimiter around them
+	if d == mysqlDialect && strings.Contains(statement, ";") {
+		out.printf("DELIMITER ;;\n%s;;\nDELIMITER ;\n", statement)
+		return
+	}
+	out.printf("%s;\n", statement)
+}
+
+// ifNotExists turns CREATE TABLE, INDEX, SEQUENCE or TRIGGER statements into
+// their IF NOT EXISTS form, other statements are left as they are.
+func ifNotExists(d dialect, statement string) string {
+	tokens := codeTokens(d, statement)
+	if len(tokens) == 0 || !isWord(tokens[0], "CREATE") {
+		return statement
+	}
+	for i, t := range tokens {
+		if t.kind != wordToken {
+			return statement
+		}
+		objects := []string{"TABLE", "INDEX", "SEQUENCE"}
+		if d != postgresDialect {
+			objects = append(objects, "TRIGGER")
+		}
+		for _, object := range objects {
+			if !isWord(t, object) {
+				continue
+			}
+			if i+1 < len(tokens) && isWord(tokens[i+1], "IF") {
+				return statement
+			}
+			return statement[:t.end] + " IF NOT EXISTS" + statement[t.end:]
+		}
+	}
+	return statement
+}
+
+// dumpTableName is the name the dump refers to a table with, schemas only
+// exist on their own in postgres, the other databases dump a single schema.
+func dumpTableName(d dialect, table exportTable) string {
+	if d == postgresDialect {
+		return d.quoteIdentifier(table.schema) + "." + d.quoteIdentifier(table.name)
+	}
+	return d.quoteIdentifier(table.name)
+}
+
+// dumpSQL streams a SQL dump of the selected tables, reading the rows as they
+// arrive (none of the drivers buffer a whole result) and writing them as
+// multi-row INSERTs of options.BatchSize rows, so memory doesn't grow with
+// the size of the tables.
+func dumpSQL(ctx context.Context, db querier, d dialect, w io.Writer, options ExportOptions, ddl func(schema string, table string) (tableDDL, error)) error {
+	out := &dumpWriter{w: w}
+	tables := exportTables(options.Selected)
+
+	if options.WrapInTransaction {
+		out.printf("BEGIN;\n")
+	}
+	if d == mysqlDialect {
+		// NOTE: tables are dumped in the selection order, not in the order their foreign keys need
+		out.printf("SET FOREIGN_KEY_CHECKS = 0;\n")
+	}
+
+	// NOTE: STEP 1 => Create tables, the data needs their DDL too
+	ddls := make([]tableDDL, 0, len(tables))
+	if options.DropTable != DoNothing || !options.SchemaOnly {
+		for _, table := range tables {
+			tableDDL, err := ddl(table.schema, table.name)
+			if err != nil {
+				return err
+			}
+			ddls = append(ddls, tableDDL)
+		}
+	}
+	if options.DropTable != DoNothing {
+		if options.DropTable == DropAndCreate {
+			for i := len(tables) - 1; i >= 0; i-- {
+				out.printf("DROP TABLE IF EXISTS %s;\n", dumpTableName(d, tables[i]))
+			}
+		}
+		for _, tableDDL := range ddls {
+			for _, statement := range tableDDL.create {
+				if options.DropTable == CreateIfNotExists {
+					statement = ifNotExists(d, statement)
+				}
+				writeStatement(out, d, statement)
+			}
+		}
+	}
+
+	// NOTE: STEP 2 => Insert data
+	if !options.SchemaOnly {
+		out.printf("\n")
+		batchSize := options.BatchSize
+		if batchSize <= 0 {
+			batchSize = defaultBatchSize
+		}
+		for i, table := range tables {
+			iw := &insertWriter{out: out, dialect: d, table: dumpTableName(d, table), batchSize: batchSize, generated: ddls[i].generated, overriding: ddls[i].overriding}
+			err := streamRows(ctx, db, iw, table.selectQuery(d))
+			if err != nil {
+				return err
+			}
+			for _, statement := range ddls[i].sequences {
+				writeStatement(out, d, statement)
+			}
+		}
+		out.printf("\n")
+	}
+
+	// NOTE: STEP 3 => Add foreign keys, indexes and triggers
+	if options.DropTable != DoNothing {
+		for _, tableDDL := range ddls {
+			for _, statement := range tableDDL.after {
+				if options.DropTable == CreateIfNotExists {
+					statement = ifNotExists(d, statement)
+				}
+				writeStatement(out, d, statement)
+			}
+		}
+	}
+
+	if d == mysqlDialect {
+		out.printf("SET FOREIGN_KEY_CHECKS = 1;\n")
+	}
+	if options.WrapInTransaction {
+		out.printf("COMMIT;\n")
+	}
+
+	return out.err
+}
+
+// insertWriter writes the rows of a table as INSERT statements of batchSize
+// rows each, leaving the generated columns out.
+type insertWriter struct {
+	out        *dumpWriter
+	dialect    dialect
+	table      string // already quoted
+	batchSize  int
+	generated  []string
+	overriding bool
+	insert     string
+	columns    []int // the indexes of the inserted columns in the rows
+	kinds      []valueKind
+	rows       int
+	line       strings.Builder
+}
+
+func (i *insertWriter) begin(columns []*sql.ColumnType) error {
+	names := make([]string, 0, len(columns))
+	i.columns = make([]int, 0, len(columns))
+	i.kinds = make([]valueKind, len(columns))
+	for j, col := range columns {
+		i.kinds[j] = columnKind(col)
+		if slices.Contains(i.generated, col.Name()) {
+			continue
+		}
+		names = append(names, i.dialect.quoteIdentifier(col.Name()))
+		i.columns = append(i.columns, j)
+	}
+	overriding := ""
+	if i.overriding {
+		overriding = " OVERRIDING SYSTEM VALUE"
+	}
+	i.insert = fmt.Sprintf("INSERT INTO %s (%s)%s VALUES\n", i.table, strings.Join(names, ", "), overriding)
+	return nil
+}
+
+func (i *insertWriter) write(values []any) error {
+	i.line.Reset()
+	if i.rows%i.batchSize == 0 {
+		if i.rows > 0 {
+			i.line.WriteString(";\n")
+		}
+		i.line.WriteString(i.insert)
+	} else {
+		i.line.WriteString(",\n")
+	}
+
+	i.line.WriteString("    (")
+	for n, j := range i.columns {
+		if n > 0 {
+			i.line.WriteString(", ")
+		}
+		i.line.WriteString(sqlLiteral(i.dialect, values[j], i.kinds[j]))
+	}
+	i.line.WriteString(")")
+	i.rows++
+
+	i.out.printf("%s", i.line.String())
+	return i.out.err
+}
+
+func (i *insertWriter) end() error {
+	if i.rows > 0 {
+		i.out.printf(";\n")
+	}
+	return i.out.err
+}
+
+// sqlLiteral formats a scanned value as a literal of the dialect, the column
+// kind telling numbers and binary apart when drivers return []byte.
+func sqlLiteral(d dialect, value any, kind valueKind) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return d.quoteString(strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return d.quoteString(v.Format(d.timeLayout()))
+	case []byte:
+		switch {
+		case kind == binaryKind || !utf8.Valid(v):
+			return d.quoteBinary(v)
+		case kind == numberKind && isJSONNumber(v):
+			return string(v)
+		default:
+			return d.quoteString(string(v))
+		}
+	case string:
+		return d.quoteString(v)
+	}
+	return d.quoteString(fmt.Sprint(value))
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestDumpSQL(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, data BLOB); INSERT INTO t VALUES (1, 'it''s', x'00ff'), (2, NULL, NULL), (3, 'c', NULL), (4, 'd', NULL), (5, 'e', NULL)`)
+	r.NoError(err)
+
+	c := &SqliteClient{Db: db}
+	var buf bytes.Buffer
+	options := ExportOptions{Type: SQL, DropTable: Create, WrapInTransaction: true, BatchSize: 2, Selected: []string{"main.t", "main.t.id", "main.t.name", "main.t.data"}}
+	err = c.Export(context.Background(), &buf, options)
+	r.NoError(err)
+
+	dump := buf.String()
+	r.Equal(3, strings.Count(dump, "INSERT INTO"), "Expected rows to be batched")
+	r.Contains(dump, `INSERT INTO "t" ("id", "name", "data") VALUES`+"\n    (1, 'it''s', X'00ff'),\n    (2, NULL, NULL);\n")
+
+	copied, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer copied.Close()
+	copied.SetMaxOpenConns(1)
+
+	_, err = copied.Exec(dump)
+	r.NoError(err, "Expected the dump to be importable")
+	var count int
+	var data []byte
+	err = copied.QueryRow("SELECT COUNT(*), (SELECT data FROM t WHERE id = 1) FROM t").Scan(&count, &data)
+	r.NoError(err)
+	r.Equal(5, count)
+	r.Equal([]byte{0x00, 0xff}, data)
+
+	buf.Reset()
+	options.SchemaOnly = true
+	err = c.Export(context.Background(), &buf, options)
+	r.NoError(err)
+	r.NotContains(buf.String(), "INSERT INTO")
+}
+
+func TestDumpRoundTrip(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY AUTOINCREMENT, a INTEGER, b INTEGER GENERATED ALWAYS AS (a * 2) STORED, c INTEGER GENERATED ALWAYS AS (a + 1) VIRTUAL); INSERT INTO t (a) VALUES (2), (3)`)
+	r.NoError(err)
+
+	c := &SqliteClient{Db: db}
+	var buf bytes.Buffer
+	options := ExportOptions{Type: SQL, DropTable: DropAndCreate, Selected: []string{"main.t", "main.t.id", "main.t.a", "main.t.b", "main.t.c"}}
+	err = c.Export(context.Background(), &buf, options)
+	r.NoError(err)
+	dump := buf.String()
+	r.Contains(dump, `INSERT INTO "t" ("id", "a") VALUES`+"\n    (1, 2),\n    (2, 3);\n", "Expected the generated columns to be left out")
+
+	copied, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer copied.Close()
+	copied.SetMaxOpenConns(1)
+
+	_, err = copied.Exec(dump)
+	r.NoError(err, "Expected the dump to be importable")
+	_, err = copied.Exec("INSERT INTO t (a) VALUES (4)")
+	r.NoError(err, "Expected new rows to get new IDs")
+	var id, b, cc int
+	err = copied.QueryRow("SELECT id, b, c FROM t WHERE a = 4").Scan(&id, &b, &cc)
+	r.NoError(err)
+	r.Equal([]int{3, 8, 5}, []int{id, b, cc})
+
+	// NOTE: the data alone still has to leave the generated columns out
+	_, err = copied.Exec("DELETE FROM t")
+	r.NoError(err)
+	buf.Reset()
+	options.DropTable = DoNothing
+	err = c.Export(context.Background(), &buf, options)
+	r.NoError(err)
+	r.NotContains(buf.String(), "CREATE TABLE")
+	_, err = copied.Exec(buf.String())
+	r.NoError(err, "Expected the data to be importable in the existing table")
+}
+
+func TestInsertWriter(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	iw := &insertWriter{out: &dumpWriter{w: &buf}, dialect: postgresDialect, table: `"public"."t"`, batchSize: 10, generated: []string{"b"}, overriding: true}
+	err = streamRows(context.Background(), db, iw, "SELECT 1 AS id, 2 AS a, 4 AS b")
+	r.NoError(err)
+	r.Equal(`INSERT INTO "public"."t" ("id", "a") OVERRIDING SYSTEM VALUE VALUES`+"\n    (1, 2);\n", buf.String())
+
+	r.Equal(`SELECT setval('public.t_id_seq', MAX(id)) FROM "public"."t" HAVING MAX(id) IS NOT NULL`, setvalStatement(`'public.t_id_seq'`, `"public"."t"`, "id"))
+}
+
+func TestSQLLiteral(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dialect  dialect
+		value    any
+		kind     valueKind
+		expected string
+	}{
+		{"Null", postgresDialect, nil, otherKind, "NULL"},
+		{"Boolean", sqliteDialect, true, otherKind, "TRUE"},
+		{"Float", postgresDialect, 1.5, numberKind, "1.5"},
+		{"Decimal as bytes", mysqlDialect, []byte("12.50"), numberKind, "12.50"},
+		{"Text as bytes", mysqlDialect, []byte("12.50"), otherKind, "'12.50'"},
+		{"Quote", postgresDialect, "it's", otherKind, "'it''s'"},
+		{"Backslash in postgres", postgresDialect, `a\b`, otherKind, `'a\b'`},
+		{"Backslash in mysql", mysqlDialect, []byte(`a\b`), otherKind, `'a\\b'`},
+		{"Bytea", postgresDialect, []byte("ab"), binaryKind, `'\x6162'`},
+		{"Blob", mysqlDialect, []byte("ab"), binaryKind, "X'6162'"},
+		{"Timestamp in mysql", mysqlDialect, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), timestampKind, "'2024-01-02 03:04:05'"},
+		{"Timestamp in postgres", postgresDialect, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), timestampKind, "'2024-01-02T03:04:05Z'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			r.Equal(tc.expected, sqlLiteral(tc.dialect, tc.value, tc.kind))
+		})
+	}
+}
+
+func TestGetTableDDL(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+CREATE TABLE t (a INTEGER, b TEXT COLLATE NOCASE, c INTEGER GENERATED ALWAYS AS (a * 2), PRIMARY KEY (a, b));
+CREATE INDEX t_c ON t (c);
+CREATE TRIGGER t_log AFTER INSERT ON t BEGIN SELECT 1; SELECT 2; END;
+INSERT INTO t (a, b) VALUES (1, 'x');
+`)
+	r.NoError(err)
+
+	c := &SqliteClient{Db: db}
+	ddl, err := c.GetTableDDL(context.Background(), "main", "t")
+	r.NoError(err)
+	r.Equal("CREATE TABLE t (a INTEGER, b TEXT COLLATE NOCASE, c INTEGER GENERATED ALWAYS AS (a * 2), PRIMARY KEY (a, b));\n"+
+		"CREATE INDEX t_c ON t (c);\n"+
+		"CREATE TRIGGER t_log AFTER INSERT ON t BEGIN SELECT 1; SELECT 2; END;\n", ddl)
+
+	_, err = c.GetTableDDL(context.Background(), "main", "missing")
+	r.Error(err)
+
+	var buf bytes.Buffer
+	options := ExportOptions{Type: SQL, DropTable: CreateIfNotExists, Selected: []string{"main.t", "main.t.a", "main.t.b"}}
+	err = c.Export(context.Background(), &buf, options)
+	r.NoError(err)
+	dump := buf.String()
+	r.Contains(dump, "CREATE TABLE IF NOT EXISTS t (")
+	r.Contains(dump, "CREATE INDEX IF NOT EXISTS t_c ON t (c);")
+	r.Less(strings.Index(dump, "INSERT INTO"), strings.Index(dump, "CREATE TRIGGER"), "Expected triggers to be created after the data")
+
+	copied, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer copied.Close()
+	copied.SetMaxOpenConns(1)
+
+	_, err = copied.Exec(dump)
+	r.NoError(err, "Expected the dump to be importable")
+	var doubled int
+	err = copied.QueryRow("SELECT c FROM t").Scan(&doubled)
+	r.NoError(err)
+	r.Equal(2, doubled, "Expected the generated column to be kept")
+
+	buf.Reset()
+	options.SchemaOnly = true
+	err = c.Export(context.Background(), &buf, options)
+	r.NoError(err)
+	_, err = copied.Exec(buf.String())
+	r.NoError(err, "Expected the schema to be created only if missing")
+}
+
+func TestIfNotExists(t *testing.T) {
+	testCases := []struct {
+		name      string
+		dialect   dialect
+		statement string
+		expected  string
+	}{
+		{"Table", sqliteDialect, "CREATE TABLE t (a INT)", "CREATE TABLE IF NOT EXISTS t (a INT)"},
+		{"Unique index", postgresDialect, "CREATE UNIQUE INDEX i ON t USING btree (a)", "CREATE UNIQUE INDEX IF NOT EXISTS i ON t USING btree (a)"},
+		{"Already there", sqliteDialect, "CREATE TABLE IF NOT EXISTS t (a INT)", "CREATE TABLE IF NOT EXISTS t (a INT)"},
+		{"Trigger in sqlite", sqliteDialect, "CREATE TRIGGER g AFTER INSERT ON t BEGIN SELECT 1; END", "CREATE TRIGGER IF NOT EXISTS g AFTER INSERT ON t BEGIN SELECT 1; END"},
+		{"Trigger in postgres", postgresDialect, "CREATE TRIGGER g AFTER INSERT ON t FOR EACH ROW EXECUTE FUNCTION f()", "CREATE TRIGGER g AFTER INSERT ON t FOR EACH ROW EXECUTE FUNCTION f()"},
+		{"Alter", postgresDialect, "ALTER TABLE ONLY t ADD CONSTRAINT f FOREIGN KEY (a) REFERENCES u(a)", "ALTER TABLE ONLY t ADD CONSTRAINT f FOREIGN KEY (a) REFERENCES u(a)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			r.Equal(tc.expected, ifNotExists(tc.dialect, tc.statement))
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RowChange updates the row identified by Key with Values.
+type RowChange struct {
+	Key    Row `json:"key"`    // primary key values, every column when the table has none
+	Values Row `json:"values"` // the changed columns
+}
+
+type ChangeKind string
+
+const (
+	ChangeUpdate ChangeKind = "update"
+	ChangeInsert ChangeKind = "insert"
+	ChangeDelete ChangeKind = "delete"
+)
+
+var ChangeKinds = []struct {
+	Value  ChangeKind
+	TSName string
+}{
+	{ChangeUpdate, "Update"},
+	{ChangeInsert, "Insert"},
+	{ChangeDelete, "Delete"},
+}
+
+// Change edits a row of any table, updates and deletes finding it by Key
+// and updates and inserts setting Values.
+type Change struct {
+	Kind   ChangeKind `json:"kind"`
+	Schema string     `json:"schema"`
+	Table  string     `json:"table"`
+	Key    Row        `json:"key"`
+	Values Row        `json:"values"`
+}
+
+// editor generates the statements editing a table, the columns of the
+// table in order being the only ones allowed.
+type editor struct {
+	dialect dialect
+	schema  string
+	table   string
+	columns []ColumnMetadata
+	key     []string
+	inline  bool // write values as literals instead of placeholders, to preview statements
+}
+
+func newEditor(ctx context.Context, c DatabaseClient, schema string, table string) (*editor, error) {
+	metadata, err := c.GetTableMetadata(ctx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	e := &editor{dialect: dialectOf(c), schema: schema, table: table, columns: metadata.Columns, key: primaryKeyColumns(metadata.Columns)}
+	return e, nil
+}
+
+// bind adds the value to the arguments of the statement and returns what
+// stands for it in the statement.
+func (e *editor) bind(args []any, value any) ([]any, string) {
+	if e.inline {
+		return args, sqlLiteral(e.dialect, value, otherKind)
+	}
+	args = append(args, value)
+	return args, e.dialect.placeholder(len(args))
+}
+
+func (e *editor) name() string {
+	return e.dialect.quoteIdentifier(e.schema) + "." + e.dialect.quoteIdentifier(e.table)
+}
+
+// ordered returns the columns set in the row in table order, failing on
+// columns the table doesn't have.
+func (e *editor) ordered(row Row) ([]string, error) {
+	columns := make([]string, 0, len(row))
+	for _, column := range e.columns {
+		if _, exists := row[column.Name]; exists {
+			columns = append(columns, column.Name)
+		}
+	}
+	if len(columns) != len(row) {
+		for name := range row {
+			if !columnExists(e.columns, name) {
+				return nil, fmt.Errorf("unknown column %s in %s.%s", name, e.schema, e.table)
+			}
+		}
+	}
+	return columns, nil
+}
+
+// where matches the row identified by key, which has to hold the primary key
+// or every column of a table without one.
+func (e *editor) where(key Row, args []any) (string, []any, error) {
+	columns, err := e.ordered(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(e.key) == 0 {
+		if len(columns) != len(e.columns) {
+			return "", nil, fmt.Errorf("%s.%s has no primary key, every column has to be used as the key", e.schema, e.table)
+		}
+	} else {
+		for _, column := range e.key {
+			if _, exists := key[column]; !exists {
+				return "", nil, fmt.Errorf("missing primary key column %s of %s.%s", column, e.schema, e.table)
+			}
+		}
+		columns = e.key
+	}
+
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		if key[column] == nil {
+			// NOTE: = NULL never matches
+			conditions[i] = e.dialect.quoteIdentifier(column) + " IS NULL"
+			continue
+		}
+		var value string
+		args, value = e.bind(args, key[column])
+		conditions[i] = e.dialect.quoteIdentifier(column) + " = " + value
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+func (e *editor) update(change RowChange) (string, []any, error) {
+	columns, err := e.ordered(change.Values)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(columns) == 0 {
+		return "", nil, fmt.Errorf("no column to update in %s.%s", e.schema, e.table)
+	}
+
+	args := make([]any, 0, len(columns))
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		var value string
+		args, value = e.bind(args, change.Values[column])
+		assignments[i] = e.dialect.quoteIdentifier(column) + " = " + value
+	}
+	where, args, err := e.where(change.Key, args)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s", e.name(), strings.Join(assignments, ", "), where), args, nil
+}
+
+func (e *editor) insert(row Row) (string, []any, error) {
+	columns, err := e.ordered(row)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(columns) == 0 {
+		if e.dialect == mysqlDialect {
+			return fmt.Sprintf("INSERT INTO %s () VALUES ()", e.name()), nil, nil
+		}
+		return fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", e.name()), nil, nil
+	}
+
+	args := make([]any, 0, len(columns))
+	quoted := make([]string, len(columns))
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = e.dialect.quoteIdentifier(column)
+		args, values[i] = e.bind(args, row[column])
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", e.name(), strings.Join(quoted, ", "), strings.Join(values, ", ")), args, nil
+}
+
+func (e *editor) delete(key Row) (string, []any, error) {
+	where, args, err := e.where(key, make([]any, 0))
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", e.name(), where), args, nil
+}
+
+func (e *editor) statement(change Change) (string, []any, error) {
+	switch change.Kind {
+	case ChangeUpdate:
+		return e.update(RowChange{Key: change.Key, Values: change.Values})
+	case ChangeInsert:
+		return e.insert(change.Values)
+	case ChangeDelete:
+		return e.delete(change.Key)
+	}
+	return "", nil, fmt.Errorf("unknown change kind: %s", change.Kind)
+}
+
+type editStatement struct {
+	query string
+	args  []any
+}
+
+// editStatements generates the statement of every change, the tables being
+// looked up once.
+func editStatements(ctx context.Context, c DatabaseClient, changes []Change, inline bool) ([]editStatement, error) {
+	editors := make(map[[2]string]*editor)
+	statements := make([]editStatement, 0, len(changes))
+	for _, change := range changes {
+		e, exists := editors[[2]string{change.Schema, change.Table}]
+		if !exists {
+			var err error
+			e, err = newEditor(ctx, c, change.Schema, change.Table)
+			if err != nil {
+				return nil, err
+			}
+			e.inline = inline
+			editors[[2]string{change.Schema, change.Table}] = e
+		}
+		query, args, err := e.statement(change)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, editStatement{query: query, args: args})
+	}
+	return statements, nil
+}
+
+// PreviewChanges writes the statements ApplyChanges runs, with their values
+// inlined.
+func PreviewChanges(ctx context.Context, c DatabaseClient, changes []Change) (string, error) {
+	statements, err := editStatements(ctx, c, changes, true)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, statement := range statements {
+		b.WriteString(statement.query + ";\n")
+	}
+	return b.String(), nil
+}
+
+// ApplyChanges runs the changes in a single transaction and returns the rows
+// each one affected. A change affecting more than one row rolls everything
+// back, as its key doesn't identify a single row, and so does an update or
+// delete affecting none, as its row is gone.
+func ApplyChanges(ctx context.Context, c DatabaseClient, changes []Change) (counts []int64, err error) {
+	statements, err := editStatements(ctx, c, changes, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = withCancelOf(ctx, c, func(db txBeginner) error {
+		counts, err = applyStatements(ctx, db, statements, changes)
+		return err
+	})
+	return counts, err
+}
+
+func applyStatements(ctx context.Context, db txBeginner, statements []editStatement, changes []Change) (counts []int64, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	counts = make([]int64, 0, len(statements))
+	for i, statement := range statements {
+		result, err := tx.ExecContext(ctx, statement.query, statement.args...)
+		if err != nil {
+			return nil, fmt.Errorf("change %d of %d: %w", i+1, len(statements), err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if affected > 1 {
+			return nil, fmt.Errorf("%d rows of %s.%s match the same key, nothing was changed", affected, changes[i].Schema, changes[i].Table)
+		}
+		if affected == 0 && changes[i].Kind != ChangeInsert {
+			return nil, fmt.Errorf("no row of %s.%s matches the key of change %d of %d anymore, nothing was changed", changes[i].Schema, changes[i].Table, i+1, len(statements))
+		}
+		counts = append(counts, affected)
+	}
+	return counts, nil
+}
+
+// UpdateRows applies the changes in one transaction.
+func UpdateRows(ctx context.Context, c DatabaseClient, schema string, table string, changes []RowChange) ([]int64, error) {
+	edits := make([]Change, len(changes))
+	for i, change := range changes {
+		edits[i] = Change{Kind: ChangeUpdate, Schema: schema, Table: table, Key: change.Key, Values: change.Values}
+	}
+	return ApplyChanges(ctx, c, edits)
+}
+
+// InsertRows inserts the rows in one transaction, missing columns getting
+// their default value.
+func InsertRows(ctx context.Context, c DatabaseClient, schema string, table string, rows []Row) ([]int64, error) {
+	edits := make([]Change, len(rows))
+	for i, row := range rows {
+		edits[i] = Change{Kind: ChangeInsert, Schema: schema, Table: table, Values: row}
+	}
+	return ApplyChanges(ctx, c, edits)
+}
+
+// DeleteRows deletes the rows identified by the keys in one transaction.
+func DeleteRows(ctx context.Context, c DatabaseClient, schema string, table string, keys []Row) ([]int64, error) {
+	edits := make([]Change, len(keys))
+	for i, key := range keys {
+		edits[i] = Change{Kind: ChangeDelete, Schema: schema, Table: table, Key: key}
+	}
+	return ApplyChanges(ctx, c, edits)
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestEditRows(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+CREATE TABLE item (shop TEXT, id INTEGER, name TEXT, price REAL DEFAULT 1, PRIMARY KEY (shop, id));
+INSERT INTO item VALUES ('a', 1, 'pen', 2), ('a', 2, 'ink', 3), ('b', 1, 'pad', 4);
+CREATE TABLE log (message TEXT, level INTEGER);
+INSERT INTO log VALUES ('start', NULL), ('dup', 1), ('dup', 1);
+`)
+	r.NoError(err)
+	c := &SqliteClient{Db: db}
+	rows := func(query string) []string {
+		values, err := queryStrings(ctx, db, query)
+		r.NoError(err)
+		return values
+	}
+
+	_, err = UpdateRows(ctx, c, "main", "item", []RowChange{
+		{Key: Row{"shop": "a", "id": 1}, Values: Row{"name": "pencil", "price": 2.5}},
+		{Key: Row{"shop": "a", "id": 3}, Values: Row{"name": "missing"}},
+	})
+	r.ErrorContains(err, "no row of main.item matches the key of change 2 of 2")
+	r.Equal([]string{"pen|2.0", "ink|3.0", "pad|4.0"}, rows("SELECT name || '|' || price FROM item ORDER BY rowid"), "Expected a change to a missing row to roll back the others")
+	_, err = DeleteRows(ctx, c, "main", "item", []Row{{"shop": "a", "id": 3}})
+	r.ErrorContains(err, "no row of main.item matches the key")
+
+	counts, err := UpdateRows(ctx, c, "main", "item", []RowChange{
+		{Key: Row{"shop": "a", "id": 1}, Values: Row{"name": "pencil", "price": 2.5}},
+		{Key: Row{"shop": "a", "id": 2}, Values: Row{"name": "ink"}},
+	})
+	r.NoError(err)
+	r.Equal([]int64{1, 1}, counts, "Expected an update to the same values to count the row")
+	r.Equal([]string{"pencil|2.5", "ink|3.0", "pad|4.0"}, rows("SELECT name || '|' || price FROM item ORDER BY rowid"))
+
+	counts, err = InsertRows(ctx, c, "main", "item", []Row{{"shop": "b", "id": 2, "name": "cup"}})
+	r.NoError(err)
+	r.Equal([]int64{1}, counts)
+	r.Equal([]string{"1"}, rows("SELECT price FROM item WHERE shop = 'b' AND id = 2"), "Expected missing columns to get their default")
+
+	counts, err = DeleteRows(ctx, c, "main", "item", []Row{{"shop": "a", "id": 2}, {"shop": "b", "id": 1}})
+	r.NoError(err)
+	r.Equal([]int64{1, 1}, counts)
+	r.Equal([]string{"pencil", "cup"}, rows("SELECT name FROM item ORDER BY rowid"))
+
+	_, err = UpdateRows(ctx, c, "main", "item", []RowChange{
+		{Key: Row{"shop": "a", "id": 1}, Values: Row{"name": "rolled back"}},
+		{Key: Row{"shop": "a"}, Values: Row{"name": "x"}},
+	})
+	r.ErrorContains(err, "missing primary key column id")
+	r.Equal([]string{"pencil", "cup"}, rows("SELECT name FROM item ORDER BY rowid"), "Expected the transaction to be rolled back")
+
+	_, err = InsertRows(ctx, c, "main", "item", []Row{{"shop": "c", "id": 1, "colour": "red"}})
+	r.ErrorContains(err, "unknown column colour")
+
+	_, err = DeleteRows(ctx, c, "main", "log", []Row{{"message": "start"}})
+	r.ErrorContains(err, "no primary key")
+	counts, err = DeleteRows(ctx, c, "main", "log", []Row{{"message": "start", "level": nil}})
+	r.NoError(err)
+	r.Equal([]int64{1}, counts)
+	_, err = UpdateRows(ctx, c, "main", "log", []RowChange{{Key: Row{"message": "dup", "level": 1}, Values: Row{"level": 2}}})
+	r.ErrorContains(err, "2 rows of main.log match the same key")
+	r.Equal([]string{"1", "1"}, rows("SELECT level FROM log"))
+}
+
+func TestEditorStatements(t *testing.T) {
+	r := require.New(t)
+	columns := []ColumnMetadata{{Name: "id", PrimaryKey: true}, {Name: "name"}}
+
+	e := &editor{dialect: postgresDialect, schema: "public", table: "t", columns: columns, key: primaryKeyColumns(columns)}
+	query, args, err := e.update(RowChange{Key: Row{"id": 1, "name": "old"}, Values: Row{"name": "new"}})
+	r.NoError(err)
+	r.Equal(`UPDATE "public"."t" SET "name" = $1 WHERE "id" = $2`, query)
+	r.Equal([]any{"new", 1}, args)
+
+	e.dialect = mysqlDialect
+	query, args, err = e.insert(Row{})
+	r.NoError(err)
+	r.Equal("INSERT INTO `public`.`t` () VALUES ()", query)
+	r.Empty(args)
+	query, args, err = e.delete(Row{"id": 1})
+	r.NoError(err)
+	r.Equal("DELETE FROM `public`.`t` WHERE `id` = ?", query)
+	r.Equal([]any{1}, args)
+}
+
+func TestApplyChanges(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+CREATE TABLE author (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+CREATE TABLE book (id INTEGER PRIMARY KEY, title TEXT CHECK (title <> ''));
+INSERT INTO author VALUES (1, 'Ann');
+INSERT INTO book VALUES (1, 'Dune'), (2, 'Emma');
+`)
+	r.NoError(err)
+	c := &SqliteClient{Db: db}
+
+	changes := []Change{
+		{Kind: ChangeUpdate, Schema: "main", Table: "author", Key: Row{"id": 1.0}, Values: Row{"name": "Ann's"}},
+		{Kind: ChangeInsert, Schema: "main", Table: "book", Values: Row{"id": 3.0, "title": nil}},
+		{Kind: ChangeDelete, Schema: "main", Table: "book", Key: Row{"id": 2.0}},
+	}
+	preview, err := PreviewChanges(ctx, c, changes)
+	r.NoError(err)
+	r.Equal(`UPDATE "main"."author" SET "name" = 'Ann''s' WHERE "id" = 1;
+INSERT INTO "main"."book" ("id", "title") VALUES (3, NULL);
+DELETE FROM "main"."book" WHERE "id" = 2;
+`, preview)
+
+	failing := append(changes, Change{Kind: ChangeUpdate, Schema: "main", Table: "book", Key: Row{"id": 1.0}, Values: Row{"title": ""}})
+	_, err = ApplyChanges(ctx, c, failing)
+	r.ErrorContains(err, "change 4 of 4")
+	names, err := queryStrings(ctx, db, "SELECT name FROM author")
+	r.NoError(err)
+	r.Equal([]string{"Ann"}, names, "Expected no change to be applied")
+
+	counts, err := ApplyChanges(ctx, c, changes)
+	r.NoError(err)
+	r.Equal([]int64{1, 1, 1}, counts)
+	titles, err := queryStrings(ctx, db, "SELECT coalesce(title, 'none') FROM book ORDER BY id")
+	r.NoError(err)
+	r.Equal([]string{"Dune", "none"}, titles)
+
+	_, err = PreviewChanges(ctx, c, []Change{{Kind: "upsert", Schema: "main", Table: "book"}})
+	r.ErrorContains(err, "unknown change kind")
+}
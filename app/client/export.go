@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// rowWriter formats the rows of an export as they are read.
+type rowWriter interface {
+	begin(columns []*sql.ColumnType) error
+	write(values []any) error
+	end() error
+}
+
+func newRowWriter(w io.Writer, options ExportOptions) (rowWriter, error) {
+	switch options.Type {
+	case CSV:
+		csv, err := newCSVWriter(w, options.CSV)
+		if err != nil {
+			return nil, err
+		}
+		return csv, nil
+	case JSON, NDJSON:
+		return newJSONWriter(w, options.Type == NDJSON), nil
+	}
+	return nil, fmt.Errorf("unsupported export type: %s", options.Type)
+}
+
+// streamRows hands the rows of the query to the writer one at a time so an
+// export never holds a whole table in memory.
+func streamRows(ctx context.Context, db querier, rw rowWriter, query string, args ...any) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	err = rw.begin(columns)
+	if err != nil {
+		return err
+	}
+
+	values := make([]any, len(columns))
+	valuePtrs := make([]any, len(columns))
+	for i := range columns {
+		valuePtrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return err
+		}
+		if err := rw.write(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return rw.end()
+}
+
+var numericTypes = map[string]bool{
+	"INT": true, "INTEGER": true, "TINYINT": true, "SMALLINT": true, "MEDIUMINT": true, "BIGINT": true,
+	"INT2": true, "INT4": true, "INT8": true, "DECIMAL": true, "NUMERIC": true, "FLOAT": true,
+	"FLOAT4": true, "FLOAT8": true, "DOUBLE": true, "REAL": true,
+}
+
+// isNumeric tells whether a column holds numbers, mysql scans them as []byte
+// so the scan type is not enough.
+func isNumeric(col *sql.ColumnType) bool {
+	if scanType := col.ScanType(); scanType != nil {
+		switch scanType.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	}
+	name := strings.TrimPrefix(strings.ToUpper(col.DatabaseTypeName()), "UNSIGNED ")
+	return numericTypes[name]
+}
+
+type valueKind int
+
+const (
+	otherKind valueKind = iota
+	numberKind
+	booleanKind
+	binaryKind
+	timestampKind
+)
+
+var kindTypes = map[string]valueKind{
+	"BOOL": booleanKind, "BOOLEAN": booleanKind,
+	"BLOB": binaryKind, "TINYBLOB": binaryKind, "MEDIUMBLOB": binaryKind, "LONGBLOB": binaryKind,
+	"BYTEA": binaryKind, "BINARY": binaryKind, "VARBINARY": binaryKind,
+	"DATETIME": timestampKind, "TIMESTAMP": timestampKind, "TIMESTAMPTZ": timestampKind,
+}
+
+// columnKind tells how to write the values of a column when the scanned
+// type is not enough.
+func columnKind(col *sql.ColumnType) valueKind {
+	if isNumeric(col) {
+		return numberKind
+	}
+	return kindTypes[strings.ToUpper(col.DatabaseTypeName())]
+}
+
+type exportTable struct {
+	schema  string
+	name    string
+	columns []string
+}
+
+// exportTables groups the selected "schema.table[.column]" entries by table,
+// in the order the tables were first selected.
+func exportTables(selected []string) []exportTable {
+	tables := make([]exportTable, 0)
+	index := make(map[string]int)
+	for _, entity := range selected {
+		parts := strings.SplitN(entity, ".", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		table := parts[0] + "." + parts[1]
+		i, exists := index[table]
+		if !exists {
+			i = len(tables)
+			index[table] = i
+			tables = append(tables, exportTable{schema: parts[0], name: parts[1], columns: make([]string, 0)})
+		}
+		if len(parts) == 3 {
+			tables[i].columns = append(tables[i].columns, parts[2])
+		}
+	}
+	return tables
+}
+
+// SelectedTables splits the selected entries into the selection of each
+// table, the first entry of each being the "schema.table" itself.
+func SelectedTables(selected []string) [][]string {
+	tables := exportTables(selected)
+	selections := make([][]string, len(tables))
+	for i, t := range tables {
+		table := t.schema + "." + t.name
+		selections[i] = append(selections[i], table)
+		for _, col := range t.columns {
+			selections[i] = append(selections[i], table+"."+col)
+		}
+	}
+	return selections
+}
+
+func (t exportTable) selectQuery(d dialect) string {
+	columns := "*"
+	if len(t.columns) > 0 {
+		quoted := make([]string, 0)
+		for _, col := range t.columns {
+			quoted = append(quoted, d.quoteIdentifier(col))
+		}
+		columns = strings.Join(quoted, ", ")
+	}
+	return fmt.Sprintf("SELECT %s FROM %s.%s", columns, d.quoteIdentifier(t.schema), d.quoteIdentifier(t.name))
+}
+
+// exportData writes the rows of the selected table in a data format (CSV, ...),
+// which holds a single table per file.
+func exportData(ctx context.Context, db querier, d dialect, w io.Writer, options ExportOptions) error {
+	tables := exportTables(options.Selected)
+	if len(tables) != 1 {
+		return fmt.Errorf("a %s export holds a single table, got %d", options.Type, len(tables))
+	}
+
+	rw, err := newRowWriter(w, options)
+	if err != nil {
+		return err
+	}
+	return streamRows(ctx, db, rw, tables[0].selectQuery(d))
+}
+
+// exportQuery writes the result of an arbitrary query in a data format.
+func exportQuery(ctx context.Context, db querier, d dialect, w io.Writer, query string, options ExportOptions) error {
+	if !classifyStatement(d, query).returnsRows() {
+		return fmt.Errorf("only queries returning rows can be exported")
+	}
+
+	rw, err := newRowWriter(w, options)
+	if err != nil {
+		return err
+	}
+	return streamRows(ctx, db, rw, query)
+}
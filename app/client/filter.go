@@ -0,0 +1,97 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// columnExpression returns what to filter on for the given column: the
+// expression it aliases when it is one of the selected "expr AS alias"
+// columns, the quoted identifier otherwise.
+func columnExpression(d dialect, column string, selected []string) string {
+	for _, col := range selected {
+		tokens := strings.Split(col, " AS ")
+		if len(tokens) > 1 && tokens[1] == column {
+			return tokens[0]
+		}
+	}
+	return d.quoteIdentifier(column)
+}
+
+// compileFilter returns the condition for a single filter, appending its
+// values to args so placeholders are numbered after the existing ones.
+func compileFilter(d dialect, filter QueryFilter, selected []string, args []any) (string, []any, error) {
+	column := columnExpression(d, filter.Column, selected)
+	bind := func(value any) string {
+		args = append(args, value)
+		return d.placeholder(len(args))
+	}
+
+	switch filter.Operator {
+	case "", Equal, NotEqual, LessThan, GreaterThan, Like:
+		operator := filter.Operator
+		if operator == "" {
+			operator = Equal
+		}
+		return fmt.Sprintf("%s %s %s", column, operator, bind(filter.Value)), args, nil
+	case ILike:
+		if d == postgresDialect {
+			return fmt.Sprintf("%s ILIKE %s", column, bind(filter.Value)), args, nil
+		}
+		return fmt.Sprintf("LOWER(%s) LIKE LOWER(%s)", column, bind(filter.Value)), args, nil
+	case IsNull:
+		return fmt.Sprintf("%s IS NULL", column), args, nil
+	case In:
+		if len(filter.Values) == 0 {
+			return "", args, fmt.Errorf("no values for IN filter on column: %s", filter.Column)
+		}
+		placeholders := make([]string, 0)
+		for _, value := range filter.Values {
+			placeholders = append(placeholders, bind(value))
+		}
+		return fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")), args, nil
+	case Between:
+		if len(filter.Values) != 2 {
+			return "", args, fmt.Errorf("BETWEEN filter on column %s needs 2 values, got %d", filter.Column, len(filter.Values))
+		}
+		return fmt.Sprintf("%s BETWEEN %s AND %s", column, bind(filter.Values[0]), bind(filter.Values[1])), args, nil
+	default:
+		return "", args, fmt.Errorf("unsupported filter operator: %s", filter.Operator)
+	}
+}
+
+// compileGroup compiles the filter tree, nested groups being parenthesized.
+// Empty groups compile to an empty condition.
+func compileGroup(d dialect, group FilterGroup, selected []string, args []any) (string, []any, error) {
+	logic := group.Logic
+	switch logic {
+	case "":
+		logic = And
+	case And, Or:
+	default:
+		return "", args, fmt.Errorf("unsupported filter logic: %s", group.Logic)
+	}
+
+	conditions := make([]string, 0)
+	for _, filter := range group.Filters {
+		condition, newArgs, err := compileFilter(d, filter, selected, args)
+		if err != nil {
+			return "", args, err
+		}
+		args = newArgs
+		conditions = append(conditions, condition)
+	}
+	for _, subgroup := range group.Groups {
+		condition, newArgs, err := compileGroup(d, subgroup, selected, args)
+		if err != nil {
+			return "", args, err
+		}
+		if condition == "" {
+			continue
+		}
+		args = newArgs
+		conditions = append(conditions, "("+condition+")")
+	}
+
+	return strings.Join(conditions, " "+string(logic)+" "), args, nil
+}
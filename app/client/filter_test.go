@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCompileFilter(t *testing.T) {
+	testCases := []struct {
+		name      string
+		dialect   dialect
+		filter    QueryFilter
+		selected  []string
+		condition string
+		args      []any
+		fails     bool
+	}{
+		{"Default operator", sqliteDialect, QueryFilter{Column: "id", Value: 1.0}, nil, `"id" = ?`, []any{1.0}, false},
+		{"Equal postgres", postgresDialect, QueryFilter{Column: "id", Operator: Equal, Value: 1.0}, nil, `"id" = $1`, []any{1.0}, false},
+		{"Not equal mysql", mysqlDialect, QueryFilter{Column: "id", Operator: NotEqual, Value: "a"}, nil, "`id` <> ?", []any{"a"}, false},
+		{"Less than", postgresDialect, QueryFilter{Column: "n", Operator: LessThan, Value: 3.0}, nil, `"n" < $1`, []any{3.0}, false},
+		{"Greater than", sqliteDialect, QueryFilter{Column: "n", Operator: GreaterThan, Value: 3.0}, nil, `"n" > ?`, []any{3.0}, false},
+		{"Like", sqliteDialect, QueryFilter{Column: "name", Operator: Like, Value: "a%"}, nil, `"name" LIKE ?`, []any{"a%"}, false},
+		{"ILike postgres", postgresDialect, QueryFilter{Column: "name", Operator: ILike, Value: "a%"}, nil, `"name" ILIKE $1`, []any{"a%"}, false},
+		{"ILike mysql", mysqlDialect, QueryFilter{Column: "name", Operator: ILike, Value: "a%"}, nil, "LOWER(`name`) LIKE LOWER(?)", []any{"a%"}, false},
+		{"In postgres", postgresDialect, QueryFilter{Column: "id", Operator: In, Values: []any{1.0, 2.0}}, nil, `"id" IN ($1, $2)`, []any{1.0, 2.0}, false},
+		{"In without values", sqliteDialect, QueryFilter{Column: "id", Operator: In}, nil, "", nil, true},
+		{"Is null", mysqlDialect, QueryFilter{Column: "deleted_at", Operator: IsNull}, nil, "`deleted_at` IS NULL", nil, false},
+		{"Between postgres", postgresDialect, QueryFilter{Column: "n", Operator: Between, Values: []any{1.0, 5.0}}, nil, `"n" BETWEEN $1 AND $2`, []any{1.0, 5.0}, false},
+		{"Between with one value", postgresDialect, QueryFilter{Column: "n", Operator: Between, Values: []any{1.0}}, nil, "", nil, true},
+		{"Unknown operator", sqliteDialect, QueryFilter{Column: "n", Operator: "; DROP TABLE t"}, nil, "", nil, true},
+		{"Quoted identifier", postgresDialect, QueryFilter{Column: `we"ird`, Value: "a"}, nil, `"we""ird" = $1`, []any{"a"}, false},
+		{"Quoted identifier mysql", mysqlDialect, QueryFilter{Column: "we`ird", Value: "a"}, nil, "`we``ird` = ?", []any{"a"}, false},
+		{"Aliased column", postgresDialect, QueryFilter{Column: "name", Value: "a"}, []string{"datname AS name"}, `datname = $1`, []any{"a"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			condition, args, err := compileFilter(tc.dialect, tc.filter, tc.selected, nil)
+			if tc.fails {
+				r.Error(err)
+				return
+			}
+			r.NoError(err)
+			r.Equal(tc.condition, condition)
+			r.Equal(tc.args, args)
+		})
+	}
+}
+
+func TestCompileGroupNumbering(t *testing.T) {
+	r := require.New(t)
+	filters := []QueryFilter{
+		{Column: "a", Operator: In, Values: []any{1.0, 2.0}},
+		{Column: "b", Operator: Between, Values: []any{3.0, 4.0}},
+		{Column: "c", Value: "x"},
+	}
+	condition, args, err := compileGroup(postgresDialect, FilterGroup{Filters: filters}, nil, []any{"existing"})
+	r.NoError(err)
+	r.Equal(`"a" IN ($2, $3) AND "b" BETWEEN $4 AND $5 AND "c" = $6`, condition)
+	r.Len(args, 6)
+}
+
+func TestCompileGroup(t *testing.T) {
+	status := FilterGroup{Logic: Or, Filters: []QueryFilter{{Column: "status", Value: "open"}, {Column: "status", Value: "pending"}}}
+	testCases := []struct {
+		name      string
+		dialect   dialect
+		group     FilterGroup
+		condition string
+		args      []any
+		fails     bool
+	}{
+		{"Empty", sqliteDialect, FilterGroup{}, "", []any{}, false},
+		{"Or", sqliteDialect, status, `"status" = ? OR "status" = ?`, []any{"open", "pending"}, false},
+		{
+			"Nested or in and",
+			postgresDialect,
+			FilterGroup{Logic: And, Filters: []QueryFilter{{Column: "created_at", Operator: GreaterThan, Value: "2025-01-01"}}, Groups: []FilterGroup{status}},
+			`"created_at" > $1 AND ("status" = $2 OR "status" = $3)`,
+			[]any{"2025-01-01", "open", "pending"},
+			false,
+		},
+		{
+			"Deeply nested",
+			mysqlDialect,
+			FilterGroup{Logic: Or, Groups: []FilterGroup{{Filters: []QueryFilter{{Column: "a", Value: 1.0}, {Column: "b", Value: 2.0}}}, {Groups: []FilterGroup{status}}}},
+			"(`a` = ? AND `b` = ?) OR ((`status` = ? OR `status` = ?))",
+			[]any{1.0, 2.0, "open", "pending"},
+			false,
+		},
+		{"Empty subgroups are skipped", sqliteDialect, FilterGroup{Filters: []QueryFilter{{Column: "a", Value: 1.0}}, Groups: []FilterGroup{{}}}, `"a" = ?`, []any{1.0}, false},
+		{"Invalid logic", sqliteDialect, FilterGroup{Logic: "XOR", Filters: []QueryFilter{{Column: "a", Value: 1.0}}}, "", nil, true},
+		{"Invalid nested filter", sqliteDialect, FilterGroup{Groups: []FilterGroup{{Filters: []QueryFilter{{Column: "a", Operator: In}}}}}, "", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			condition, args, err := compileGroup(tc.dialect, tc.group, nil, make([]any, 0))
+			if tc.fails {
+				r.Error(err)
+				return
+			}
+			r.NoError(err)
+			r.Equal(tc.condition, condition)
+			r.Equal(tc.args, args)
+		})
+	}
+}
+
+func TestExecuteSelectQueryFilters(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO t (name) VALUES ('alice'), ('bob'), ('o''brien'), (NULL)")
+	r.NoError(err)
+
+	ctx := context.Background()
+	result, err := executeSelectQuery(ctx, db, sqliteDialect, "t", QueryParams{Limit: 10, Filter: []QueryFilter{{Column: "name", Operator: Like, Value: "%b%"}}}, tableInfo{}, Limits{})
+	r.NoError(err)
+	r.Len(result.Rows, 2)
+	r.Equal(2, result.Total, "Expected the total to take filters into account")
+
+	result, err = executeSelectQuery(ctx, db, sqliteDialect, "t", QueryParams{Limit: 10, Filter: []QueryFilter{{Column: "name", Value: "x' OR '1'='1"}}}, tableInfo{}, Limits{})
+	r.NoError(err)
+	r.Len(result.Rows, 0, "Values must not be spliced into the query")
+
+	result, err = executeSelectQuery(ctx, db, sqliteDialect, "t", QueryParams{Limit: 10, Filter: []QueryFilter{{Column: "name", Operator: IsNull}, {Column: "id", Operator: GreaterThan, Value: 1}}}, tableInfo{}, Limits{})
+	r.NoError(err)
+	r.Len(result.Rows, 1)
+
+	where := &FilterGroup{Logic: Or, Filters: []QueryFilter{{Column: "name", Value: "alice"}, {Column: "name", Value: "bob"}}}
+	result, err = executeSelectQuery(ctx, db, sqliteDialect, "t", QueryParams{Limit: 10, Filter: []QueryFilter{{Column: "id", Operator: GreaterThan, Value: 1}}, Where: where}, tableInfo{}, Limits{})
+	r.NoError(err)
+	r.Len(result.Rows, 1, "Expected the OR group to be ANDed with the flat filters")
+	r.Equal(1, result.Total)
+}
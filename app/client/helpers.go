@@ -1,12 +1,76 @@
 package client
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
 	"time"
 )
 
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// txBeginner is a querier transactions can be started on, a pool or a pinned
+// connection.
+type txBeginner interface {
+	querier
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// withCancel pins a connection for the duration of fn and, if ctx is cancelled
+// before fn returns, runs cancelQuery (formatted with the connection's backend
+// id) on another pooled connection so the server actually stops the statement.
+func withCancel(ctx context.Context, db *sql.DB, pidQuery string, cancelQuery string, fn func(*sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var pid int64
+	err = conn.QueryRowContext(ctx, pidQuery).Scan(&pid)
+	if err != nil {
+		return err
+	}
+
+	return watchCancel(ctx, db, cancelQuery, pid, func() error {
+		return fn(conn)
+	})
+}
+
+// watchCancel runs fn and, if ctx is cancelled before fn returns, runs
+// cancelQuery for the backend id on another pooled connection.
+func watchCancel(ctx context.Context, db *sql.DB, cancelQuery string, pid int64, fn func() error) error {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			db.ExecContext(context.Background(), fmt.Sprintf(cancelQuery, pid))
+		case <-done:
+		}
+	}()
+
+	err := fn()
+	close(done)
+	// NOTE: wait for the watcher before the connection goes back to the pool, we don't want to cancel someone else's query
+	<-stopped
+
+	return err
+}
+
+func (l Limits) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.StatementTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, l.StatementTimeout)
+}
+
 func fetchColumns(rows *sql.Rows) ([]ColumnMetadata, error) {
 	columns := make([]ColumnMetadata, 0)
 
@@ -22,7 +86,7 @@ func fetchColumns(rows *sql.Rows) ([]ColumnMetadata, error) {
 	return columns, nil
 }
 
-func fetchRows(rows *sql.Rows) (QueryResult, error) {
+func fetchRows(rows *sql.Rows, maxRows int) (QueryResult, error) {
 	columns, err := rows.Columns()
 	if err != nil {
 		return QueryResult{}, err
@@ -46,7 +110,13 @@ func fetchRows(rows *sql.Rows) (QueryResult, error) {
 	}
 
 	results := make([]Row, 0)
+	truncated := false
 	for rows.Next() {
+		if maxRows > 0 && len(results) == maxRows {
+			truncated = true
+			break
+		}
+
 		values := make([]any, len(columns))
 		valuePtrs := make([]any, len(columns))
 		for i := range columns {
@@ -59,61 +129,76 @@ func fetchRows(rows *sql.Rows) (QueryResult, error) {
 
 		row := make(Row)
 		for i, col := range columns {
+			// NOTE: NULL stays nil, a JSON null, to be told apart from the text 'NULL'
 			value := values[i]
-			switch v := value.(type) {
-			case nil:
-				value = "NULL"
-			case []byte:
-				value = string(v)
-			default:
-				value = v
+			if b, ok := value.([]byte); ok {
+				value = string(b)
 			}
 			row[col] = value
 		}
 		results = append(results, row)
 	}
+	if err := rows.Err(); err != nil {
+		return QueryResult{}, err
+	}
 
 	return QueryResult{
-		Rows:    results,
-		Columns: columnsMetadata,
-		Total:   len(results),
+		Rows:      results,
+		Columns:   columnsMetadata,
+		Total:     len(results),
+		Truncated: truncated,
 	}, nil
 }
 
-func executeQuery(db *sql.DB, query string) (QueryResult, error) {
+func executeQuery(ctx context.Context, db querier, d dialect, query string, limits Limits, args ...any) (QueryResult, error) {
+	ctx, cancel := limits.withTimeout(ctx)
+	defer cancel()
+
 	result := QueryResult{Query: query}
 	result.Rows = make([]Row, 0)
 	result.Columns = make([]ColumnMetadata, 0)
 
-	lower := strings.ToLower(query)
-	// FIXME: rewrite to avoid issues with columns named 'created_at' etc !!
-	isReturning := strings.Contains(lower, "returning ")
-	isMutate := strings.Contains(lower, "insert ") || strings.Contains(lower, "update ") || strings.Contains(lower, "delete ") || strings.Contains(lower, "upsert ") || strings.Contains(lower, "create ") || strings.Contains(lower, "alter ") || strings.Contains(lower, "truncate ") || strings.Contains(lower, "drop ")
-
-	if isMutate && !isReturning {
+	info := classifyStatement(d, query)
+	if !info.returnsRows() {
 		start := time.Now()
-		_, err := db.Exec(query)
+		res, err := db.ExecContext(ctx, query, args...)
 		duration := time.Since(start).String()
 		if err != nil {
 			return result, err
 		}
 
 		result.Duration = duration
+		// NOTE: not every statement reports affected rows (e.g. DDL), that's not an error
+		result.RowsAffected, _ = res.RowsAffected()
+		if info.Keyword == "INSERT" || info.Keyword == "REPLACE" {
+			lastInsertID, err := res.LastInsertId()
+			if err == nil {
+				result.LastInsertID = &lastInsertID
+			}
+		}
 
 		return result, nil
 	} else {
 		start := time.Now()
-		rows, err := db.Query(query)
+		rows, err := db.QueryContext(ctx, query, args...)
 		duration := time.Since(start).String()
 		if err != nil {
 			return result, err
 		}
 		defer rows.Close()
 
-		result, err = fetchRows(rows)
+		result, err = fetchRows(rows, limits.MaxRows)
 		if err != nil {
 			return result, err
 		}
+		if result.Truncated {
+			// NOTE: don't let the driver drain the rows we won't read
+			cancel()
+		}
+		if info.Kind == WriteStatement {
+			// NOTE: INSERT/UPDATE/DELETE ... RETURNING returns one row per affected row
+			result.RowsAffected = int64(len(result.Rows))
+		}
 
 		result.Query = query + ";"
 		result.Duration = duration
@@ -122,48 +207,166 @@ func executeQuery(db *sql.DB, query string) (QueryResult, error) {
 	}
 }
 
-func executeSelectQuery(db *sql.DB, query string, params QueryParams) (QueryResult, error) {
+// tableInfo identifies the table a select query reads from, primaryKey is
+// only needed for keyset pagination.
+type tableInfo struct {
+	schema     string
+	name       string
+	primaryKey []string
+}
+
+func primaryKeyColumns(columns []ColumnMetadata) []string {
+	primaryKey := make([]string, 0)
+	for _, col := range columns {
+		if col.PrimaryKey {
+			primaryKey = append(primaryKey, col.Name)
+		}
+	}
+	return primaryKey
+}
+
+// keysetClause returns the condition seeking past the cursor and the
+// matching ORDER BY, the condition being empty for the first page.
+func keysetClause(d dialect, cursor QueryCursor, primaryKey []string, args []any) (string, string, []any, error) {
+	if len(primaryKey) == 0 {
+		return "", "", args, fmt.Errorf("keyset pagination needs a primary key")
+	}
+	if len(cursor.After) > 0 && len(cursor.After) != len(primaryKey) {
+		return "", "", args, fmt.Errorf("cursor has %d values for a primary key of %d columns", len(cursor.After), len(primaryKey))
+	}
+
+	direction := Ascending
+	comparison := ">"
+	if cursor.Direction == Descending {
+		direction = Descending
+		comparison = "<"
+	}
+
+	columns := make([]string, 0)
+	orders := make([]string, 0)
+	for _, col := range primaryKey {
+		columns = append(columns, d.quoteIdentifier(col))
+		orders = append(orders, d.quoteIdentifier(col)+" "+string(direction))
+	}
+	order := strings.Join(orders, ", ")
+
+	if len(cursor.After) == 0 {
+		return "", order, args, nil
+	}
+
+	placeholders := make([]string, 0)
+	for _, value := range cursor.After {
+		args = append(args, value)
+		placeholders = append(placeholders, d.placeholder(len(args)))
+	}
+	condition := fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), comparison, strings.Join(placeholders, ", "))
+
+	return condition, order, args, nil
+}
+
+// estimateCount reads the row count from the table statistics, ok is false
+// when there are none (never analyzed, view, ...).
+func estimateCount(ctx context.Context, db querier, d dialect, table tableInfo) (int, bool) {
+	var count sql.NullInt64
+	err := db.QueryRowContext(ctx, d.estimateCountQuery(), table.schema, table.name).Scan(&count)
+	if err != nil || !count.Valid || count.Int64 < 0 {
+		return 0, false
+	}
+	return int(count.Int64), true
+}
+
+func executeSelectQuery(ctx context.Context, db querier, d dialect, query string, params QueryParams, table tableInfo, limits Limits) (QueryResult, error) {
+	ctx, cancel := limits.withTimeout(ctx)
+	defer cancel()
+
 	columns := "*"
 	if len(params.Columns) > 0 {
 		columns = strings.Join(params.Columns, ", ")
 	}
 	execQuery := fmt.Sprintf("SELECT %s FROM %s", columns, query)
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", query)
+
+	filter := FilterGroup{Logic: And, Filters: params.Filter}
+	if params.Where != nil {
+		filter.Groups = []FilterGroup{*params.Where}
+	}
+	where, args, err := compileGroup(d, filter, params.Columns, make([]any, 0))
+	if err != nil {
+		return QueryResult{}, err
+	}
+	// NOTE: the count ignores the cursor, its arguments come after the filter ones
+	countArgs := args
 
-	if len(params.Filter) > 0 {
-		if !strings.Contains(execQuery, "WHERE") {
-			execQuery += " WHERE"
-		} else {
-			execQuery += " AND"
+	keyset := ""
+	order := ""
+	if params.Cursor != nil {
+		if len(params.Order) > 0 {
+			return QueryResult{}, fmt.Errorf("keyset pagination only supports ordering by the primary key")
+		}
+		keyset, order, args, err = keysetClause(d, *params.Cursor, table.primaryKey, args)
+		if err != nil {
+			return QueryResult{}, err
 		}
-		execQuery += " ("
+	} else if len(params.Order) > 0 {
+		orders := make([]string, 0)
+		for _, o := range params.Order {
+			orders = append(orders, columnExpression(d, o.Column, params.Columns)+" "+string(o.Direction))
+		}
+		order = strings.Join(orders, ", ")
+	}
 
-		filters := make([]string, 0)
-		for _, filter := range params.Filter {
-			operator := "="
-			if strings.HasPrefix(filter.Value, "'") {
-				operator = "LIKE"
-			}
-			filters = append(filters, filter.Column+" "+operator+" "+filter.Value)
+	conjunction := " WHERE "
+	if strings.Contains(query, "WHERE") {
+		conjunction = " AND "
+	}
+	if where != "" {
+		countQuery += conjunction + "(" + where + ")"
+	}
+	for _, condition := range []string{where, keyset} {
+		if condition == "" {
+			continue
 		}
-		execQuery += strings.Join(filters, " AND ")
+		execQuery += conjunction + "(" + condition + ")"
+		conjunction = " AND "
+	}
 
-		execQuery += ")"
+	if order != "" {
+		execQuery += " ORDER BY " + order
 	}
 
-	if len(params.Order) > 0 {
-		execQuery += " ORDER BY "
-		orders := make([]string, 0)
-		for _, order := range params.Order {
-			orders = append(orders, order.Column+" "+string(order.Direction))
-		}
-		execQuery += strings.Join(orders, ", ")
+	if params.Cursor != nil {
+		execQuery += fmt.Sprintf(" LIMIT %d", params.Limit)
+	} else {
+		execQuery += fmt.Sprintf(" LIMIT %d OFFSET %d", params.Limit, params.Offset)
 	}
 
-	execQuery += fmt.Sprintf(" LIMIT %d OFFSET %d", params.Limit, params.Offset)
+	result, err := executeQuery(ctx, db, d, execQuery, limits, args...)
+	if err != nil {
+		return result, err
+	}
+
+	if params.Cursor != nil && len(result.Rows) > 0 {
+		last := result.Rows[len(result.Rows)-1]
+		result.Cursor = make([]any, 0)
+		for _, col := range table.primaryKey {
+			value, exists := last[col]
+			if !exists {
+				// NOTE: primary key not selected, the caller can't go on from here
+				result.Cursor = nil
+				break
+			}
+			result.Cursor = append(result.Cursor, value)
+		}
+	}
 
-	result, err := executeQuery(db, execQuery)
+	if params.EstimateCount && where == "" && table.name != "" {
+		result.Total, result.Estimated = estimateCount(ctx, db, d, table)
+		if result.Estimated {
+			return result, nil
+		}
+	}
 
-	countRow := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", query))
+	countRow := db.QueryRowContext(ctx, countQuery, countArgs...)
 	err = countRow.Scan(&result.Total)
 	if err != nil {
 		return result, err
@@ -172,11 +375,14 @@ func executeSelectQuery(db *sql.DB, query string, params QueryParams) (QueryResu
 	return result, nil
 }
 
-func execute(db *sql.DB, query string) error {
-	_, err := db.Exec(query)
+func execute(ctx context.Context, db querier, query string, limits Limits) error {
+	ctx, cancel := limits.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, query)
 	if err != nil {
 		if strings.Contains(query, "BEGIN;") || strings.Contains(query, "BEGIN TRANSACTION;") {
-			db.Exec("ROLLBACK;")
+			db.ExecContext(context.Background(), "ROLLBACK;")
 		}
 		return err
 	}
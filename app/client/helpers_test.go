@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestExecuteQueryMutation(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	_, err = executeQuery(ctx, db, sqliteDialect, "CREATE TABLE t (id INTEGER PRIMARY KEY, updated_at TEXT)", Limits{})
+	r.NoError(err)
+
+	result, err := executeQuery(ctx, db, sqliteDialect, "INSERT INTO t (updated_at) VALUES ('a'), ('b'), ('c')", Limits{})
+	r.NoError(err)
+	r.Equal(int64(3), result.RowsAffected)
+	r.NotNil(result.LastInsertID)
+	r.Equal(int64(3), *result.LastInsertID)
+
+	result, err = executeQuery(ctx, db, sqliteDialect, "UPDATE t SET updated_at = 'z' WHERE id > 1", Limits{})
+	r.NoError(err)
+	r.Equal(int64(2), result.RowsAffected)
+	r.Nil(result.LastInsertID, "Only inserts report a last insert ID")
+
+	result, err = executeQuery(ctx, db, sqliteDialect, "DELETE FROM t WHERE id = 1 RETURNING id", Limits{})
+	r.NoError(err)
+	r.Len(result.Rows, 1)
+	r.Equal(int64(1), result.RowsAffected)
+
+	result, err = executeQuery(ctx, db, sqliteDialect, "SELECT * FROM t", Limits{})
+	r.NoError(err)
+	r.Len(result.Rows, 2)
+	r.Equal(int64(0), result.RowsAffected)
+}
+
+func TestExecuteSelectQueryKeyset(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE t (a INTEGER, b TEXT, name TEXT, PRIMARY KEY (a, b)); INSERT INTO t VALUES (1, 'x', 'a'), (1, 'y', 'b'), (2, 'x', 'c'), (3, 'x', 'd'), (3, 'y', 'e'); CREATE TABLE n (name TEXT)")
+	r.NoError(err)
+
+	ctx := context.Background()
+	c := &SqliteClient{Db: db}
+	names := make([]any, 0)
+	params := QueryParams{Limit: 2, Cursor: &QueryCursor{}}
+	for range 4 {
+		result, err := c.GetTableRows(ctx, params, "main", "t")
+		r.NoError(err)
+		r.Equal(5, result.Total)
+		if len(result.Rows) == 0 {
+			r.Nil(result.Cursor)
+			break
+		}
+		for _, row := range result.Rows {
+			names = append(names, row["name"])
+		}
+		r.Len(result.Cursor, 2)
+		params.Cursor.After = result.Cursor
+	}
+	r.Equal([]any{"a", "b", "c", "d", "e"}, names)
+
+	result, err := c.GetTableRows(ctx, QueryParams{Limit: 2, Cursor: &QueryCursor{After: []any{3, "x"}, Direction: Descending}}, "main", "t")
+	r.NoError(err)
+	r.Len(result.Rows, 2)
+	r.Equal("c", result.Rows[0]["name"])
+	r.Equal("b", result.Rows[1]["name"])
+
+	_, err = c.GetTableRows(ctx, QueryParams{Limit: 2, Cursor: &QueryCursor{After: []any{1}}}, "main", "t")
+	r.Error(err, "Expected a cursor matching the primary key")
+
+	_, err = c.GetTableRows(ctx, QueryParams{Limit: 2, Cursor: &QueryCursor{}}, "main", "n")
+	r.Error(err, "Expected keyset pagination to need a primary key")
+
+	_, err = c.GetTableRows(ctx, QueryParams{Limit: 2, Cursor: &QueryCursor{}, Order: []QueryOrder{{Column: "name", Direction: Ascending}}}, "main", "t")
+	r.Error(err, "Expected keyset pagination to refuse another order")
+}
+
+func TestExecuteSelectQueryEstimateCount(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT); CREATE INDEX t_name ON t (name); INSERT INTO t (name) VALUES ('a'), ('b'), ('c')")
+	r.NoError(err)
+
+	ctx := context.Background()
+	c := &SqliteClient{Db: db}
+	result, err := c.GetTableRows(ctx, QueryParams{Limit: 1, EstimateCount: true}, "main", "t")
+	r.NoError(err)
+	r.False(result.Estimated, "Expected an exact count without statistics")
+	r.Equal(3, result.Total)
+
+	_, err = db.Exec("ANALYZE; INSERT INTO t (name) VALUES ('d')")
+	r.NoError(err)
+
+	result, err = c.GetTableRows(ctx, QueryParams{Limit: 1, EstimateCount: true}, "main", "t")
+	r.NoError(err)
+	r.True(result.Estimated)
+	r.Equal(3, result.Total, "Expected the count from the statistics")
+
+	result, err = c.GetTableRows(ctx, QueryParams{Limit: 1, EstimateCount: true, Filter: []QueryFilter{{Column: "name", Value: "a"}}}, "main", "t")
+	r.NoError(err)
+	r.False(result.Estimated, "Expected filtered counts to be exact")
+	r.Equal(1, result.Total)
+}
+
+func TestExecuteQueryNull(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	_, err = db.Exec("CREATE TABLE t (name TEXT); INSERT INTO t VALUES (NULL), ('NULL')")
+	r.NoError(err)
+
+	result, err := executeQuery(ctx, db, sqliteDialect, "SELECT name FROM t ORDER BY rowid", Limits{})
+	r.NoError(err)
+	r.Equal([]Row{{"name": nil}, {"name": "NULL"}}, result.Rows, "Expected NULL apart from the text 'NULL'")
+
+	counts, err := DeleteRows(ctx, &SqliteClient{Db: db}, "main", "t", []Row{result.Rows[0]})
+	r.NoError(err)
+	r.Equal([]int64{1}, counts)
+	result, err = executeQuery(ctx, db, sqliteDialect, "SELECT name FROM t", Limits{})
+	r.NoError(err)
+	r.Equal([]Row{{"name": "NULL"}}, result.Rows, "Expected only the NULL row to be deleted")
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+)
+
+const importChunkSize = 64 * 1024
+
+type ImportOptions struct {
+	// Transaction runs the whole import in one transaction, the transaction
+	// control statements of the script being skipped.
+	Transaction bool `json:"transaction"`
+}
+
+type ImportProgress struct {
+	BytesRead  int64 `json:"bytes_read"`
+	Statements int   `json:"statements"`
+	Rows       int   `json:"rows"` // for CSV imports
+}
+
+// ImportError locates the statement an import failed on.
+type ImportError struct {
+	Line      int
+	Statement string
+	Err       error
+}
+
+func (e *ImportError) Error() string {
+	statement := e.Statement
+	if len(statement) > 200 {
+		statement = statement[:200] + "..."
+	}
+	return fmt.Sprintf("line %d: %v\n%s", e.Line, e.Err, statement)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// importScript reads the script in chunks and executes its statements as soon
+// as they are complete, so the size of the script doesn't matter.
+func importScript(ctx context.Context, conn *sql.Conn, d dialect, r io.Reader, options ImportOptions, onProgress func(ImportProgress)) (err error) {
+	var db querier = conn
+	if options.Transaction {
+		tx, beginErr := conn.BeginTx(ctx, nil)
+		if beginErr != nil {
+			return beginErr
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+			err = tx.Commit()
+		}()
+		db = tx
+	}
+
+	progress := ImportProgress{}
+	inTransaction := false
+	defer func() {
+		// NOTE: don't leave a transaction opened by the script behind
+		if err != nil && inTransaction {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+		}
+	}()
+
+	execute := func(statements []scriptStatement) error {
+		for _, statement := range statements {
+			// NOTE: sqlite only interrupts a running statement, stop between them too
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			info := classifyStatement(d, statement.Query)
+			if info.Kind == TransactionStatement && options.Transaction {
+				continue
+			}
+			_, err := db.ExecContext(ctx, statement.Query)
+			if err != nil {
+				return &ImportError{Line: statement.Line, Statement: statement.Query, Err: err}
+			}
+			if info.Kind == TransactionStatement {
+				inTransaction = opensTransaction(d, statement.Query, inTransaction)
+			}
+			progress.Statements++
+			if onProgress != nil {
+				onProgress(progress)
+			}
+		}
+		return nil
+	}
+
+	s := newSplitter(d)
+	chunk := make([]byte, importChunkSize)
+	for {
+		n, readErr := r.Read(chunk)
+		progress.BytesRead += int64(n)
+		if n > 0 {
+			err = execute(s.feed(string(chunk[:n])))
+			if err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	return execute(s.end())
+}
@@ -0,0 +1,510 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+type CSVType string
+
+const (
+	CSVInteger   CSVType = "integer"
+	CSVFloat     CSVType = "float"
+	CSVBoolean   CSVType = "boolean"
+	CSVDate      CSVType = "date"
+	CSVTimestamp CSVType = "timestamp"
+	CSVText      CSVType = "text"
+)
+
+var CSVTypes = []struct {
+	Value  CSVType
+	TSName string
+}{
+	{CSVInteger, "Integer"},
+	{CSVFloat, "Float"},
+	{CSVBoolean, "Boolean"},
+	{CSVDate, "Date"},
+	{CSVTimestamp, "Timestamp"},
+	{CSVText, "Text"},
+}
+
+// CSVColumn maps a column of the file to a column of the table, an empty
+// Target skips it.
+type CSVColumn struct {
+	Name   string  `json:"name"`
+	Target string  `json:"target"`
+	Type   CSVType `json:"type"`
+}
+
+type CSVImportOptions struct {
+	Schema      string      `json:"schema"`
+	Table       string      `json:"table"`
+	Delimiter   string      `json:"delimiter"` // defaults to a comma
+	Header      bool        `json:"header"`    // the first line holds the column names
+	Null        string      `json:"null"`      // fields read as NULL
+	Columns     []CSVColumn `json:"columns"`   // in file order, from the preview
+	CreateTable bool        `json:"create_table"`
+	BatchSize   int         `json:"batch_size"` // defaults to 1000
+}
+
+type CSVPreview struct {
+	Columns      []CSVColumn      `json:"columns"`
+	Rows         [][]string       `json:"rows"`
+	TableColumns []ColumnMetadata `json:"table_columns"` // empty when the table doesn't exist yet
+}
+
+const (
+	csvPreviewRows      = 10
+	defaultCSVBatchSize = 1000
+)
+
+func newCSVReader(r io.Reader, options CSVImportOptions) (*csv.Reader, error) {
+	delimiter := options.Delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+	comma, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) {
+		return nil, fmt.Errorf("invalid CSV delimiter: %q", delimiter)
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.ReuseRecord = true
+	return reader, nil
+}
+
+// previewCSV reads the whole file once to infer the type of every column,
+// and proposes a mapping to the columns of the table when it exists.
+func previewCSV(r io.Reader, options CSVImportOptions, tableColumns []ColumnMetadata) (CSVPreview, error) {
+	preview := CSVPreview{Rows: make([][]string, 0), TableColumns: tableColumns}
+	reader, err := newCSVReader(r, options)
+	if err != nil {
+		return preview, err
+	}
+
+	types := make([]CSVType, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return preview, err
+		}
+
+		if preview.Columns == nil {
+			preview.Columns = make([]CSVColumn, len(record))
+			types = make([]CSVType, len(record))
+			for i := range record {
+				preview.Columns[i].Name = fmt.Sprintf("column_%d", i+1)
+				if options.Header {
+					preview.Columns[i].Name = record[i]
+				}
+			}
+			if options.Header {
+				continue
+			}
+		}
+
+		if len(preview.Rows) < csvPreviewRows {
+			preview.Rows = append(preview.Rows, append([]string{}, record...))
+		}
+		for i, value := range record {
+			if value != options.Null {
+				types[i] = inferCSVType(types[i], value)
+			}
+		}
+	}
+
+	for i, col := range preview.Columns {
+		preview.Columns[i].Type = types[i]
+		if types[i] == "" {
+			preview.Columns[i].Type = CSVText
+		}
+		if len(tableColumns) == 0 {
+			preview.Columns[i].Target = col.Name
+			continue
+		}
+		for _, tableColumn := range tableColumns {
+			if strings.EqualFold(tableColumn.Name, col.Name) {
+				preview.Columns[i].Target = tableColumn.Name
+				break
+			}
+		}
+	}
+
+	return preview, nil
+}
+
+// inferCSVType widens the type inferred so far so it also fits the value.
+func inferCSVType(current CSVType, value string) CSVType {
+	if current == CSVText {
+		return CSVText
+	}
+
+	var t CSVType
+	switch {
+	case hasLeadingZero(value):
+		// NOTE: leading zeros are significant (zip codes, ...), keep them as text
+		return CSVText
+	case isCSVInteger(value):
+		t = CSVInteger
+	case isCSVFloat(value):
+		t = CSVFloat
+	case strings.EqualFold(value, "true") || strings.EqualFold(value, "false"):
+		t = CSVBoolean
+	case isCSVTime(value, time.DateOnly):
+		t = CSVDate
+	case isCSVTime(value, time.DateTime) || isCSVTime(value, time.RFC3339Nano):
+		t = CSVTimestamp
+	default:
+		return CSVText
+	}
+
+	switch {
+	case current == "" || current == t:
+		return t
+	case (current == CSVInteger && t == CSVFloat) || (current == CSVFloat && t == CSVInteger):
+		return CSVFloat
+	case (current == CSVDate && t == CSVTimestamp) || (current == CSVTimestamp && t == CSVDate):
+		return CSVTimestamp
+	}
+	return CSVText
+}
+
+func hasLeadingZero(value string) bool {
+	digits := strings.TrimPrefix(value, "-")
+	return len(digits) > 1 && digits[0] == '0' && digits[1] != '.'
+}
+
+func isCSVInteger(value string) bool {
+	_, err := strconv.ParseInt(value, 10, 64)
+	return err == nil
+}
+
+func isCSVFloat(value string) bool {
+	if value == "" || !(value[0] == '-' || value[0] == '.' || (value[0] >= '0' && value[0] <= '9')) {
+		// NOTE: ParseFloat also reads "NaN", "Inf", ...
+		return false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+func isCSVTime(value string, layout string) bool {
+	_, err := time.Parse(layout, value)
+	return err == nil
+}
+
+func (t CSVType) columnType(d dialect) string {
+	switch t {
+	case CSVInteger:
+		if d == sqliteDialect {
+			return "INTEGER"
+		}
+		return "BIGINT"
+	case CSVFloat:
+		switch d {
+		case postgresDialect:
+			return "DOUBLE PRECISION"
+		case mysqlDialect:
+			return "DOUBLE"
+		}
+		return "REAL"
+	case CSVBoolean:
+		return "BOOLEAN"
+	case CSVDate:
+		return "DATE"
+	case CSVTimestamp:
+		if d == postgresDialect {
+			return "TIMESTAMP"
+		}
+		return "DATETIME"
+	}
+	return "TEXT"
+}
+
+// convert turns a field into the value bound for its column, dates being
+// left as text which every database parses.
+func (t CSVType) convert(value string) (any, error) {
+	switch t {
+	case CSVInteger:
+		return strconv.ParseInt(value, 10, 64)
+	case CSVFloat:
+		return strconv.ParseFloat(value, 64)
+	case CSVBoolean:
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+// bulkInserter loads batches of rows with the fastest path of its dialect.
+type bulkInserter interface {
+	insert(ctx context.Context, rows [][]any) error
+	close() error
+}
+
+func newBulkInserter(ctx context.Context, tx *sql.Tx, d dialect, schema string, table string, columns []string) (bulkInserter, error) {
+	switch d {
+	case postgresDialect:
+		return &copyInserter{tx: tx, schema: schema, table: table, columns: columns}, nil
+	case mysqlDialect:
+		return &valuesInserter{tx: tx, dialect: d, schema: schema, table: table, columns: columns}, nil
+	default:
+		quoted := make([]string, 0)
+		placeholders := make([]string, 0)
+		for i, col := range columns {
+			quoted = append(quoted, d.quoteIdentifier(col))
+			placeholders = append(placeholders, d.placeholder(i+1))
+		}
+		stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)", d.quoteIdentifier(schema), d.quoteIdentifier(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", ")))
+		if err != nil {
+			return nil, err
+		}
+		return &preparedInserter{stmt: stmt}, nil
+	}
+}
+
+// copyInserter streams each batch through COPY FROM STDIN.
+type copyInserter struct {
+	tx      *sql.Tx
+	schema  string
+	table   string
+	columns []string
+}
+
+func (c *copyInserter) insert(ctx context.Context, rows [][]any) error {
+	stmt, err := c.tx.PrepareContext(ctx, pq.CopyInSchema(c.schema, c.table, c.columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		_, err := stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+func (c *copyInserter) close() error {
+	return nil
+}
+
+// valuesInserter sends each batch as one multi-row INSERT.
+type valuesInserter struct {
+	tx      *sql.Tx
+	dialect dialect
+	schema  string
+	table   string
+	columns []string
+}
+
+func (v *valuesInserter) insert(ctx context.Context, rows [][]any) error {
+	quoted := make([]string, 0)
+	for _, col := range v.columns {
+		quoted = append(quoted, v.dialect.quoteIdentifier(col))
+	}
+
+	values := make([]string, 0)
+	args := make([]any, 0)
+	for _, row := range rows {
+		placeholders := make([]string, 0)
+		for _, value := range row {
+			args = append(args, value)
+			placeholders = append(placeholders, v.dialect.placeholder(len(args)))
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES %s", v.dialect.quoteIdentifier(v.schema), v.dialect.quoteIdentifier(v.table), strings.Join(quoted, ", "), strings.Join(values, ", "))
+	_, err := v.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (v *valuesInserter) close() error {
+	return nil
+}
+
+// preparedInserter executes one prepared INSERT per row, which is as fast as
+// it gets with sqlite inside a transaction.
+type preparedInserter struct {
+	stmt *sql.Stmt
+}
+
+func (p *preparedInserter) insert(ctx context.Context, rows [][]any) error {
+	for _, row := range rows {
+		_, err := p.stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *preparedInserter) close() error {
+	return p.stmt.Close()
+}
+
+// countingReader counts the bytes read through it for progress reports.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// importCSV loads the file into the table in one transaction, creating the
+// table first if asked to. tableColumns are the columns of the existing table.
+func importCSV(ctx context.Context, db txBeginner, d dialect, r io.Reader, options CSVImportOptions, tableColumns []ColumnMetadata, onProgress func(ImportProgress)) (err error) {
+	if len(options.Columns) == 0 {
+		return fmt.Errorf("no CSV columns to import")
+	}
+	targets := make([]string, 0)
+	for _, col := range options.Columns {
+		if col.Target == "" {
+			continue
+		}
+		if !options.CreateTable && !columnExists(tableColumns, col.Target) {
+			return fmt.Errorf("unknown column %s in %s.%s", col.Target, options.Schema, options.Table)
+		}
+		targets = append(targets, col.Target)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no CSV column mapped to a table column")
+	}
+
+	counter := &countingReader{r: r}
+	reader, err := newCSVReader(counter, options)
+	if err != nil {
+		return err
+	}
+	reader.FieldsPerRecord = len(options.Columns)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if options.CreateTable {
+		definitions := make([]string, 0)
+		for _, col := range options.Columns {
+			if col.Target != "" {
+				definitions = append(definitions, d.quoteIdentifier(col.Target)+" "+col.Type.columnType(d))
+			}
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s.%s (%s)", d.quoteIdentifier(options.Schema), d.quoteIdentifier(options.Table), strings.Join(definitions, ", ")))
+		if err != nil {
+			return err
+		}
+	}
+
+	inserter, err := newBulkInserter(ctx, tx, d, options.Schema, options.Table, targets)
+	if err != nil {
+		return err
+	}
+	defer inserter.close()
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCSVBatchSize
+	}
+	if d == mysqlDialect {
+		// NOTE: mysql allows 65535 placeholders per statement
+		batchSize = min(batchSize, 65535/len(targets))
+	}
+
+	progress := ImportProgress{}
+	batch := make([][]any, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := inserter.insert(ctx, batch)
+		if err != nil {
+			return err
+		}
+		progress.Rows += len(batch)
+		progress.BytesRead = counter.n
+		if onProgress != nil {
+			onProgress(progress)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	header := options.Header
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header {
+			header = false
+			continue
+		}
+
+		row := make([]any, 0, len(targets))
+		for i, col := range options.Columns {
+			if col.Target == "" {
+				continue
+			}
+			if record[i] == options.Null {
+				row = append(row, nil)
+				continue
+			}
+			value, err := col.Type.convert(record[i])
+			if err != nil {
+				line, _ := reader.FieldPos(i)
+				return fmt.Errorf("line %d, column %s: %w", line, col.Name, err)
+			}
+			row = append(row, value)
+		}
+
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
+
+func columnExists(columns []ColumnMetadata, name string) bool {
+	for _, col := range columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
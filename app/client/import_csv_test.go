@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestInferCSVType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   []string
+		expected CSVType
+	}{
+		{"Integers", []string{"1", "-2", "0"}, CSVInteger},
+		{"Leading zeros", []string{"1", "007"}, CSVText},
+		{"Integers and floats", []string{"1", "2.5", "-.5"}, CSVFloat},
+		{"Not a number", []string{"1", "NaN"}, CSVText},
+		{"Booleans", []string{"true", "FALSE"}, CSVBoolean},
+		{"Dates", []string{"2024-01-02"}, CSVDate},
+		{"Dates and timestamps", []string{"2024-01-02", "2024-01-02 03:04:05", "2024-01-02T03:04:05Z"}, CSVTimestamp},
+		{"Mixed", []string{"1", "true"}, CSVText},
+		{"Text stays text", []string{"a", "1"}, CSVText},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			var inferred CSVType
+			for _, value := range tc.values {
+				inferred = inferCSVType(inferred, value)
+			}
+			r.Equal(tc.expected, inferred)
+		})
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	c := &SqliteClient{Db: db}
+	file := "id;Name;score;active;ignored\n1;alice;1.5;true;x\n2;\"b;ob\";;false;y\n3;carol;2;true;z\n"
+	options := CSVImportOptions{Schema: "main", Table: "people", Delimiter: ";", Header: true, BatchSize: 2}
+
+	preview, err := c.PreviewCSV(ctx, strings.NewReader(file), options)
+	r.NoError(err)
+	r.Equal([]CSVColumn{
+		{Name: "id", Target: "id", Type: CSVInteger},
+		{Name: "Name", Target: "Name", Type: CSVText},
+		{Name: "score", Target: "score", Type: CSVFloat},
+		{Name: "active", Target: "active", Type: CSVBoolean},
+		{Name: "ignored", Target: "ignored", Type: CSVText},
+	}, preview.Columns)
+	r.Len(preview.Rows, 3)
+	r.Empty(preview.TableColumns)
+
+	options.Columns = preview.Columns
+	options.Columns[4].Target = ""
+	options.CreateTable = true
+	rows := 0
+	err = c.ImportCSV(ctx, strings.NewReader(file), options, func(p ImportProgress) {
+		rows = p.Rows
+	})
+	r.NoError(err)
+	r.Equal(3, rows)
+
+	var name string
+	var score sql.NullFloat64
+	err = db.QueryRow(`SELECT "Name", score FROM people WHERE id = 2`).Scan(&name, &score)
+	r.NoError(err)
+	r.Equal("b;ob", name)
+	r.False(score.Valid, "Expected empty fields to be NULL")
+
+	preview, err = c.PreviewCSV(ctx, strings.NewReader(file), options)
+	r.NoError(err)
+	r.Len(preview.TableColumns, 4)
+	r.Equal("Name", preview.Columns[1].Target)
+	r.Empty(preview.Columns[4].Target, "Expected columns missing from the table to be skipped")
+
+	options.CreateTable = false
+	options.Columns = preview.Columns
+	err = c.ImportCSV(ctx, strings.NewReader(file+"4;dave;oops;true;w\n"), options, nil)
+	r.ErrorContains(err, "line 5")
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count)
+	r.NoError(err)
+	r.Equal(3, count, "Expected a failed import to be rolled back")
+
+	options.Columns[0].Target = "missing"
+	err = c.ImportCSV(ctx, strings.NewReader(file), options, nil)
+	r.Error(err, "Expected unknown target columns to be refused")
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestImportScript(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	c := &SqliteClient{Db: db}
+	count := func() int {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM t").Scan(&count)
+		r.NoError(err)
+		return count
+	}
+
+	script := "CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT NOT NULL);\n-- data\nINSERT INTO t (name) VALUES ('a;b');\nINSERT INTO t (name) VALUES ('c');\n"
+	progress := make([]ImportProgress, 0)
+	err = c.Import(ctx, iotest.OneByteReader(strings.NewReader(script)), ImportOptions{}, func(p ImportProgress) {
+		progress = append(progress, p)
+	})
+	r.NoError(err)
+	r.Equal(2, count())
+	r.Len(progress, 3, "Expected an event per statement")
+	r.Equal(3, progress[2].Statements)
+	r.Equal(int64(len(script)), progress[2].BytesRead)
+
+	err = c.Import(ctx, strings.NewReader("INSERT INTO t (name) VALUES ('d');\n\nINSERT INTO t (name) VALUES (NULL);"), ImportOptions{Transaction: true}, nil)
+	var importErr *ImportError
+	r.True(errors.As(err, &importErr), "Expected the failing statement to be reported")
+	r.Equal(3, importErr.Line)
+	r.Equal("INSERT INTO t (name) VALUES (NULL)", importErr.Statement)
+	r.Equal(2, count(), "Expected the import transaction to be rolled back")
+
+	err = c.Import(ctx, strings.NewReader("BEGIN;\nINSERT INTO t (name) VALUES ('d');\nCOMMIT;"), ImportOptions{Transaction: true}, nil)
+	r.NoError(err, "Expected the script transaction statements to be skipped")
+	r.Equal(3, count())
+
+	err = c.Import(ctx, strings.NewReader("BEGIN;\nINSERT INTO t (name) VALUES ('e');\nINSERT INTO t (name) VALUES (NULL);\nCOMMIT;"), ImportOptions{}, nil)
+	r.Error(err)
+	r.Equal(3, count(), "Expected the script transaction to be rolled back")
+}
@@ -0,0 +1,334 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// IndexMetadata describes an index, expression parts show up as "(expression)"
+// in Columns when the database can't name them.
+type IndexMetadata struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+	Method  string   `json:"method"` // btree, hash, gin...
+}
+
+// ForeignKeyMetadata describes a foreign key, OnDelete and OnUpdate are
+// NO ACTION, RESTRICT, CASCADE, SET NULL or SET DEFAULT.
+type ForeignKeyMetadata struct {
+	Name              string   `json:"name"` // empty on sqlite, which doesn't keep constraint names
+	Columns           []string `json:"columns"`
+	ReferencedSchema  string   `json:"referenced_schema"`
+	ReferencedTable   string   `json:"referenced_table"`
+	ReferencedColumns []string `json:"referenced_columns"`
+	OnDelete          string   `json:"on_delete"`
+	OnUpdate          string   `json:"on_update"`
+}
+
+type CheckMetadata struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"` // the checked expression
+}
+
+// TriggerMetadata describes a trigger, Definition is the whole CREATE TRIGGER
+// statement on sqlite and postgres but only the trigger body on mysql.
+type TriggerMetadata struct {
+	Name       string `json:"name"`
+	Timing     string `json:"timing"` // BEFORE, AFTER or INSTEAD OF
+	Event      string `json:"event"`  // INSERT, UPDATE, DELETE, or several joined with OR
+	Definition string `json:"definition"`
+}
+
+type ViewMetadata struct {
+	Name         string `json:"name"`
+	Definition   string `json:"definition"` // the view query
+	Materialized bool   `json:"materialized"`
+}
+
+// TableMetadata describes a table, its columns having their declared type.
+type TableMetadata struct {
+	Schema      string               `json:"schema"`
+	Name        string               `json:"name"`
+	Columns     []ColumnMetadata     `json:"columns"`
+	Indexes     []IndexMetadata      `json:"indexes"`
+	ForeignKeys []ForeignKeyMetadata `json:"foreign_keys"`
+	Checks      []CheckMetadata      `json:"checks"`
+	Triggers    []TriggerMetadata    `json:"triggers"`
+}
+
+type SchemaMetadata struct {
+	Name   string          `json:"name"`
+	Tables []TableMetadata `json:"tables"`
+	Views  []ViewMetadata  `json:"views"`
+}
+
+const expressionColumn = "(expression)"
+
+var errUnknownTable = errors.New("unknown table")
+
+// queryStrings returns the first column of every row.
+func queryStrings(ctx context.Context, db querier, query string, args ...any) ([]string, error) {
+	values := make([]string, 0)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return values, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// declareTypes replaces the column types with the types as declared, given
+// (name, type) rows, varchar(20) rather than the character varying family.
+func declareTypes(ctx context.Context, db querier, columns []ColumnMetadata, query string, args ...any) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	types := make(map[string]string)
+	for rows.Next() {
+		var name, declared string
+		err := rows.Scan(&name, &declared)
+		if err != nil {
+			return err
+		}
+		types[name] = declared
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, column := range columns {
+		if declared, exists := types[column.Name]; exists {
+			columns[i].Type = declared
+		}
+	}
+	return nil
+}
+
+// scanIndexes reads one row per index column ordered by index, as
+// (name, unique, primary, method, column).
+func scanIndexes(rows *sql.Rows) ([]IndexMetadata, error) {
+	defer rows.Close()
+	indexes := make([]IndexMetadata, 0)
+
+	for rows.Next() {
+		var index IndexMetadata
+		var column string
+		err := rows.Scan(&index.Name, &index.Unique, &index.Primary, &index.Method, &column)
+		if err != nil {
+			return indexes, err
+		}
+		if last := len(indexes) - 1; last >= 0 && indexes[last].Name == index.Name {
+			indexes[last].Columns = append(indexes[last].Columns, column)
+			continue
+		}
+		index.Method = strings.ToLower(index.Method)
+		index.Columns = []string{column}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, rows.Err()
+}
+
+// scanForeignKeys reads one row per column pair ordered by constraint, as (name, column,
+// referenced schema, referenced table, referenced column, on delete, on update).
+func scanForeignKeys(rows *sql.Rows) ([]ForeignKeyMetadata, error) {
+	defer rows.Close()
+	foreignKeys := make([]ForeignKeyMetadata, 0)
+
+	for rows.Next() {
+		var foreignKey ForeignKeyMetadata
+		var column, referenced string
+		err := rows.Scan(&foreignKey.Name, &column, &foreignKey.ReferencedSchema, &foreignKey.ReferencedTable, &referenced, &foreignKey.OnDelete, &foreignKey.OnUpdate)
+		if err != nil {
+			return foreignKeys, err
+		}
+		if last := len(foreignKeys) - 1; last >= 0 && foreignKeys[last].Name == foreignKey.Name {
+			foreignKeys[last].Columns = append(foreignKeys[last].Columns, column)
+			foreignKeys[last].ReferencedColumns = append(foreignKeys[last].ReferencedColumns, referenced)
+			continue
+		}
+		foreignKey.Columns = []string{column}
+		foreignKey.ReferencedColumns = []string{referenced}
+		foreignKeys = append(foreignKeys, foreignKey)
+	}
+
+	return foreignKeys, rows.Err()
+}
+
+// scanTriggers reads (name, timing, event, definition) rows.
+func scanTriggers(rows *sql.Rows) ([]TriggerMetadata, error) {
+	defer rows.Close()
+	triggers := make([]TriggerMetadata, 0)
+
+	for rows.Next() {
+		var trigger TriggerMetadata
+		err := rows.Scan(&trigger.Name, &trigger.Timing, &trigger.Event, &trigger.Definition)
+		if err != nil {
+			return triggers, err
+		}
+		triggers = append(triggers, trigger)
+	}
+
+	return triggers, rows.Err()
+}
+
+// scanChecks reads (name, definition) rows.
+func scanChecks(rows *sql.Rows) ([]CheckMetadata, error) {
+	defer rows.Close()
+	checks := make([]CheckMetadata, 0)
+
+	for rows.Next() {
+		var check CheckMetadata
+		err := rows.Scan(&check.Name, &check.Definition)
+		if err != nil {
+			return checks, err
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, rows.Err()
+}
+
+// scanViews reads (name, definition, materialized) rows.
+func scanViews(rows *sql.Rows) ([]ViewMetadata, error) {
+	defer rows.Close()
+	views := make([]ViewMetadata, 0)
+
+	for rows.Next() {
+		var view ViewMetadata
+		err := rows.Scan(&view.Name, &view.Definition, &view.Materialized)
+		if err != nil {
+			return views, err
+		}
+		views = append(views, view)
+	}
+
+	return views, rows.Err()
+}
+
+// schemaMetadata gathers the metadata of every table of a schema.
+func schemaMetadata(ctx context.Context, schema string, tables []string, views []ViewMetadata, tableMetadata func(context.Context, string, string) (TableMetadata, error)) (SchemaMetadata, error) {
+	metadata := SchemaMetadata{Name: schema, Tables: make([]TableMetadata, 0, len(tables)), Views: views}
+	for _, table := range tables {
+		t, err := tableMetadata(ctx, schema, table)
+		if err != nil {
+			return metadata, err
+		}
+		metadata.Tables = append(metadata.Tables, t)
+	}
+	return metadata, nil
+}
+
+// codeTokens returns the tokens of a statement without its comments.
+func codeTokens(d dialect, statement string) []token {
+	tokens := make([]token, 0)
+	l := newLexer(d, statement)
+	for t, ok := l.next(); ok; t, ok = l.next() {
+		if t.kind != commentToken {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+func isWord(t token, word string) bool {
+	return t.kind == wordToken && strings.EqualFold(t.text, word)
+}
+
+// closingParen returns the index of the token closing the parenthesis opened at tokens[open].
+func closingParen(tokens []token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+// parseChecks extracts the CHECK constraints of a CREATE TABLE statement,
+// sqlite only keeps them in the statement text.
+func parseChecks(d dialect, statement string) []CheckMetadata {
+	checks := make([]CheckMetadata, 0)
+	tokens := codeTokens(d, statement)
+	for i := 0; i+1 < len(tokens); i++ {
+		if !isWord(tokens[i], "CHECK") || tokens[i+1].text != "(" {
+			continue
+		}
+		var check CheckMetadata
+		if i >= 2 && isWord(tokens[i-2], "CONSTRAINT") {
+			check.Name = unquoteIdentifier(tokens[i-1])
+		}
+		end := closingParen(tokens, i+1)
+		check.Definition = strings.TrimSpace(statement[tokens[i+1].end:tokens[end].start])
+		checks = append(checks, check)
+		i = end
+	}
+	return checks
+}
+
+// parseTrigger reads the timing and the event of a CREATE TRIGGER statement,
+// sqlite defaults to BEFORE when the timing is left out.
+func parseTrigger(d dialect, statement string) (timing string, event string) {
+	timing = "BEFORE"
+	for _, t := range codeTokens(d, statement) {
+		switch {
+		case isWord(t, "ON"):
+			return timing, event
+		case isWord(t, "BEFORE"), isWord(t, "AFTER"):
+			timing = strings.ToUpper(t.text)
+		case isWord(t, "INSTEAD"):
+			timing = "INSTEAD OF"
+		case isWord(t, "INSERT"), isWord(t, "UPDATE"), isWord(t, "DELETE"):
+			event = strings.ToUpper(t.text)
+		}
+	}
+	return timing, event
+}
+
+// parseViewQuery returns the query of a CREATE VIEW statement.
+func parseViewQuery(d dialect, statement string) string {
+	tokens := codeTokens(d, statement)
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].text == "(" {
+			i = closingParen(tokens, i)
+			continue
+		}
+		if isWord(tokens[i], "AS") && i+1 < len(tokens) {
+			return strings.TrimSpace(statement[tokens[i+1].start:])
+		}
+	}
+	return statement
+}
+
+func unquoteIdentifier(t token) string {
+	if t.kind != quotedToken || len(t.text) < 2 {
+		return t.text
+	}
+	closing := t.text[len(t.text)-1]
+	return strings.ReplaceAll(t.text[1:len(t.text)-1], string([]byte{closing, closing}), string(closing))
+}
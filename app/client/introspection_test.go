@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestGetSchemaMetadata(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+CREATE TABLE author (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE);
+CREATE TABLE book (
+	id INTEGER PRIMARY KEY,
+	author_id INTEGER REFERENCES author ON DELETE CASCADE,
+	title TEXT, -- a comment with CHECK (nothing)
+	pages INTEGER CHECK (pages > 0),
+	CONSTRAINT "title check" CHECK (length(title) < 100 AND title <> ')')
+);
+CREATE INDEX book_title ON book (title, lower(title));
+CREATE VIEW long_book (title) AS SELECT title FROM book WHERE pages > 500;
+CREATE TRIGGER book_log AFTER UPDATE OF title ON book BEGIN SELECT 1; END;
+CREATE TRIGGER book_check INSERT ON book BEGIN SELECT 1; END;
+`)
+	r.NoError(err)
+
+	c := &SqliteClient{Db: db}
+	metadata, err := c.GetSchemaMetadata(context.Background(), "main")
+	r.NoError(err)
+	r.Equal([]ViewMetadata{{Name: "long_book", Definition: "SELECT title FROM book WHERE pages > 500"}}, metadata.Views)
+	r.Len(metadata.Tables, 2)
+
+	author := metadata.Tables[0]
+	r.Equal("author", author.Name)
+	r.Equal([]IndexMetadata{{Name: "sqlite_autoindex_author_1", Columns: []string{"name"}, Unique: true, Method: "btree"}}, author.Indexes)
+
+	book := metadata.Tables[1]
+	r.Equal("book", book.Name)
+	r.Len(book.Columns, 4)
+	r.Equal([]IndexMetadata{{Name: "book_title", Columns: []string{"title", expressionColumn}, Method: "btree"}}, book.Indexes)
+	r.Equal([]ForeignKeyMetadata{{
+		Columns:           []string{"author_id"},
+		ReferencedSchema:  "main",
+		ReferencedTable:   "author",
+		ReferencedColumns: []string{"id"},
+		OnDelete:          "CASCADE",
+		OnUpdate:          "NO ACTION",
+	}}, book.ForeignKeys)
+	r.Equal([]CheckMetadata{
+		{Definition: "pages > 0"},
+		{Name: "title check", Definition: "length(title) < 100 AND title <> ')'"},
+	}, book.Checks)
+	r.Len(book.Triggers, 2)
+	r.Equal("book_check", book.Triggers[0].Name)
+	r.Equal("BEFORE", book.Triggers[0].Timing)
+	r.Equal("INSERT", book.Triggers[0].Event)
+	r.Equal("AFTER", book.Triggers[1].Timing)
+	r.Equal("UPDATE", book.Triggers[1].Event)
+
+	_, err = c.GetTableMetadata(context.Background(), "main", "missing")
+	r.Error(err)
+}
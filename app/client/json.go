@@ -0,0 +1,152 @@
+package client
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// jsonWriter streams rows as an array of objects, or as one object per line
+// for NDJSON, keeping the column order of the query.
+type jsonWriter struct {
+	w       io.Writer
+	ndjson  bool
+	keys    [][]byte
+	kinds   []valueKind
+	rows    int
+	buf     bytes.Buffer
+	encoder *json.Encoder
+}
+
+func newJSONWriter(w io.Writer, ndjson bool) *jsonWriter {
+	j := &jsonWriter{w: w, ndjson: ndjson}
+	j.encoder = json.NewEncoder(&j.buf)
+	j.encoder.SetEscapeHTML(false)
+	return j
+}
+
+func (j *jsonWriter) begin(columns []*sql.ColumnType) error {
+	j.keys = make([][]byte, len(columns))
+	j.kinds = make([]valueKind, len(columns))
+	for i, col := range columns {
+		j.buf.Reset()
+		if err := j.encode(col.Name()); err != nil {
+			return err
+		}
+		j.keys[i] = bytes.Clone(j.buf.Bytes())
+		j.kinds[i] = columnKind(col)
+	}
+
+	if j.ndjson {
+		return nil
+	}
+	_, err := io.WriteString(j.w, "[")
+	return err
+}
+
+func (j *jsonWriter) write(values []any) error {
+	j.buf.Reset()
+	if !j.ndjson {
+		if j.rows > 0 {
+			j.buf.WriteString(",")
+		}
+		j.buf.WriteString("\n  ")
+	}
+
+	j.buf.WriteString("{")
+	for i, value := range values {
+		if i > 0 {
+			j.buf.WriteString(", ")
+		}
+		j.buf.Write(j.keys[i])
+		j.buf.WriteString(": ")
+		if err := j.value(value, j.kinds[i]); err != nil {
+			return err
+		}
+	}
+	j.buf.WriteString("}")
+
+	if j.ndjson {
+		j.buf.WriteString("\n")
+	}
+	j.rows++
+
+	_, err := j.w.Write(j.buf.Bytes())
+	return err
+}
+
+func (j *jsonWriter) end() error {
+	if j.ndjson {
+		return nil
+	}
+	closing := "\n]\n"
+	if j.rows == 0 {
+		closing = "]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
+
+// value appends the JSON for a scanned value, drivers return numbers and
+// timestamps as []byte (mysql) so the column kind decides.
+func (j *jsonWriter) value(value any, kind valueKind) error {
+	switch v := value.(type) {
+	case nil:
+		j.buf.WriteString("null")
+	case bool:
+		j.buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		if kind == booleanKind {
+			j.buf.WriteString(strconv.FormatBool(v != 0))
+		} else {
+			j.buf.WriteString(strconv.FormatInt(v, 10))
+		}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			// NOTE: not representable as a JSON number
+			return j.encode(strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		return j.encode(v)
+	case time.Time:
+		return j.encode(v.Format(time.RFC3339Nano))
+	case []byte:
+		switch {
+		case kind == binaryKind || !utf8.Valid(v):
+			return j.encode(base64.StdEncoding.EncodeToString(v))
+		case kind == numberKind && isJSONNumber(v):
+			// NOTE: written as is to keep the precision of decimals
+			j.buf.Write(v)
+		case kind == timestampKind:
+			return j.encode(strings.Replace(string(v), " ", "T", 1))
+		default:
+			return j.encode(string(v))
+		}
+	default:
+		return j.encode(v)
+	}
+	return nil
+}
+
+// encode appends v to the buffer without the newline added by the encoder.
+func (j *jsonWriter) encode(v any) error {
+	if err := j.encoder.Encode(v); err != nil {
+		return err
+	}
+	j.buf.Truncate(j.buf.Len() - 1)
+	return nil
+}
+
+func isJSONNumber(v []byte) bool {
+	if len(v) == 0 || (v[0] != '-' && (v[0] < '0' || v[0] > '9')) {
+		return false
+	}
+	var number json.Number
+	return json.Unmarshal(v, &number) == nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestExportJSON(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, score REAL, active BOOLEAN, data BLOB, created_at DATETIME); INSERT INTO t VALUES (1, '<a & b>', 1.5, 1, x'00ff', '2024-01-02 03:04:05'), (2, NULL, NULL, 0, NULL, NULL)`)
+	r.NoError(err)
+
+	var buf bytes.Buffer
+	err = exportQuery(context.Background(), db, sqliteDialect, &buf, "SELECT * FROM t", ExportOptions{Type: JSON})
+	r.NoError(err)
+	r.Equal(`[
+  {"id": 1, "name": "<a & b>", "score": 1.5, "active": true, "data": "AP8=", "created_at": "2024-01-02T03:04:05Z"},
+  {"id": 2, "name": null, "score": null, "active": false, "data": null, "created_at": null}
+]
+`, buf.String())
+	r.True(json.Valid(buf.Bytes()))
+
+	buf.Reset()
+	err = exportQuery(context.Background(), db, sqliteDialect, &buf, "SELECT id, name FROM t", ExportOptions{Type: NDJSON})
+	r.NoError(err)
+	r.Equal("{\"id\": 1, \"name\": \"<a & b>\"}\n{\"id\": 2, \"name\": null}\n", buf.String())
+
+	buf.Reset()
+	err = exportQuery(context.Background(), db, sqliteDialect, &buf, "SELECT * FROM t WHERE id > 2", ExportOptions{Type: JSON})
+	r.NoError(err)
+	r.Equal("[]\n", buf.String())
+}
+
+func TestJSONValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    any
+		kind     valueKind
+		expected string
+	}{
+		{"Decimal as bytes", []byte("12.50"), numberKind, "12.50"},
+		{"Numeric NaN as bytes", []byte("NaN"), numberKind, `"NaN"`},
+		{"Text as bytes", []byte("12.50"), otherKind, `"12.50"`},
+		{"Invalid UTF-8", []byte{0xff, 0xfe}, otherKind, `"//4="`},
+		{"Binary", []byte("abc"), binaryKind, `"YWJj"`},
+		{"Timestamp as bytes", []byte("2024-01-02 03:04:05"), timestampKind, `"2024-01-02T03:04:05"`},
+		{"Boolean as integer", int64(1), booleanKind, "true"},
+		{"Infinity", math.Inf(1), numberKind, `"+Inf"`},
+		{"Escaped string", "a\"b\n", otherKind, `"a\"b\n"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			j := newJSONWriter(nil, false)
+			r.NoError(j.value(tc.value, tc.kind))
+			r.Equal(tc.expected, j.buf.String())
+		})
+	}
+}
@@ -1,21 +1,22 @@
 package client
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"reflect"
+	"io"
 	"strings"
-	"time"
 )
 
 type MysqlClient struct {
-	Db *sql.DB
+	Db     *sql.DB
+	Limits Limits
 }
 
-func (c *MysqlClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
+func (c *MysqlClient) GetDatabaseMetadata(ctx context.Context) (DatabaseMetadata, error) {
 	var databaseMetadata DatabaseMetadata
 
-	schemas, err := c.getSchemas()
+	schemas, err := c.getSchemas(ctx)
 	if err != nil {
 		return databaseMetadata, err
 	}
@@ -23,12 +24,12 @@ func (c *MysqlClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
 	databaseMetadata.Columns = make(map[string]map[string][]string)
 	for _, schema := range schemas {
 		databaseMetadata.Columns[schema] = make(map[string][]string)
-		tables, err := c.getTables(schema)
+		tables, err := c.getTables(ctx, schema)
 		if err != nil {
 			continue
 		}
 		for _, table := range tables {
-			columns, err := c.getColumns(schema, table)
+			columns, err := c.getColumns(ctx, schema, table)
 			if err != nil {
 				continue
 			}
@@ -39,10 +40,10 @@ func (c *MysqlClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
 	return databaseMetadata, nil
 }
 
-func (c *MysqlClient) getColumns(schema string, table string) ([]string, error) {
+func (c *MysqlClient) getColumns(ctx context.Context, schema string, table string) ([]string, error) {
 	columns := make([]string, 0)
 
-	rows, err := c.Db.Query("SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?", schema, table)
+	rows, err := c.Db.QueryContext(ctx, "SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?", schema, table)
 	if err != nil {
 		return columns, err
 	}
@@ -61,10 +62,10 @@ func (c *MysqlClient) getColumns(schema string, table string) ([]string, error)
 	return columns, nil
 }
 
-func (c *MysqlClient) getTables(schema string) ([]string, error) {
+func (c *MysqlClient) getTables(ctx context.Context, schema string) ([]string, error) {
 	tables := make([]string, 0)
 
-	rows, err := c.Db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = ?", schema)
+	rows, err := c.Db.QueryContext(ctx, "SELECT table_name FROM information_schema.tables WHERE table_schema = ?", schema)
 	if err != nil {
 		return tables, err
 	}
@@ -82,10 +83,10 @@ func (c *MysqlClient) getTables(schema string) ([]string, error) {
 	return tables, nil
 }
 
-func (c *MysqlClient) getSchemas() ([]string, error) {
+func (c *MysqlClient) getSchemas(ctx context.Context) ([]string, error) {
 	schemas := make([]string, 0)
 
-	rows, err := c.Db.Query("SELECT schema_name FROM information_schema.schemata")
+	rows, err := c.Db.QueryContext(ctx, "SELECT schema_name FROM information_schema.schemata")
 	if err != nil {
 		return schemas, err
 	}
@@ -103,7 +104,7 @@ func (c *MysqlClient) getSchemas() ([]string, error) {
 	return schemas, nil
 }
 
-func (c *MysqlClient) fetchColumnsMetadata(schema string, table string, columns []string) ([]ColumnMetadata, error) {
+func (c *MysqlClient) fetchColumnsMetadata(ctx context.Context, schema string, table string, columns []string) ([]ColumnMetadata, error) {
 	var columnsMetadata []ColumnMetadata
 
 	tcSchema := ""
@@ -117,7 +118,7 @@ func (c *MysqlClient) fetchColumnsMetadata(schema string, table string, columns
 		cColumns = fmt.Sprintf(" AND c.column_name IN (%s)", "'"+strings.Join(columns, "', '")+"'")
 	}
 
-	queryColumns, err := c.Db.Query(fmt.Sprintf("SELECT c.column_name AS name, c.data_type AS type, COALESCE(c.column_default, 'NULL') AS default_value, CASE c.is_nullable WHEN 'YES' THEN true ELSE false END nullable, COALESCE((SELECT TRUE FROM information_schema.table_constraints tc LEFT JOIN information_schema.key_column_usage kcu ON tc.constraint_name = kcu.constraint_name WHERE%s tc.table_name = '%s' AND tc.constraint_type = 'PRIMARY KEY' AND kcu.COLUMN_NAME = c.COLUMN_NAME GROUP BY tc.TABLE_SCHEMA, tc.TABLE_NAME, kcu.COLUMN_NAME), FALSE) AS primary_key FROM information_schema.columns c WHERE%s c.table_name = '%s'%s", tcSchema, table, cSchema, table, cColumns))
+	queryColumns, err := c.Db.QueryContext(ctx, fmt.Sprintf("SELECT c.column_name AS name, c.data_type AS type, COALESCE(c.column_default, 'NULL') AS default_value, CASE c.is_nullable WHEN 'YES' THEN true ELSE false END nullable, COALESCE((SELECT TRUE FROM information_schema.table_constraints tc LEFT JOIN information_schema.key_column_usage kcu ON tc.constraint_name = kcu.constraint_name WHERE%s tc.table_name = '%s' AND tc.constraint_type = 'PRIMARY KEY' AND kcu.COLUMN_NAME = c.COLUMN_NAME GROUP BY tc.TABLE_SCHEMA, tc.TABLE_NAME, kcu.COLUMN_NAME), FALSE) AS primary_key FROM information_schema.columns c WHERE%s c.table_name = '%s'%s", tcSchema, table, cSchema, table, cColumns))
 	if err != nil {
 		return columnsMetadata, err
 	}
@@ -129,9 +130,9 @@ func (c *MysqlClient) fetchColumnsMetadata(schema string, table string, columns
 	return columnsMetadata, nil
 }
 
-func (c *MysqlClient) getEnumValues(db *sql.DB, schema string, table string, column string) ([]string, error) {
+func (c *MysqlClient) getEnumValues(ctx context.Context, db *sql.DB, schema string, table string, column string) ([]string, error) {
 	result := []string{}
-	rows, err := db.Query(fmt.Sprintf("SELECT column_type FROM information_schema.columns WHERE table_schema = '%s' AND table_name = '%s' AND column_name = '%s'", schema, table, column))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT column_type FROM information_schema.columns WHERE table_schema = '%s' AND table_name = '%s' AND column_name = '%s'", schema, table, column))
 	if err != nil {
 		return result, err
 	}
@@ -155,7 +156,7 @@ func (c *MysqlClient) getEnumValues(db *sql.DB, schema string, table string, col
 	return result, nil
 }
 
-func (c *MysqlClient) executeSelectQuery(query string, params QueryParams) (QueryResult, error) {
+func (c *MysqlClient) executeSelectQuery(ctx context.Context, query string, params QueryParams) (QueryResult, error) {
 	queryParts := strings.Split(query, " ")
 	table := queryParts[0]
 	tableParts := strings.Split(table, ".")
@@ -166,7 +167,21 @@ func (c *MysqlClient) executeSelectQuery(query string, params QueryParams) (Quer
 		tableName = strings.ReplaceAll(tableParts[1], "`", "")
 	}
 
-	result, err := executeSelectQuery(c.Db, query, params)
+	info := tableInfo{schema: schema, name: tableName}
+	if params.Cursor != nil {
+		columnsMetadata, err := c.fetchColumnsMetadata(ctx, schema, tableName, []string{})
+		if err != nil {
+			return QueryResult{}, err
+		}
+		info.primaryKey = primaryKeyColumns(columnsMetadata)
+	}
+
+	var result QueryResult
+	err := c.withCancel(ctx, c.Limits, func(conn *sql.Conn) error {
+		var err error
+		result, err = executeSelectQuery(ctx, conn, mysqlDialect, query, params, info, c.Limits)
+		return err
+	})
 	if err != nil {
 		return result, err
 	}
@@ -181,7 +196,7 @@ func (c *MysqlClient) executeSelectQuery(query string, params QueryParams) (Quer
 		}
 	}
 
-	columnsMetadata, err := c.fetchColumnsMetadata(schema, tableName, columns)
+	columnsMetadata, err := c.fetchColumnsMetadata(ctx, schema, tableName, columns)
 	if err != nil {
 		return result, err
 	}
@@ -190,7 +205,7 @@ func (c *MysqlClient) executeSelectQuery(query string, params QueryParams) (Quer
 	result.Enums = []EnumMetadata{}
 	for _, col := range columnsMetadata {
 		if col.Type == "enum" {
-			values, err := c.getEnumValues(c.Db, schema, tableName, col.Name)
+			values, err := c.getEnumValues(ctx, c.Db, schema, tableName, col.Name)
 			if err != nil {
 				return result, err
 			}
@@ -209,214 +224,261 @@ func (c *MysqlClient) executeSelectQuery(query string, params QueryParams) (Quer
 	return result, err
 }
 
-func (c *MysqlClient) GetConnectionDatabases(params QueryParams) (QueryResult, error) {
+func (c *MysqlClient) withCancel(ctx context.Context, limits Limits, fn func(*sql.Conn) error) error {
+	// NOTE: apply the timeout here too so it also cancels the statement server side
+	ctx, cancel := limits.withTimeout(ctx)
+	defer cancel()
+
+	pidQuery, cancelQuery := mysqlDialect.cancelQueries()
+	return withCancel(ctx, c.Db, pidQuery, cancelQuery, fn)
+}
+
+func (c *MysqlClient) GetConnectionDatabases(ctx context.Context, params QueryParams) (QueryResult, error) {
 	params.Columns = []string{"SCHEMA_NAME AS name"}
-	return c.executeSelectQuery("information_schema.schemata", params)
+	return c.executeSelectQuery(ctx, "information_schema.schemata", params)
 }
 
-func (c *MysqlClient) GetDatabaseSchemas(params QueryParams) (QueryResult, error) {
+func (c *MysqlClient) GetDatabaseSchemas(ctx context.Context, params QueryParams) (QueryResult, error) {
 	params.Columns = []string{"SCHEMA_NAME AS name"}
-	return c.executeSelectQuery("information_schema.schemata WHERE SCHEMA_NAME = DATABASE()", params)
+	return c.executeSelectQuery(ctx, "information_schema.schemata WHERE SCHEMA_NAME = DATABASE()", params)
 }
 
-func (c *MysqlClient) GetSchemaTables(params QueryParams, schema string) (QueryResult, error) {
+func (c *MysqlClient) GetSchemaTables(ctx context.Context, params QueryParams, schema string) (QueryResult, error) {
 	params.Columns = []string{"TABLE_NAME AS name"}
-	return c.executeSelectQuery(fmt.Sprintf("information_schema.tables WHERE TABLE_SCHEMA = '%s'", schema), params)
+	return c.executeSelectQuery(ctx, fmt.Sprintf("information_schema.tables WHERE TABLE_SCHEMA = '%s'", schema), params)
+}
+
+func (c *MysqlClient) GetTableRows(ctx context.Context, params QueryParams, schema string, table string) (QueryResult, error) {
+	return c.executeSelectQuery(ctx, fmt.Sprintf("`%s`.`%s`", schema, table), params)
+}
+
+func (c *MysqlClient) ExecuteQuery(ctx context.Context, query string) (QueryResult, error) {
+	var result QueryResult
+	err := c.withCancel(ctx, c.Limits, func(conn *sql.Conn) error {
+		var err error
+		result, err = executeQuery(ctx, conn, mysqlDialect, query, c.Limits)
+		return err
+	})
+	return result, err
+}
+
+func (c *MysqlClient) ExecuteScript(ctx context.Context, script string, stopOnError bool) ([]ScriptResult, error) {
+	var results []ScriptResult
+	// NOTE: the limits apply to each statement, not to the whole script
+	err := c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		results = executeScript(ctx, conn, mysqlDialect, script, stopOnError, c.Limits)
+		return nil
+	})
+	return results, err
 }
 
-func (c *MysqlClient) GetTableRows(params QueryParams, schema string, table string) (QueryResult, error) {
-	return c.executeSelectQuery(fmt.Sprintf("`%s`.`%s`", schema, table), params)
+func (c *MysqlClient) Execute(ctx context.Context, query string) error {
+	return c.withCancel(ctx, c.Limits, func(conn *sql.Conn) error {
+		return execute(ctx, conn, query, c.Limits)
+	})
 }
 
-func (c *MysqlClient) ExecuteQuery(query string) (QueryResult, error) {
-	return executeQuery(c.Db, query)
+func (c *MysqlClient) Export(ctx context.Context, w io.Writer, options ExportOptions) error {
+	// NOTE: exports are not subject to the connection limits
+	return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		if options.Type != SQL {
+			return exportData(ctx, conn, mysqlDialect, w, options)
+		}
+
+		return dumpSQL(ctx, conn, mysqlDialect, w, options, func(schema string, table string) (tableDDL, error) {
+			return c.tableDDL(ctx, schema, table)
+		})
+	})
 }
 
-func (c *MysqlClient) Execute(query string) error {
-	return execute(c.Db, query)
+func (c *MysqlClient) ExportQuery(ctx context.Context, w io.Writer, query string, options ExportOptions) error {
+	return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		return exportQuery(ctx, conn, mysqlDialect, w, query, options)
+	})
 }
 
-func (c *MysqlClient) Export(options ExportOptions) (string, error) {
-	contents := ""
+func (c *MysqlClient) Import(ctx context.Context, r io.Reader, options ImportOptions, onProgress func(ImportProgress)) error {
+	// NOTE: imports are not subject to the connection limits
+	return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		return importScript(ctx, conn, mysqlDialect, r, options, onProgress)
+	})
+}
 
-	if options.WrapInTransaction {
-		contents += "BEGIN;\n"
+func (c *MysqlClient) PreviewCSV(ctx context.Context, r io.Reader, options CSVImportOptions) (CSVPreview, error) {
+	tableColumns, err := c.fetchColumnsMetadata(ctx, options.Schema, options.Table, []string{})
+	if err != nil {
+		return CSVPreview{}, err
 	}
+	return previewCSV(r, options, tableColumns)
+}
 
-	currentTable := ""
-	currentTableMetadata := make([]ColumnMetadata, 0)
+func (c *MysqlClient) ImportCSV(ctx context.Context, r io.Reader, options CSVImportOptions, onProgress func(ImportProgress)) error {
+	tableColumns, err := c.fetchColumnsMetadata(ctx, options.Schema, options.Table, []string{})
+	if err != nil {
+		return err
+	}
+	return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		return importCSV(ctx, conn, mysqlDialect, r, options, tableColumns, onProgress)
+	})
+}
 
-	tableColumnsMap := make(map[string][]string)
+func (c *MysqlClient) GetTableMetadata(ctx context.Context, schema string, table string) (TableMetadata, error) {
+	metadata := TableMetadata{Schema: schema, Name: table}
 
-	// NOTE: STEP 1 => Create tables
-	// TODO: refactor and use helper function to avoid duplicate code
-	if options.DropTable != DoNothing {
-		for i, entity := range options.Selected {
-			if strings.Count(entity, ".") == 0 {
-				// TODO: schema
-			}
-			if strings.Count(entity, ".") == 1 {
-				parts := strings.Split(entity, ".")
-				schema := parts[0]
-				table := parts[1]
-				if table != currentTable {
-					var err error
-					currentTableMetadata, err = c.fetchColumnsMetadata(schema, table, []string{})
-					if err != nil {
-						return "", err
-					}
-					currentTable = table
-					tableColumnsMap[table] = make([]string, 0)
-				}
-				switch options.DropTable {
-				case DropAndCreate:
-					contents += fmt.Sprintf("DROP TABLE %s;\n", table)
-					contents += fmt.Sprintf("CREATE TABLE %s (\n", table)
-				case Create:
-					contents += fmt.Sprintf("CREATE TABLE %s (\n", table)
-				case CreateIfNotExists:
-					contents += fmt.Sprintf("CREATE IF NOT EXISTS TABLE %s (\n", table)
-				}
-			}
-			if strings.Count(entity, ".") == 2 {
-				parts := strings.Split(entity, ".")
-				schema := parts[0]
-				table := parts[1]
-				column := parts[2]
-				tableColumnsMap[table] = append(tableColumnsMap[table], column)
-				var currentColumn *ColumnMetadata = nil
-				for _, col := range currentTableMetadata {
-					if col.Name == column {
-						currentColumn = &col
-						break
-					}
-				}
-				if currentColumn == nil {
-					return "", fmt.Errorf("invalid column name: %s", column)
-				}
-
-				nullable := ""
-				defaultValue := ""
-				primaryKey := ""
-				if !currentColumn.Nullable {
-					nullable = " NOT NULL"
-				}
-				if currentColumn.DefaultValue != "NULL" {
-					defaultValue = fmt.Sprintf(" DEFAULT %s", currentColumn.DefaultValue)
-				}
-				if currentColumn.PrimaryKey {
-					primaryKey = " PRIMARY KEY"
-				}
-				contents += fmt.Sprintf("    %s %s%s%s%s", currentColumn.Name, currentColumn.Type, nullable, defaultValue, primaryKey)
-				if i+1 < len(options.Selected) {
-					next := options.Selected[i+1]
-					// NOTE: only part differing from sqlite as we can use the schema here
-					if strings.HasPrefix(next, schema+"."+table+".") {
-						contents += ","
-					} else {
-						contents += "\n);"
-					}
-				} else {
-					contents += "\n);"
-				}
-				contents += "\n"
-			}
-		}
+	var err error
+	metadata.Columns, err = c.fetchColumnsMetadata(ctx, schema, table, []string{})
+	if err != nil {
+		return metadata, err
+	}
+	if len(metadata.Columns) == 0 {
+		return metadata, fmt.Errorf("%w %s.%s", errUnknownTable, schema, table)
+	}
+	err = declareTypes(ctx, c.Db, metadata.Columns, "SELECT COLUMN_NAME, COLUMN_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", schema, table)
+	if err != nil {
+		return metadata, err
 	}
 
-	// NOTE: STEP 2 => Insert data
-	// TODO: use helper function to avoid duplicate code
-	if !options.SchemaOnly {
-		contents += "\n"
-		for table, columns := range tableColumnsMap {
-			query := "SELECT "
-			for i, column := range columns {
-				query += fmt.Sprintf("`%s`", column)
-				if i+1 < len(columns) {
-					query += ", "
-				}
-			}
-			query += fmt.Sprintf(" FROM %s;", table)
-			result, err := c.ExecuteQuery(query)
-			if err != nil {
-				return "", err
-			}
-			fmt.Println("res", len(result.Rows), query)
-			if len(result.Rows) == 0 {
-				continue
-			}
+	rows, err := c.Db.QueryContext(ctx, `SELECT INDEX_NAME, NON_UNIQUE = 0, INDEX_NAME = 'PRIMARY', INDEX_TYPE, COALESCE(COLUMN_NAME, ?)
+FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+ORDER BY INDEX_NAME, SEQ_IN_INDEX`, expressionColumn, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Indexes, err = scanIndexes(rows)
+	if err != nil {
+		return metadata, err
+	}
 
-			contents += fmt.Sprintf("INSERT INTO %s (", table)
-			for i, column := range columns {
-				contents += fmt.Sprintf("`%s`", column)
-				if i+1 < len(columns) {
-					contents += ", "
-				}
-			}
-			contents += ") VALUES\n"
-
-			for i, row := range result.Rows {
-				contents += "    ("
-				for j, column := range columns {
-					value := row[column]
-					fmt.Println("huh?", column, value, reflect.TypeOf(value))
-					switch v := value.(type) {
-					case nil:
-						contents += "NULL"
-					case []byte:
-						// TODO: check type directly from column metadata to correctly add quotes
-						contents += fmt.Sprintf("'%s'", strings.ReplaceAll(string(v), "'", "''"))
-					case bool:
-						if v {
-							contents += "TRUE"
-						} else {
-							contents += "FALSE"
-						}
-					case int:
-						contents += fmt.Sprint(v)
-					case int64:
-						contents += fmt.Sprint(v)
-					case float64:
-						contents += fmt.Sprint(v)
-					case string:
-						contents += fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
-					case time.Time:
-						contents += fmt.Sprintf("'%s'", v.Format(time.RFC3339))
-					default:
-						return "", fmt.Errorf("invalid value type: %s (%s)", v, reflect.TypeOf(value))
-					}
-					if j+1 < len(columns) {
-						contents += ", "
-					} else {
-						contents += ")"
-					}
-				}
-				if i+1 < len(result.Rows) {
-					contents += ","
-				} else {
-					contents += ";"
-				}
-				contents += "\n"
-			}
-		}
+	rows, err = c.Db.QueryContext(ctx, `SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_SCHEMA, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.DELETE_RULE, r.UPDATE_RULE
+FROM information_schema.KEY_COLUMN_USAGE k
+JOIN information_schema.REFERENTIAL_CONSTRAINTS r ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME AND r.TABLE_NAME = k.TABLE_NAME
+WHERE k.TABLE_SCHEMA = ? AND k.TABLE_NAME = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION`, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.ForeignKeys, err = scanForeignKeys(rows)
+	if err != nil {
+		return metadata, err
+	}
+
+	// NOTE: check constraints are enforced since MySQL 8.0.16 and MariaDB 10.2
+	rows, err = c.Db.QueryContext(ctx, `SELECT cc.CONSTRAINT_NAME, cc.CHECK_CLAUSE
+FROM information_schema.CHECK_CONSTRAINTS cc
+JOIN information_schema.TABLE_CONSTRAINTS tc ON tc.CONSTRAINT_SCHEMA = cc.CONSTRAINT_SCHEMA AND tc.CONSTRAINT_NAME = cc.CONSTRAINT_NAME
+WHERE tc.CONSTRAINT_TYPE = 'CHECK' AND tc.TABLE_SCHEMA = ? AND tc.TABLE_NAME = ?
+ORDER BY cc.CONSTRAINT_NAME`, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Checks, err = scanChecks(rows)
+	if err != nil {
+		return metadata, err
+	}
+
+	rows, err = c.Db.QueryContext(ctx, `SELECT TRIGGER_NAME, ACTION_TIMING, EVENT_MANIPULATION, ACTION_STATEMENT
+FROM information_schema.TRIGGERS
+WHERE EVENT_OBJECT_SCHEMA = ? AND EVENT_OBJECT_TABLE = ?
+ORDER BY TRIGGER_NAME`, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Triggers, err = scanTriggers(rows)
+	if err != nil {
+		return metadata, err
+	}
+
+	return metadata, nil
+}
 
-		contents += "\n"
+func (c *MysqlClient) GetSchemaMetadata(ctx context.Context, schema string) (SchemaMetadata, error) {
+	tables, err := queryStrings(ctx, c.Db, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME", schema)
+	if err != nil {
+		return SchemaMetadata{}, err
 	}
 
-	if options.WrapInTransaction {
-		contents += "COMMIT;\n"
+	rows, err := c.Db.QueryContext(ctx, "SELECT TABLE_NAME, VIEW_DEFINITION, false FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME", schema)
+	if err != nil {
+		return SchemaMetadata{}, err
 	}
+	views, err := scanViews(rows)
+	if err != nil {
+		return SchemaMetadata{}, err
+	}
+
+	return schemaMetadata(ctx, schema, tables, views, c.GetTableMetadata)
+}
 
-	return contents, nil
+func (c *MysqlClient) GetTableDDL(ctx context.Context, schema string, table string) (string, error) {
+	ddl, err := c.tableDDL(ctx, schema, table)
+	if err != nil {
+		return "", err
+	}
+	return ddl.String(mysqlDialect), nil
 }
 
-func (c *MysqlClient) Import(contents string) error {
-	err := c.Execute(contents)
+// tableDDL relies on SHOW CREATE TABLE, which already holds the indexes and
+// the foreign keys, and adds the triggers of the table.
+func (c *MysqlClient) tableDDL(ctx context.Context, schema string, table string) (tableDDL, error) {
+	var ddl tableDDL
+
+	var name, create string
+	err := c.Db.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE %s.%s", mysqlDialect.quoteIdentifier(schema), mysqlDialect.quoteIdentifier(table))).Scan(&name, &create)
 	if err != nil {
-		if strings.Contains(contents, "BEGIN;") || strings.Contains(contents, "BEGIN TRANSACTION;") {
-			c.Execute("ROLLBACK;")
+		return ddl, err
+	}
+	ddl.create = append(ddl.create, create)
+
+	ddl.generated, err = queryStrings(ctx, c.Db, "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND EXTRA IN ('VIRTUAL GENERATED', 'STORED GENERATED') ORDER BY ORDINAL_POSITION", schema, table)
+	if err != nil {
+		return ddl, err
+	}
+
+	triggers, err := queryStrings(ctx, c.Db, "SELECT TRIGGER_NAME FROM information_schema.TRIGGERS WHERE EVENT_OBJECT_SCHEMA = ? AND EVENT_OBJECT_TABLE = ? ORDER BY ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER", schema, table)
+	if err != nil {
+		return ddl, err
+	}
+	for _, trigger := range triggers {
+		statement, err := c.showCreateTrigger(ctx, schema, trigger)
+		if err != nil {
+			return ddl, err
 		}
-		return err
+		ddl.after = append(ddl.after, statement)
+	}
+
+	return ddl, nil
+}
+
+func (c *MysqlClient) showCreateTrigger(ctx context.Context, schema string, trigger string) (string, error) {
+	rows, err := c.Db.QueryContext(ctx, fmt.Sprintf("SHOW CREATE TRIGGER %s.%s", mysqlDialect.quoteIdentifier(schema), mysqlDialect.quoteIdentifier(trigger)))
+	if err != nil {
+		return "", err
 	}
-	return nil
+	defer rows.Close()
+
+	// NOTE: the columns around the statement differ between MySQL and MariaDB versions
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		return "", fmt.Errorf("unknown trigger %s.%s", schema, trigger)
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err = rows.Scan(dest...)
+	if err != nil {
+		return "", err
+	}
+	for i, column := range columns {
+		if column == "SQL Original Statement" {
+			return string(values[i]), nil
+		}
+	}
+
+	return "", fmt.Errorf("SHOW CREATE TRIGGER returned no statement for %s.%s", schema, trigger)
 }
@@ -1,21 +1,23 @@
 package client
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"reflect"
+	"io"
 	"strings"
-	"time"
 )
 
 type PostgresClient struct {
-	Db *sql.DB
+	Db     *sql.DB
+	Limits Limits
 }
 
-func (c *PostgresClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
+func (c *PostgresClient) GetDatabaseMetadata(ctx context.Context) (DatabaseMetadata, error) {
 	var databaseMetadata DatabaseMetadata
 
-	schemas, err := c.getSchemas()
+	schemas, err := c.getSchemas(ctx)
 	if err != nil {
 		return databaseMetadata, err
 	}
@@ -23,12 +25,12 @@ func (c *PostgresClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
 	databaseMetadata.Columns = make(map[string]map[string][]string)
 	for _, schema := range schemas {
 		databaseMetadata.Columns[schema] = make(map[string][]string)
-		tables, err := c.getTables(schema)
+		tables, err := c.getTables(ctx, schema)
 		if err != nil {
 			continue
 		}
 		for _, table := range tables {
-			columns, err := c.getColumns(schema, table)
+			columns, err := c.getColumns(ctx, schema, table)
 			if err != nil {
 				continue
 			}
@@ -39,10 +41,10 @@ func (c *PostgresClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
 	return databaseMetadata, nil
 }
 
-func (c *PostgresClient) getColumns(schema string, table string) ([]string, error) {
+func (c *PostgresClient) getColumns(ctx context.Context, schema string, table string) ([]string, error) {
 	columns := make([]string, 0)
 
-	rows, err := c.Db.Query(fmt.Sprintf("SELECT column_name FROM information_schema.columns WHERE table_schema = '%s' AND table_name = '%s'", schema, table))
+	rows, err := c.Db.QueryContext(ctx, fmt.Sprintf("SELECT column_name FROM information_schema.columns WHERE table_schema = '%s' AND table_name = '%s'", schema, table))
 	if err != nil {
 		return columns, err
 	}
@@ -61,10 +63,10 @@ func (c *PostgresClient) getColumns(schema string, table string) ([]string, erro
 	return columns, nil
 }
 
-func (c *PostgresClient) getTables(schema string) ([]string, error) {
+func (c *PostgresClient) getTables(ctx context.Context, schema string) ([]string, error) {
 	tables := make([]string, 0)
 
-	rows, err := c.Db.Query(fmt.Sprintf("SELECT table_name FROM information_schema.tables WHERE table_schema = '%s'", schema))
+	rows, err := c.Db.QueryContext(ctx, fmt.Sprintf("SELECT table_name FROM information_schema.tables WHERE table_schema = '%s'", schema))
 	if err != nil {
 		return tables, err
 	}
@@ -82,10 +84,10 @@ func (c *PostgresClient) getTables(schema string) ([]string, error) {
 	return tables, nil
 }
 
-func (c *PostgresClient) getSchemas() ([]string, error) {
+func (c *PostgresClient) getSchemas(ctx context.Context) ([]string, error) {
 	schemas := make([]string, 0)
 
-	rows, err := c.Db.Query("SELECT schema_name FROM information_schema.schemata")
+	rows, err := c.Db.QueryContext(ctx, "SELECT schema_name FROM information_schema.schemata")
 	if err != nil {
 		return schemas, err
 	}
@@ -103,7 +105,7 @@ func (c *PostgresClient) getSchemas() ([]string, error) {
 	return schemas, nil
 }
 
-func (c *PostgresClient) fetchColumnsMetadata(schema string, table string, columns []string) ([]ColumnMetadata, error) {
+func (c *PostgresClient) fetchColumnsMetadata(ctx context.Context, schema string, table string, columns []string) ([]ColumnMetadata, error) {
 	var columnsMetadata []ColumnMetadata
 
 	tcSchema := ""
@@ -116,7 +118,7 @@ func (c *PostgresClient) fetchColumnsMetadata(schema string, table string, colum
 	if len(columns) > 0 {
 		cColumns = fmt.Sprintf(" AND c.column_name IN (%s)", "'"+strings.Join(columns, "', '")+"'")
 	}
-	queryColumns, err := c.Db.Query(fmt.Sprintf("SELECT c.column_name AS name, c.data_type AS type, COALESCE(c.column_default, 'NULL') AS default_value, CASE c.is_nullable WHEN 'YES' THEN true ELSE false END nullable, COALESCE((SELECT TRUE FROM information_schema.table_constraints tc LEFT JOIN information_schema.key_column_usage kcu ON tc.constraint_name = kcu.constraint_name WHERE%s tc.table_name ILIKE '%s' AND tc.constraint_type ILIKE 'PRIMARY KEY' AND kcu.COLUMN_NAME ILIKE c.COLUMN_NAME GROUP BY tc.TABLE_SCHEMA, tc.TABLE_NAME, kcu.COLUMN_NAME), FALSE) AS primary_key FROM information_schema.columns c WHERE%s c.table_name ILIKE '%s'%s", tcSchema, table, cSchema, table, cColumns))
+	queryColumns, err := c.Db.QueryContext(ctx, fmt.Sprintf("SELECT c.column_name AS name, c.data_type AS type, COALESCE(c.column_default, 'NULL') AS default_value, CASE c.is_nullable WHEN 'YES' THEN true ELSE false END nullable, COALESCE((SELECT TRUE FROM information_schema.table_constraints tc LEFT JOIN information_schema.key_column_usage kcu ON tc.constraint_name = kcu.constraint_name WHERE%s tc.table_name ILIKE '%s' AND tc.constraint_type ILIKE 'PRIMARY KEY' AND kcu.COLUMN_NAME ILIKE c.COLUMN_NAME GROUP BY tc.TABLE_SCHEMA, tc.TABLE_NAME, kcu.COLUMN_NAME), FALSE) AS primary_key FROM information_schema.columns c WHERE%s c.table_name ILIKE '%s'%s", tcSchema, table, cSchema, table, cColumns))
 	if err != nil {
 		return columnsMetadata, err
 	}
@@ -128,10 +130,10 @@ func (c *PostgresClient) fetchColumnsMetadata(schema string, table string, colum
 	return columnsMetadata, nil
 }
 
-func (c *PostgresClient) getEnumValues(db *sql.DB, schema string, table string, column string) ([]string, error) {
+func (c *PostgresClient) getEnumValues(ctx context.Context, db *sql.DB, schema string, table string, column string) ([]string, error) {
 	result := []string{}
 
-	rows, err := db.Query(fmt.Sprintf("SELECT enumlabel FROM pg_enum WHERE enumtypid = (SELECT atttypid FROM pg_attribute WHERE attrelid = '%s.%s'::regclass AND attname = '%s')", schema, table, column))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT enumlabel FROM pg_enum WHERE enumtypid = (SELECT atttypid FROM pg_attribute WHERE attrelid = '%s.%s'::regclass AND attname = '%s')", schema, table, column))
 	if err != nil {
 		return result, err
 	}
@@ -148,7 +150,7 @@ func (c *PostgresClient) getEnumValues(db *sql.DB, schema string, table string,
 	return result, nil
 }
 
-func (c *PostgresClient) executeSelectQuery(query string, params QueryParams) (QueryResult, error) {
+func (c *PostgresClient) executeSelectQuery(ctx context.Context, query string, params QueryParams) (QueryResult, error) {
 	queryParts := strings.Split(query, " ")
 	table := queryParts[0]
 	tableParts := strings.Split(table, ".")
@@ -159,7 +161,21 @@ func (c *PostgresClient) executeSelectQuery(query string, params QueryParams) (Q
 		tableName = strings.ReplaceAll(tableParts[1], "`", "")
 	}
 
-	result, err := executeSelectQuery(c.Db, query, params)
+	info := tableInfo{schema: schema, name: tableName}
+	if params.Cursor != nil {
+		columnsMetadata, err := c.fetchColumnsMetadata(ctx, schema, tableName, []string{})
+		if err != nil {
+			return QueryResult{}, err
+		}
+		info.primaryKey = primaryKeyColumns(columnsMetadata)
+	}
+
+	var result QueryResult
+	err := c.withCancel(ctx, c.Limits, func(conn *sql.Conn) error {
+		var err error
+		result, err = executeSelectQuery(ctx, conn, postgresDialect, query, params, info, c.Limits)
+		return err
+	})
 	if err != nil {
 		return result, err
 	}
@@ -174,7 +190,7 @@ func (c *PostgresClient) executeSelectQuery(query string, params QueryParams) (Q
 		}
 	}
 
-	columnsMetadata, err := c.fetchColumnsMetadata(schema, tableName, columns)
+	columnsMetadata, err := c.fetchColumnsMetadata(ctx, schema, tableName, columns)
 	if err != nil {
 		return result, err
 	}
@@ -183,7 +199,7 @@ func (c *PostgresClient) executeSelectQuery(query string, params QueryParams) (Q
 	result.Enums = []EnumMetadata{}
 	for _, col := range columnsMetadata {
 		if col.Type == "USER-DEFINED" {
-			values, err := c.getEnumValues(c.Db, schema, tableName, col.Name)
+			values, err := c.getEnumValues(ctx, c.Db, schema, tableName, col.Name)
 			if err != nil {
 				return result, err
 			}
@@ -202,212 +218,388 @@ func (c *PostgresClient) executeSelectQuery(query string, params QueryParams) (Q
 	return result, err
 }
 
-func (c *PostgresClient) GetConnectionDatabases(params QueryParams) (QueryResult, error) {
+func (c *PostgresClient) withCancel(ctx context.Context, limits Limits, fn func(*sql.Conn) error) error {
+	// NOTE: apply the timeout here too so it also cancels the statement server side
+	ctx, cancel := limits.withTimeout(ctx)
+	defer cancel()
+
+	pidQuery, cancelQuery := postgresDialect.cancelQueries()
+	return withCancel(ctx, c.Db, pidQuery, cancelQuery, fn)
+}
+
+func (c *PostgresClient) GetConnectionDatabases(ctx context.Context, params QueryParams) (QueryResult, error) {
 	params.Columns = []string{"datname AS name"}
-	return c.executeSelectQuery("pg_database WHERE datistemplate = FALSE", params)
+	return c.executeSelectQuery(ctx, "pg_database WHERE datistemplate = FALSE", params)
 }
 
-func (c *PostgresClient) GetDatabaseSchemas(params QueryParams) (QueryResult, error) {
+func (c *PostgresClient) GetDatabaseSchemas(ctx context.Context, params QueryParams) (QueryResult, error) {
 	params.Columns = []string{"schema_name AS name"}
-	return c.executeSelectQuery("information_schema.schemata", params)
+	return c.executeSelectQuery(ctx, "information_schema.schemata", params)
 }
 
-func (c *PostgresClient) GetSchemaTables(params QueryParams, schema string) (QueryResult, error) {
+func (c *PostgresClient) GetSchemaTables(ctx context.Context, params QueryParams, schema string) (QueryResult, error) {
 	params.Columns = []string{"table_name"}
-	return c.executeSelectQuery(fmt.Sprintf("information_schema.tables WHERE table_schema = '%s'", schema), params)
+	return c.executeSelectQuery(ctx, fmt.Sprintf("information_schema.tables WHERE table_schema = '%s'", schema), params)
 }
 
-func (c *PostgresClient) GetTableRows(params QueryParams, schema string, table string) (QueryResult, error) {
-	return c.executeSelectQuery(fmt.Sprintf("%s.%s", schema, table), params)
+func (c *PostgresClient) GetTableRows(ctx context.Context, params QueryParams, schema string, table string) (QueryResult, error) {
+	return c.executeSelectQuery(ctx, fmt.Sprintf("%s.%s", schema, table), params)
 }
 
-func (c *PostgresClient) ExecuteQuery(query string) (QueryResult, error) {
-	return executeQuery(c.Db, query)
+func (c *PostgresClient) ExecuteQuery(ctx context.Context, query string) (QueryResult, error) {
+	var result QueryResult
+	err := c.withCancel(ctx, c.Limits, func(conn *sql.Conn) error {
+		var err error
+		result, err = executeQuery(ctx, conn, postgresDialect, query, c.Limits)
+		return err
+	})
+	return result, err
+}
+
+func (c *PostgresClient) ExecuteScript(ctx context.Context, script string, stopOnError bool) ([]ScriptResult, error) {
+	var results []ScriptResult
+	// NOTE: the limits apply to each statement, not to the whole script
+	err := c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		results = executeScript(ctx, conn, postgresDialect, script, stopOnError, c.Limits)
+		return nil
+	})
+	return results, err
 }
 
-func (c *PostgresClient) Execute(query string) error {
-	return execute(c.Db, query)
+func (c *PostgresClient) Execute(ctx context.Context, query string) error {
+	return c.withCancel(ctx, c.Limits, func(conn *sql.Conn) error {
+		return execute(ctx, conn, query, c.Limits)
+	})
 }
 
-func (c *PostgresClient) Export(options ExportOptions) (string, error) {
-	contents := ""
+func (c *PostgresClient) Export(ctx context.Context, w io.Writer, options ExportOptions) error {
+	// NOTE: exports are not subject to the connection limits
+	return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		if options.Type != SQL {
+			return exportData(ctx, conn, postgresDialect, w, options)
+		}
+
+		return dumpSQL(ctx, conn, postgresDialect, w, options, func(schema string, table string) (tableDDL, error) {
+			return c.tableDDL(ctx, schema, table)
+		})
+	})
+}
 
-	if options.WrapInTransaction {
-		contents += "BEGIN;\n"
+func (c *PostgresClient) ExportQuery(ctx context.Context, w io.Writer, query string, options ExportOptions) error {
+	return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		return exportQuery(ctx, conn, postgresDialect, w, query, options)
+	})
+}
+
+func (c *PostgresClient) Import(ctx context.Context, r io.Reader, options ImportOptions, onProgress func(ImportProgress)) error {
+	// NOTE: imports are not subject to the connection limits
+	return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		return importScript(ctx, conn, postgresDialect, r, options, onProgress)
+	})
+}
+
+func (c *PostgresClient) PreviewCSV(ctx context.Context, r io.Reader, options CSVImportOptions) (CSVPreview, error) {
+	tableColumns, err := c.fetchColumnsMetadata(ctx, options.Schema, options.Table, []string{})
+	if err != nil {
+		return CSVPreview{}, err
 	}
+	return previewCSV(r, options, tableColumns)
+}
 
-	currentTable := ""
-	currentTableMetadata := make([]ColumnMetadata, 0)
+func (c *PostgresClient) ImportCSV(ctx context.Context, r io.Reader, options CSVImportOptions, onProgress func(ImportProgress)) error {
+	tableColumns, err := c.fetchColumnsMetadata(ctx, options.Schema, options.Table, []string{})
+	if err != nil {
+		return err
+	}
+	return c.withCancel(ctx, Limits{}, func(conn *sql.Conn) error {
+		return importCSV(ctx, conn, postgresDialect, r, options, tableColumns, onProgress)
+	})
+}
 
-	tableColumnsMap := make(map[string][]string)
+func (c *PostgresClient) GetTableMetadata(ctx context.Context, schema string, table string) (TableMetadata, error) {
+	metadata := TableMetadata{Schema: schema, Name: table}
 
-	// NOTE: STEP 1 => Create tables
-	// TODO: refactor and use helper function to avoid duplicate code
-	if options.DropTable != DoNothing {
-		for i, entity := range options.Selected {
-			if strings.Count(entity, ".") == 0 {
-				// TODO: schema
-			}
-			if strings.Count(entity, ".") == 1 {
-				parts := strings.Split(entity, ".")
-				schema := parts[0]
-				table := parts[1]
-				if table != currentTable {
-					var err error
-					currentTableMetadata, err = c.fetchColumnsMetadata(schema, table, []string{}) // FIXME: do we have to specify columns here?
-					if err != nil {
-						return "", err
-					}
-					currentTable = table
-					tableColumnsMap[table] = make([]string, 0)
-				}
-				switch options.DropTable {
-				case DropAndCreate:
-					contents += fmt.Sprintf("DROP TABLE %s;\n", table)
-					contents += fmt.Sprintf("CREATE TABLE %s (\n", table)
-				case Create:
-					contents += fmt.Sprintf("CREATE TABLE %s (\n", table)
-				case CreateIfNotExists:
-					contents += fmt.Sprintf("CREATE IF NOT EXISTS TABLE %s (\n", table)
-				}
-			}
-			if strings.Count(entity, ".") == 2 {
-				parts := strings.Split(entity, ".")
-				schema := parts[0]
-				table := parts[1]
-				column := parts[2]
-				tableColumnsMap[table] = append(tableColumnsMap[table], column)
-				var currentColumn *ColumnMetadata = nil
-				for _, col := range currentTableMetadata {
-					if col.Name == column {
-						currentColumn = &col
-						break
-					}
-				}
-				if currentColumn == nil {
-					return "", fmt.Errorf("invalid column name: %s", entity)
-				}
-
-				nullable := ""
-				defaultValue := ""
-				primaryKey := ""
-				if !currentColumn.Nullable {
-					nullable = " NOT NULL"
-				}
-				if currentColumn.DefaultValue != "NULL" {
-					defaultValue = fmt.Sprintf(" DEFAULT %s", currentColumn.DefaultValue)
-				}
-				if currentColumn.PrimaryKey {
-					primaryKey = " PRIMARY KEY"
-				}
-				contents += fmt.Sprintf("    %s %s%s%s%s", currentColumn.Name, currentColumn.Type, nullable, defaultValue, primaryKey)
-				if i+1 < len(options.Selected) {
-					next := options.Selected[i+1]
-					// NOTE: only part differing from sqlite as we can use the schema here
-					if strings.HasPrefix(next, schema+"."+table+".") {
-						contents += ","
-					} else {
-						contents += "\n);"
-					}
-				} else {
-					contents += "\n);"
-				}
-				contents += "\n"
-			}
-		}
+	var err error
+	metadata.Columns, err = c.fetchColumnsMetadata(ctx, schema, table, []string{})
+	if err != nil {
+		return metadata, err
+	}
+	if len(metadata.Columns) == 0 {
+		return metadata, fmt.Errorf("%w %s.%s", errUnknownTable, schema, table)
+	}
+	err = declareTypes(ctx, c.Db, metadata.Columns, `SELECT a.attname, format_type(a.atttypid, a.atttypmod)
+FROM pg_attribute a
+JOIN pg_class t ON t.oid = a.attrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+WHERE n.nspname = $1 AND t.relname = $2 AND a.attnum > 0 AND NOT a.attisdropped`, schema, table)
+	if err != nil {
+		return metadata, err
 	}
 
-	// NOTE: STEP 2 => Insert data
-	// TODO: use helper function to avoid duplicate code
-	if !options.SchemaOnly {
-		contents += "\n"
-		for table, columns := range tableColumnsMap {
-			query := "SELECT "
-			for i, column := range columns {
-				query += fmt.Sprintf("\"%s\"", column)
-				if i+1 < len(columns) {
-					query += ", "
-				}
-			}
-			query += fmt.Sprintf(" FROM %s;", table)
-			result, err := c.ExecuteQuery(query)
-			if err != nil {
-				return "", err
-			}
-			if len(result.Rows) == 0 {
-				continue
-			}
+	rows, err := c.Db.QueryContext(ctx, `SELECT i.relname, ix.indisunique, ix.indisprimary, am.amname, pg_get_indexdef(ix.indexrelid, k, true)
+FROM pg_index ix
+JOIN pg_class i ON i.oid = ix.indexrelid
+JOIN pg_class t ON t.oid = ix.indrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_am am ON am.oid = i.relam
+CROSS JOIN generate_series(1, ix.indnkeyatts) AS k
+WHERE n.nspname = $1 AND t.relname = $2
+ORDER BY i.relname, k`, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Indexes, err = scanIndexes(rows)
+	if err != nil {
+		return metadata, err
+	}
 
-			contents += fmt.Sprintf("INSERT INTO %s (", table)
-			for i, column := range columns {
-				contents += fmt.Sprintf("\"%s\"", column)
-				if i+1 < len(columns) {
-					contents += ", "
-				}
-			}
-			contents += ") VALUES\n"
-
-			for i, row := range result.Rows {
-				contents += "    ("
-				for j, column := range columns {
-					value := row[column]
-					switch v := value.(type) {
-					case nil:
-						contents += "NULL"
-					case []byte:
-						// TODO: check type directly from column metadata to correctly add quotes
-						contents += fmt.Sprintf("'%s'", strings.ReplaceAll(string(v), "'", "''"))
-					case bool:
-						if v {
-							contents += "TRUE"
-						} else {
-							contents += "FALSE"
-						}
-					case int:
-						contents += fmt.Sprint(v)
-					case int64:
-						contents += fmt.Sprint(v)
-					case float64:
-						contents += fmt.Sprint(v)
-					case string:
-						contents += fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
-					case time.Time:
-						contents += fmt.Sprintf("'%s'", v.Format(time.RFC3339))
-					default:
-						return "", fmt.Errorf("invalid value type: %s (%s)", v, reflect.TypeOf(value))
-					}
-					if j+1 < len(columns) {
-						contents += ", "
-					} else {
-						contents += ")"
-					}
-				}
-				if i+1 < len(result.Rows) {
-					contents += ","
-				} else {
-					contents += ";"
-				}
-				contents += "\n"
-			}
-		}
+	rows, err = c.Db.QueryContext(ctx, `SELECT c.conname, a.attname, rn.nspname, rt.relname, ra.attname, `+postgresReferentialAction("c.confdeltype")+`, `+postgresReferentialAction("c.confupdtype")+`
+FROM pg_constraint c
+JOIN pg_class t ON t.oid = c.conrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_class rt ON rt.oid = c.confrelid
+JOIN pg_namespace rn ON rn.oid = rt.relnamespace
+CROSS JOIN unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, refattnum, position)
+JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refattnum
+WHERE c.contype = 'f' AND n.nspname = $1 AND t.relname = $2
+ORDER BY c.conname, k.position`, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.ForeignKeys, err = scanForeignKeys(rows)
+	if err != nil {
+		return metadata, err
+	}
+
+	rows, err = c.Db.QueryContext(ctx, `SELECT c.conname, pg_get_expr(c.conbin, c.conrelid, true)
+FROM pg_constraint c
+JOIN pg_class t ON t.oid = c.conrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+WHERE c.contype = 'c' AND n.nspname = $1 AND t.relname = $2
+ORDER BY c.conname`, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Checks, err = scanChecks(rows)
+	if err != nil {
+		return metadata, err
+	}
+
+	// NOTE: tgtype is a bit mask, 2 is BEFORE, 64 INSTEAD OF, then 4 INSERT, 8 DELETE, 16 UPDATE and 32 TRUNCATE
+	rows, err = c.Db.QueryContext(ctx, `SELECT tg.tgname,
+	CASE WHEN tg.tgtype::int & 2 > 0 THEN 'BEFORE' WHEN tg.tgtype::int & 64 > 0 THEN 'INSTEAD OF' ELSE 'AFTER' END,
+	concat_ws(' OR ',
+		CASE WHEN tg.tgtype::int & 4 > 0 THEN 'INSERT' END,
+		CASE WHEN tg.tgtype::int & 16 > 0 THEN 'UPDATE' END,
+		CASE WHEN tg.tgtype::int & 8 > 0 THEN 'DELETE' END,
+		CASE WHEN tg.tgtype::int & 32 > 0 THEN 'TRUNCATE' END),
+	pg_get_triggerdef(tg.oid, true)
+FROM pg_trigger tg
+JOIN pg_class t ON t.oid = tg.tgrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+WHERE NOT tg.tgisinternal AND n.nspname = $1 AND t.relname = $2
+ORDER BY tg.tgname`, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Triggers, err = scanTriggers(rows)
+	if err != nil {
+		return metadata, err
+	}
+
+	return metadata, nil
+}
 
-		contents += "\n"
+func postgresReferentialAction(column string) string {
+	return fmt.Sprintf("CASE %s WHEN 'r' THEN 'RESTRICT' WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' ELSE 'NO ACTION' END", column)
+}
+
+func (c *PostgresClient) GetSchemaMetadata(ctx context.Context, schema string) (SchemaMetadata, error) {
+	tables, err := queryStrings(ctx, c.Db, "SELECT table_name FROM information_schema.tables WHERE table_schema = $1 AND table_type = 'BASE TABLE' ORDER BY table_name", schema)
+	if err != nil {
+		return SchemaMetadata{}, err
 	}
 
-	if options.WrapInTransaction {
-		contents += "COMMIT;\n"
+	rows, err := c.Db.QueryContext(ctx, `SELECT c.relname, pg_get_viewdef(c.oid, true), c.relkind = 'm'
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('v', 'm') AND n.nspname = $1
+ORDER BY c.relname`, schema)
+	if err != nil {
+		return SchemaMetadata{}, err
+	}
+	views, err := scanViews(rows)
+	if err != nil {
+		return SchemaMetadata{}, err
 	}
 
-	return contents, nil
+	return schemaMetadata(ctx, schema, tables, views, c.GetTableMetadata)
 }
 
-func (c *PostgresClient) Import(contents string) error {
-	err := c.Execute(contents)
+func (c *PostgresClient) GetTableDDL(ctx context.Context, schema string, table string) (string, error) {
+	ddl, err := c.tableDDL(ctx, schema, table)
 	if err != nil {
-		if strings.Contains(contents, "BEGIN;") || strings.Contains(contents, "BEGIN TRANSACTION;") {
-			c.Execute("ROLLBACK;")
+		return "", err
+	}
+	return ddl.String(postgresDialect), nil
+}
+
+// setvalStatement moves the sequence to the highest value of the column, so
+// the next rows don't collide with the inserted ones. Nothing is done when
+// the table is empty.
+func setvalStatement(sequence string, table string, column string) string {
+	return fmt.Sprintf("SELECT setval(%s, MAX(%s)) FROM %s HAVING MAX(%s) IS NOT NULL", sequence, column, table, column)
+}
+
+// postgresSequenceOptions writes the options of the sequence s of pg_sequence
+// the way CREATE SEQUENCE takes them, but its type.
+const postgresSequenceOptions = `concat_ws(' ', 'INCREMENT BY ' || s.seqincrement, 'MINVALUE ' || s.seqmin, 'MAXVALUE ' || s.seqmax,
+	'START WITH ' || s.seqstart, 'CACHE ' || s.seqcache, CASE WHEN s.seqcycle THEN 'CYCLE' ELSE 'NO CYCLE' END)`
+
+// tableDDL rebuilds the table from the catalog the way pg_dump does: columns
+// with their collations, defaults, generated and identity clauses, then the
+// constraints, with foreign keys, indexes and triggers coming after.
+func (c *PostgresClient) tableDDL(ctx context.Context, schema string, table string) (tableDDL, error) {
+	var ddl tableDDL
+	name := postgresDialect.quoteIdentifier(schema) + "." + postgresDialect.quoteIdentifier(table)
+
+	var oid int64
+	err := c.Db.QueryRowContext(ctx, `SELECT c.oid FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('r', 'p')`, schema, table).Scan(&oid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ddl, fmt.Errorf("%w %s.%s", errUnknownTable, schema, table)
+	}
+	if err != nil {
+		return ddl, err
+	}
+
+	// NOTE: serial columns default to a sequence the table owns, it has to exist first
+	rows, err := c.Db.QueryContext(ctx, `SELECT quote_ident(sn.nspname) || '.' || quote_ident(sc.relname), quote_ident(a.attname),
+	format_type(s.seqtypid, NULL), `+postgresSequenceOptions+`
+FROM pg_depend dep
+JOIN pg_class sc ON sc.oid = dep.objid AND sc.relkind = 'S'
+JOIN pg_namespace sn ON sn.oid = sc.relnamespace
+JOIN pg_sequence s ON s.seqrelid = sc.oid
+JOIN pg_attribute a ON a.attrelid = dep.refobjid AND a.attnum = dep.refobjsubid
+WHERE dep.refobjid = $1 AND dep.classid = 'pg_class'::regclass AND dep.deptype = 'a'
+ORDER BY sc.relname`, oid)
+	if err != nil {
+		return ddl, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sequence, column, sequenceType, options string
+		err := rows.Scan(&sequence, &column, &sequenceType, &options)
+		if err != nil {
+			return ddl, err
 		}
-		return err
+		ddl.create = append(ddl.create, fmt.Sprintf("CREATE SEQUENCE %s AS %s %s", sequence, sequenceType, options))
+		ddl.after = append(ddl.after, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s", sequence, name, column))
+		ddl.sequences = append(ddl.sequences, setvalStatement(postgresDialect.quoteString(sequence), name, column))
+	}
+	if err := rows.Err(); err != nil {
+		return ddl, err
+	}
+
+	lines := make([]string, 0)
+	rows, err = c.Db.QueryContext(ctx, `SELECT a.attname, quote_ident(a.attname), format_type(a.atttypid, a.atttypmod),
+	COALESCE(CASE WHEN a.attcollation <> t.typcollation THEN quote_ident(cn.nspname) || '.' || quote_ident(co.collname) END, ''),
+	COALESCE(pg_get_expr(d.adbin, d.adrelid), ''), a.attgenerated::text, a.attidentity::text, a.attnotnull,
+	CASE WHEN s.seqrelid IS NOT NULL THEN `+postgresSequenceOptions+` ELSE '' END
+FROM pg_attribute a
+JOIN pg_type t ON t.oid = a.atttypid
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+LEFT JOIN pg_collation co ON co.oid = a.attcollation
+LEFT JOIN pg_namespace cn ON cn.oid = co.collnamespace
+LEFT JOIN pg_depend dep ON dep.refobjid = a.attrelid AND dep.refobjsubid = a.attnum AND dep.classid = 'pg_class'::regclass AND dep.deptype = 'i'
+LEFT JOIN pg_sequence s ON s.seqrelid = dep.objid
+WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, oid)
+	if err != nil {
+		return ddl, err
 	}
-	return nil
+	defer rows.Close()
+	for rows.Next() {
+		var columnName, column, columnType, collation, expression, generated, identity, options string
+		var notNull bool
+		err := rows.Scan(&columnName, &column, &columnType, &collation, &expression, &generated, &identity, &notNull, &options)
+		if err != nil {
+			return ddl, err
+		}
+		line := column + " " + columnType
+		if collation != "" {
+			line += " COLLATE " + collation
+		}
+		switch {
+		case generated == "s":
+			line += " GENERATED ALWAYS AS (" + expression + ") STORED"
+			ddl.generated = append(ddl.generated, columnName)
+		case expression != "":
+			line += " DEFAULT " + expression
+		}
+		if notNull {
+			line += " NOT NULL"
+		}
+		switch identity {
+		case "a":
+			line += " GENERATED ALWAYS AS IDENTITY (" + options + ")"
+			ddl.overriding = true
+		case "d":
+			line += " GENERATED BY DEFAULT AS IDENTITY (" + options + ")"
+		}
+		if identity != "" {
+			// NOTE: the restored table names its identity sequence itself
+			sequence := fmt.Sprintf("pg_get_serial_sequence(%s, %s)", postgresDialect.quoteString(name), postgresDialect.quoteString(columnName))
+			ddl.sequences = append(ddl.sequences, setvalStatement(sequence, name, column))
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return ddl, err
+	}
+
+	rows, err = c.Db.QueryContext(ctx, `SELECT quote_ident(conname), pg_get_constraintdef(oid), contype = 'f'
+FROM pg_constraint
+WHERE conrelid = $1 AND contype IN ('p', 'u', 'c', 'x', 'f') AND conislocal
+ORDER BY contype = 'f', contype <> 'p', conname`, oid)
+	if err != nil {
+		return ddl, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var constraint, definition string
+		var foreignKey bool
+		err := rows.Scan(&constraint, &definition, &foreignKey)
+		if err != nil {
+			return ddl, err
+		}
+		if foreignKey {
+			ddl.after = append(ddl.after, fmt.Sprintf("ALTER TABLE ONLY %s ADD CONSTRAINT %s %s", name, constraint, definition))
+			continue
+		}
+		lines = append(lines, "CONSTRAINT "+constraint+" "+definition)
+	}
+	if err := rows.Err(); err != nil {
+		return ddl, err
+	}
+	ddl.create = append(ddl.create, fmt.Sprintf("CREATE TABLE %s (\n    %s\n)", name, strings.Join(lines, ",\n    ")))
+
+	// NOTE: indexes backing a constraint come with it
+	indexes, err := queryStrings(ctx, c.Db, `SELECT pg_get_indexdef(i.indexrelid)
+FROM pg_index i
+JOIN pg_class ic ON ic.oid = i.indexrelid
+WHERE i.indrelid = $1 AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conrelid = i.indrelid AND c.conindid = i.indexrelid AND c.contype IN ('p', 'u', 'x'))
+ORDER BY ic.relname`, oid)
+	if err != nil {
+		return ddl, err
+	}
+	ddl.after = append(ddl.after, indexes...)
+
+	triggers, err := queryStrings(ctx, c.Db, "SELECT pg_get_triggerdef(oid) FROM pg_trigger WHERE tgrelid = $1 AND NOT tgisinternal ORDER BY tgname", oid)
+	if err != nil {
+		return ddl, err
+	}
+	ddl.after = append(ddl.after, triggers...)
+
+	return ddl, nil
 }
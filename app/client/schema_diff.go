@@ -0,0 +1,541 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type DiffKind string
+
+const (
+	Added   DiffKind = "added"   // only in the source, the migration creates it
+	Removed DiffKind = "removed" // only in the target, the migration drops it
+	Changed DiffKind = "changed"
+)
+
+var DiffKinds = []struct {
+	Value  DiffKind
+	TSName string
+}{
+	{Added, "Added"},
+	{Removed, "Removed"},
+	{Changed, "Changed"},
+}
+
+type ColumnDiff struct {
+	Name    string          `json:"name"`
+	Kind    DiffKind        `json:"kind"`
+	Source  *ColumnMetadata `json:"source"`
+	Target  *ColumnMetadata `json:"target"`
+	Changes []string        `json:"changes"` // type, default, nullable or primary key
+}
+
+type IndexDiff struct {
+	Name   string         `json:"name"`
+	Kind   DiffKind       `json:"kind"`
+	Source *IndexMetadata `json:"source"`
+	Target *IndexMetadata `json:"target"`
+}
+
+type ForeignKeyDiff struct {
+	Name   string              `json:"name"`
+	Kind   DiffKind            `json:"kind"`
+	Source *ForeignKeyMetadata `json:"source"`
+	Target *ForeignKeyMetadata `json:"target"`
+}
+
+type TableDiff struct {
+	Name        string           `json:"name"`
+	Kind        DiffKind         `json:"kind"`
+	Source      *TableMetadata   `json:"source"`
+	Target      *TableMetadata   `json:"target"`
+	Columns     []ColumnDiff     `json:"columns"`
+	Indexes     []IndexDiff      `json:"indexes"`
+	ForeignKeys []ForeignKeyDiff `json:"foreign_keys"`
+}
+
+// SchemaDiff lists what differs between two schemas, Migration being the
+// script bringing the target in line with the source.
+type SchemaDiff struct {
+	Source    string      `json:"source"`
+	Target    string      `json:"target"`
+	Tables    []TableDiff `json:"tables"`
+	Migration string      `json:"migration"`
+}
+
+// DiffSchemas compares two schemas, of the same connection or not, the
+// migration is written for the target database.
+func DiffSchemas(ctx context.Context, source DatabaseClient, sourceSchema string, target DatabaseClient, targetSchema string) (SchemaDiff, error) {
+	sourceMetadata, err := source.GetSchemaMetadata(ctx, sourceSchema)
+	if err != nil {
+		return SchemaDiff{}, err
+	}
+	targetMetadata, err := target.GetSchemaMetadata(ctx, targetSchema)
+	if err != nil {
+		return SchemaDiff{}, err
+	}
+
+	diff := diffSchemas(sourceMetadata, targetMetadata)
+	diff.Migration = migrationScript(dialectOf(target), diff)
+	return diff, nil
+}
+
+func diffSchemas(source SchemaMetadata, target SchemaMetadata) SchemaDiff {
+	diff := SchemaDiff{Source: source.Name, Target: target.Name, Tables: make([]TableDiff, 0)}
+
+	targetTables := make(map[string]*TableMetadata)
+	for i := range target.Tables {
+		targetTables[target.Tables[i].Name] = &target.Tables[i]
+	}
+	for i := range source.Tables {
+		s := &source.Tables[i]
+		t, exists := targetTables[s.Name]
+		if !exists {
+			diff.Tables = append(diff.Tables, TableDiff{Name: s.Name, Kind: Added, Source: s})
+			continue
+		}
+		delete(targetTables, s.Name)
+		if tableDiff := diffTables(s, t); tableDiff.Kind == Changed {
+			diff.Tables = append(diff.Tables, tableDiff)
+		}
+	}
+	for i := range target.Tables {
+		t := &target.Tables[i]
+		if _, removed := targetTables[t.Name]; removed {
+			diff.Tables = append(diff.Tables, TableDiff{Name: t.Name, Kind: Removed, Target: t})
+		}
+	}
+
+	return diff
+}
+
+// diffTables compares two tables of the same name, the diff is only of kind
+// Changed when something differs.
+func diffTables(source *TableMetadata, target *TableMetadata) TableDiff {
+	diff := TableDiff{Name: source.Name, Source: source, Target: target}
+
+	diff.Columns = diffByKey(source.Columns, target.Columns,
+		func(c ColumnMetadata) string { return c.Name },
+		func(name string, kind DiffKind, s *ColumnMetadata, t *ColumnMetadata) (ColumnDiff, bool) {
+			d := ColumnDiff{Name: name, Kind: kind, Source: s, Target: t}
+			if kind == Changed {
+				d.Changes = columnChanges(*s, *t)
+			}
+			return d, kind != Changed || len(d.Changes) > 0
+		})
+	diff.Indexes = diffByKey(source.Indexes, target.Indexes, indexKey,
+		func(_ string, kind DiffKind, s *IndexMetadata, t *IndexMetadata) (IndexDiff, bool) {
+			name := ""
+			if s != nil {
+				name = s.Name
+			} else {
+				name = t.Name
+			}
+			changed := kind != Changed || s.Unique != t.Unique || s.Method != t.Method || !slices.Equal(s.Columns, t.Columns)
+			return IndexDiff{Name: name, Kind: kind, Source: s, Target: t}, changed
+		})
+	// NOTE: foreign keys are told apart by what they link, sqlite doesn't name them and generated names differ between databases
+	diff.ForeignKeys = diffByKey(source.ForeignKeys, target.ForeignKeys, foreignKeyKey,
+		func(_ string, kind DiffKind, s *ForeignKeyMetadata, t *ForeignKeyMetadata) (ForeignKeyDiff, bool) {
+			name := ""
+			if s != nil {
+				name = s.Name
+			} else {
+				name = t.Name
+			}
+			changed := kind != Changed || s.OnDelete != t.OnDelete || s.OnUpdate != t.OnUpdate
+			return ForeignKeyDiff{Name: name, Kind: kind, Source: s, Target: t}, changed
+		})
+
+	if len(diff.Columns) > 0 || len(diff.Indexes) > 0 || len(diff.ForeignKeys) > 0 {
+		diff.Kind = Changed
+	}
+	return diff
+}
+
+// diffByKey matches source and target items by key, in source order then
+// target order, and keeps the diffs compare reports as changed.
+func diffByKey[T any, D any](source []T, target []T, key func(T) string, compare func(string, DiffKind, *T, *T) (D, bool)) []D {
+	diffs := make([]D, 0)
+
+	targets := make(map[string]*T)
+	for i := range target {
+		targets[key(target[i])] = &target[i]
+	}
+	for i := range source {
+		k := key(source[i])
+		kind := Changed
+		t, exists := targets[k]
+		if !exists {
+			kind = Added
+		}
+		delete(targets, k)
+		if d, changed := compare(k, kind, &source[i], t); changed {
+			diffs = append(diffs, d)
+		}
+	}
+	for i := range target {
+		k := key(target[i])
+		if _, removed := targets[k]; removed {
+			d, _ := compare(k, Removed, nil, &target[i])
+			diffs = append(diffs, d)
+		}
+	}
+
+	return diffs
+}
+
+// sequenceDefault reads the sequence of a postgres nextval default, schema
+// being empty when postgres didn't qualify it (it is on the search path).
+func sequenceDefault(value string) (schema string, sequence string, ok bool) {
+	inner, found := strings.CutPrefix(value, "nextval('")
+	if !found {
+		return "", "", false
+	}
+	inner, found = strings.CutSuffix(inner, "'::regclass)")
+	if !found {
+		return "", "", false
+	}
+	quoted := false
+	dot := -1
+	for i, c := range inner {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '.' && !quoted:
+			dot = i
+		}
+	}
+	if dot == -1 {
+		return "", inner, true
+	}
+	return inner[:dot], inner[dot+1:], true
+}
+
+// comparableDefault drops the schema of the sequences, so serial columns of
+// two schemas of the same database compare equal.
+func comparableDefault(value string) string {
+	if _, sequence, ok := sequenceDefault(value); ok {
+		return "nextval('" + sequence + "'::regclass)"
+	}
+	return value
+}
+
+func columnChanges(source ColumnMetadata, target ColumnMetadata) []string {
+	changes := make([]string, 0)
+	if !strings.EqualFold(source.Type, target.Type) {
+		changes = append(changes, "type")
+	}
+	if comparableDefault(source.DefaultValue) != comparableDefault(target.DefaultValue) {
+		changes = append(changes, "default")
+	}
+	if source.Nullable != target.Nullable {
+		changes = append(changes, "nullable")
+	}
+	if source.PrimaryKey != target.PrimaryKey {
+		changes = append(changes, "primary key")
+	}
+	return changes
+}
+
+// indexKey matches primary keys whatever their name, each database naming them its own way.
+func indexKey(index IndexMetadata) string {
+	if index.Primary {
+		return "PRIMARY KEY"
+	}
+	return index.Name
+}
+
+func foreignKeyKey(foreignKey ForeignKeyMetadata) string {
+	return fmt.Sprintf("(%s) %s(%s)", strings.Join(foreignKey.Columns, ", "), foreignKey.ReferencedTable, strings.Join(foreignKey.ReferencedColumns, ", "))
+}
+
+// migration writes the statements of a migration script, grouped so that
+// nothing is created before what it depends on or dropped after.
+type migration struct {
+	dialect dialect
+	source  string
+	target  string
+
+	dropForeignKeys []string
+	dropIndexes     []string
+	dropTables      []string
+	createTables    []string
+	alterColumns    []string
+	createIndexes   []string
+	addForeignKeys  []string
+}
+
+// migrationScript writes the statements bringing the target schema in line
+// with the source, what the dialect can't alter in place is left as a comment.
+func migrationScript(d dialect, diff SchemaDiff) string {
+	m := &migration{dialect: d, source: diff.Source, target: diff.Target}
+
+	for _, table := range diff.Tables {
+		switch table.Kind {
+		case Added:
+			m.createTable(*table.Source)
+		case Removed:
+			m.dropTables = append(m.dropTables, "DROP TABLE "+m.table(table.Name))
+		case Changed:
+			for _, column := range table.Columns {
+				m.alterColumn(table.Name, column)
+			}
+			for _, index := range table.Indexes {
+				if index.Target != nil && index.Kind != Added {
+					m.dropIndex(table.Name, *index.Target)
+				}
+				if index.Source != nil && index.Kind != Removed {
+					m.createIndex(table.Name, *index.Source)
+				}
+			}
+			for _, foreignKey := range table.ForeignKeys {
+				if foreignKey.Target != nil && foreignKey.Kind != Added {
+					m.dropForeignKey(table.Name, *foreignKey.Target)
+				}
+				if foreignKey.Source != nil && foreignKey.Kind != Removed {
+					m.addForeignKey(table.Name, *foreignKey.Source)
+				}
+			}
+		}
+	}
+
+	if len(diff.Tables) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("-- Migration of %s to match %s, review it before running it\n", diff.Target, diff.Source))
+	for _, steps := range [][]string{m.dropForeignKeys, m.dropIndexes, m.dropTables, m.createTables, m.alterColumns, m.createIndexes, m.addForeignKeys} {
+		for _, statement := range steps {
+			if strings.HasPrefix(statement, "--") {
+				b.WriteString(statement + "\n")
+				continue
+			}
+			b.WriteString(statement + ";\n")
+		}
+	}
+	return b.String()
+}
+
+func (m *migration) q(name string) string {
+	return m.dialect.quoteIdentifier(name)
+}
+
+// table qualifies a table with the target schema, sqlite having a single one.
+func (m *migration) table(name string) string {
+	if m.dialect == sqliteDialect {
+		return m.q(name)
+	}
+	return m.q(m.target) + "." + m.q(name)
+}
+
+func (m *migration) columns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = m.q(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// defaultValue returns a column default as SQL, mysql reports string
+// defaults without their quotes.
+func (m *migration) defaultValue(value string) string {
+	if m.dialect != mysqlDialect || strings.HasPrefix(value, "'") || strings.HasPrefix(value, "(") || isJSONNumber([]byte(value)) {
+		return value
+	}
+	if strings.HasPrefix(strings.ToUpper(value), "CURRENT_") {
+		return value
+	}
+	return m.dialect.quoteString(value)
+}
+
+func (m *migration) columnDefinition(column ColumnMetadata) string {
+	definition := m.q(column.Name) + " " + column.Type
+	defaultValue := column.DefaultValue
+	// NOTE: serial columns default to a sequence the target doesn't have
+	if m.dialect == postgresDialect && strings.HasPrefix(defaultValue, "nextval(") {
+		switch strings.ToLower(column.Type) {
+		case "smallint":
+			definition = m.q(column.Name) + " smallserial"
+			defaultValue = "NULL"
+		case "integer":
+			definition = m.q(column.Name) + " serial"
+			defaultValue = "NULL"
+		case "bigint":
+			definition = m.q(column.Name) + " bigserial"
+			defaultValue = "NULL"
+		}
+	}
+	if defaultValue != "NULL" && defaultValue != "" {
+		definition += " DEFAULT " + m.defaultValue(defaultValue)
+	}
+	if !column.Nullable {
+		definition += " NOT NULL"
+	}
+	return definition
+}
+
+func (m *migration) createTable(table TableMetadata) {
+	lines := make([]string, 0, len(table.Columns)+1)
+	for _, column := range table.Columns {
+		lines = append(lines, m.columnDefinition(column))
+	}
+
+	primaryKey := primaryKeyColumns(table.Columns)
+	for _, index := range table.Indexes {
+		switch {
+		case index.Primary:
+			primaryKey = index.Columns
+		case m.dialect == sqliteDialect && strings.HasPrefix(index.Name, "sqlite_autoindex_"):
+			// NOTE: sqlite creates these for UNIQUE constraints, they can't be created by name
+			lines = append(lines, fmt.Sprintf("UNIQUE (%s)", m.columns(index.Columns)))
+		default:
+			m.createIndex(table.Name, index)
+		}
+	}
+	if len(primaryKey) > 0 {
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY (%s)", m.columns(primaryKey)))
+	}
+
+	for _, foreignKey := range table.ForeignKeys {
+		if m.dialect == sqliteDialect {
+			// NOTE: sqlite can't add a foreign key to an existing table
+			lines = append(lines, m.foreignKeyDefinition(foreignKey))
+			continue
+		}
+		m.addForeignKey(table.Name, foreignKey)
+	}
+
+	m.createTables = append(m.createTables, fmt.Sprintf("CREATE TABLE %s (\n    %s\n)", m.table(table.Name), strings.Join(lines, ",\n    ")))
+}
+
+func (m *migration) alterColumn(table string, column ColumnDiff) {
+	switch {
+	case column.Kind == Added:
+		m.alterColumns = append(m.alterColumns, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", m.table(table), m.columnDefinition(*column.Source)))
+	case column.Kind == Removed:
+		m.alterColumns = append(m.alterColumns, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", m.table(table), m.q(column.Name)))
+	case m.dialect == sqliteDialect:
+		m.alterColumns = append(m.alterColumns, fmt.Sprintf("-- sqlite can't alter %s.%s (%s), the table has to be rebuilt", table, column.Name, strings.Join(column.Changes, ", ")))
+	case slices.Equal(column.Changes, []string{"primary key"}):
+		// NOTE: primary keys are migrated with the indexes
+	case m.dialect == mysqlDialect:
+		m.alterColumns = append(m.alterColumns, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", m.table(table), m.columnDefinition(*column.Source)))
+	default:
+		prefix := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", m.table(table), m.q(column.Name))
+		for _, change := range column.Changes {
+			switch {
+			case change == "type":
+				m.alterColumns = append(m.alterColumns, prefix+"TYPE "+column.Source.Type)
+			case change == "default" && column.Source.DefaultValue == "NULL":
+				m.alterColumns = append(m.alterColumns, prefix+"DROP DEFAULT")
+			case change == "default":
+				// NOTE: the source sequence belongs to the source schema, the target gets its own
+				if _, sequence, ok := sequenceDefault(column.Source.DefaultValue); ok {
+					sequence = m.q(m.target) + "." + sequence
+					m.alterColumns = append(m.alterColumns, fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s OWNED BY %s.%s", sequence, m.table(table), m.q(column.Name)))
+					m.alterColumns = append(m.alterColumns, prefix+"SET DEFAULT nextval("+m.dialect.quoteString(sequence)+"::regclass)")
+					continue
+				}
+				m.alterColumns = append(m.alterColumns, prefix+"SET DEFAULT "+column.Source.DefaultValue)
+			case change == "nullable" && column.Source.Nullable:
+				m.alterColumns = append(m.alterColumns, prefix+"DROP NOT NULL")
+			case change == "nullable":
+				m.alterColumns = append(m.alterColumns, prefix+"SET NOT NULL")
+			}
+		}
+	}
+}
+
+func (m *migration) createIndex(table string, index IndexMetadata) {
+	if index.Primary {
+		if m.dialect == sqliteDialect {
+			m.createIndexes = append(m.createIndexes, fmt.Sprintf("-- sqlite can't change the primary key of %s, the table has to be rebuilt", table))
+			return
+		}
+		m.createIndexes = append(m.createIndexes, fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", m.table(table), m.columns(index.Columns)))
+		return
+	}
+	if slices.Contains(index.Columns, expressionColumn) || m.dialect == sqliteDialect && strings.HasPrefix(index.Name, "sqlite_autoindex_") {
+		m.createIndexes = append(m.createIndexes, fmt.Sprintf("-- index %s of %s can't be recreated from its metadata", index.Name, table))
+		return
+	}
+
+	// NOTE: postgres reports index columns as SQL, quoted when needed or as expressions
+	columns := strings.Join(index.Columns, ", ")
+	using := ""
+	if m.dialect == postgresDialect {
+		if index.Method != "" && index.Method != "btree" {
+			using = " USING " + index.Method
+		}
+	} else {
+		columns = m.columns(index.Columns)
+	}
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	m.createIndexes = append(m.createIndexes, fmt.Sprintf("CREATE %sINDEX %s ON %s%s (%s)", unique, m.q(index.Name), m.table(table), using, columns))
+}
+
+func (m *migration) dropIndex(table string, index IndexMetadata) {
+	switch {
+	case index.Primary && m.dialect == sqliteDialect:
+		// NOTE: reported when the primary key is created
+	case index.Primary && m.dialect == mysqlDialect:
+		m.dropIndexes = append(m.dropIndexes, fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY", m.table(table)))
+	case index.Primary:
+		m.dropIndexes = append(m.dropIndexes, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", m.table(table), m.q(index.Name)))
+	case m.dialect == sqliteDialect && strings.HasPrefix(index.Name, "sqlite_autoindex_"):
+		m.dropIndexes = append(m.dropIndexes, fmt.Sprintf("-- sqlite can't drop the UNIQUE constraint behind %s, the table has to be rebuilt", index.Name))
+	case m.dialect == mysqlDialect:
+		m.dropIndexes = append(m.dropIndexes, fmt.Sprintf("DROP INDEX %s ON %s", m.q(index.Name), m.table(table)))
+	case m.dialect == postgresDialect:
+		m.dropIndexes = append(m.dropIndexes, fmt.Sprintf("DROP INDEX %s.%s", m.q(m.target), m.q(index.Name)))
+	default:
+		m.dropIndexes = append(m.dropIndexes, "DROP INDEX "+m.q(index.Name))
+	}
+}
+
+func (m *migration) foreignKeyDefinition(foreignKey ForeignKeyMetadata) string {
+	referenced := m.q(foreignKey.ReferencedTable)
+	if m.dialect != sqliteDialect {
+		schema := foreignKey.ReferencedSchema
+		if schema == m.source {
+			schema = m.target
+		}
+		referenced = m.q(schema) + "." + referenced
+	}
+	definition := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)", m.columns(foreignKey.Columns), referenced, m.columns(foreignKey.ReferencedColumns))
+	if foreignKey.OnDelete != "" {
+		definition += " ON DELETE " + foreignKey.OnDelete
+	}
+	if foreignKey.OnUpdate != "" {
+		definition += " ON UPDATE " + foreignKey.OnUpdate
+	}
+	if foreignKey.Name != "" {
+		definition = "CONSTRAINT " + m.q(foreignKey.Name) + " " + definition
+	}
+	return definition
+}
+
+func (m *migration) addForeignKey(table string, foreignKey ForeignKeyMetadata) {
+	if m.dialect == sqliteDialect {
+		m.addForeignKeys = append(m.addForeignKeys, fmt.Sprintf("-- sqlite can't add a foreign key to %s, the table has to be rebuilt", table))
+		return
+	}
+	m.addForeignKeys = append(m.addForeignKeys, fmt.Sprintf("ALTER TABLE %s ADD %s", m.table(table), m.foreignKeyDefinition(foreignKey)))
+}
+
+func (m *migration) dropForeignKey(table string, foreignKey ForeignKeyMetadata) {
+	switch m.dialect {
+	case sqliteDialect:
+		m.dropForeignKeys = append(m.dropForeignKeys, fmt.Sprintf("-- sqlite can't drop a foreign key of %s, the table has to be rebuilt", table))
+	case mysqlDialect:
+		m.dropForeignKeys = append(m.dropForeignKeys, fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", m.table(table), m.q(foreignKey.Name)))
+	default:
+		m.dropForeignKeys = append(m.dropForeignKeys, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", m.table(table), m.q(foreignKey.Name)))
+	}
+}
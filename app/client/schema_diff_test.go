@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	open := func(schema string) *SqliteClient {
+		db, err := sql.Open("sqlite3", ":memory:")
+		r.NoError(err)
+		t.Cleanup(func() { db.Close() })
+		db.SetMaxOpenConns(1)
+		_, err = db.Exec(schema)
+		r.NoError(err)
+		return &SqliteClient{Db: db}
+	}
+
+	source := open(`
+CREATE TABLE author (id INTEGER PRIMARY KEY, name TEXT NOT NULL, bio TEXT DEFAULT '');
+CREATE INDEX author_name ON author (name);
+CREATE TABLE book (id INTEGER PRIMARY KEY, author_id INTEGER REFERENCES author (id) ON DELETE CASCADE, title TEXT UNIQUE);
+`)
+	target := open(`
+CREATE TABLE author (id INTEGER PRIMARY KEY, name VARCHAR(10), legacy INTEGER);
+CREATE INDEX author_legacy ON author (legacy);
+CREATE TABLE old (id INTEGER);
+`)
+
+	diff, err := DiffSchemas(ctx, source, "main", target, "main")
+	r.NoError(err)
+	r.Len(diff.Tables, 3)
+
+	author := diff.Tables[0]
+	r.Equal("author", author.Name)
+	r.Equal(Changed, author.Kind)
+	r.Len(author.Columns, 3)
+	r.Equal(ColumnDiff{Name: "name", Kind: Changed, Source: &author.Source.Columns[1], Target: &author.Target.Columns[1], Changes: []string{"type", "nullable"}}, author.Columns[0])
+	r.Equal(Added, author.Columns[1].Kind)
+	r.Equal("bio", author.Columns[1].Name)
+	r.Equal(Removed, author.Columns[2].Kind)
+	r.Equal("legacy", author.Columns[2].Name)
+	r.Len(author.Indexes, 2)
+	r.Equal(Added, author.Indexes[0].Kind)
+	r.Equal(Removed, author.Indexes[1].Kind)
+
+	r.Equal(TableDiff{Name: "book", Kind: Added, Source: diff.Tables[1].Source}, diff.Tables[1])
+	r.Equal(Removed, diff.Tables[2].Kind)
+
+	r.Equal(`-- Migration of main to match main, review it before running it
+DROP INDEX "author_legacy";
+DROP TABLE "old";
+CREATE TABLE "book" (
+    "id" INTEGER,
+    "author_id" INTEGER,
+    "title" TEXT,
+    UNIQUE ("title"),
+    PRIMARY KEY ("id"),
+    FOREIGN KEY ("author_id") REFERENCES "author" ("id") ON DELETE CASCADE ON UPDATE NO ACTION
+);
+-- sqlite can't alter author.name (type, nullable), the table has to be rebuilt
+ALTER TABLE "author" ADD COLUMN "bio" TEXT DEFAULT '';
+ALTER TABLE "author" DROP COLUMN "legacy";
+CREATE INDEX "author_name" ON "author" ("name");
+`, diff.Migration)
+
+	_, err = target.Db.Exec(diff.Migration)
+	r.NoError(err, "Expected the migration to run")
+	diff, err = DiffSchemas(ctx, source, "main", target, "main")
+	r.NoError(err)
+	r.Len(diff.Tables, 1, "Expected only what sqlite can't alter to be left")
+	r.Equal([]string{"type", "nullable"}, diff.Tables[0].Columns[0].Changes)
+
+	diff, err = DiffSchemas(ctx, source, "main", source, "main")
+	r.NoError(err)
+	r.Empty(diff.Tables)
+	r.Empty(diff.Migration)
+}
+
+func TestMigrationScript(t *testing.T) {
+	source := SchemaMetadata{Name: "prod", Tables: []TableMetadata{{
+		Name: "t",
+		Columns: []ColumnMetadata{
+			{Name: "id", Type: "integer", DefaultValue: "nextval('t_id_seq'::regclass)", PrimaryKey: true},
+			{Name: "status", Type: "varchar(10)", DefaultValue: "'new'::character varying", Nullable: true},
+			{Name: "parent_id", Type: "integer", DefaultValue: "NULL", Nullable: true},
+		},
+		Indexes:     []IndexMetadata{{Name: "t_pkey", Columns: []string{"id"}, Unique: true, Primary: true, Method: "btree"}, {Name: "t_status", Columns: []string{"lower(status)"}, Method: "hash"}},
+		ForeignKeys: []ForeignKeyMetadata{{Name: "t_parent", Columns: []string{"parent_id"}, ReferencedSchema: "prod", ReferencedTable: "t", ReferencedColumns: []string{"id"}, OnDelete: "SET NULL", OnUpdate: "NO ACTION"}},
+	}}}
+	target := SchemaMetadata{Name: "staging", Tables: []TableMetadata{{
+		Name: "t",
+		Columns: []ColumnMetadata{
+			{Name: "id", Type: "integer", DefaultValue: "nextval('t_id_seq'::regclass)", PrimaryKey: true},
+			{Name: "status", Type: "varchar(5)", DefaultValue: "NULL"},
+		},
+		Indexes: []IndexMetadata{{Name: "t_pkey", Columns: []string{"id"}, Unique: true, Primary: true, Method: "btree"}},
+	}}}
+
+	testCases := []struct {
+		name     string
+		dialect  dialect
+		source   SchemaMetadata
+		target   SchemaMetadata
+		expected string
+	}{
+		{"Postgres", postgresDialect, source, target, `-- Migration of staging to match prod, review it before running it
+ALTER TABLE "staging"."t" ALTER COLUMN "status" TYPE varchar(10);
+ALTER TABLE "staging"."t" ALTER COLUMN "status" SET DEFAULT 'new'::character varying;
+ALTER TABLE "staging"."t" ALTER COLUMN "status" DROP NOT NULL;
+ALTER TABLE "staging"."t" ADD COLUMN "parent_id" integer;
+CREATE INDEX "t_status" ON "staging"."t" USING hash (lower(status));
+ALTER TABLE "staging"."t" ADD CONSTRAINT "t_parent" FOREIGN KEY ("parent_id") REFERENCES "staging"."t" ("id") ON DELETE SET NULL ON UPDATE NO ACTION;
+`},
+		{"Postgres new table", postgresDialect, source, SchemaMetadata{Name: "staging"}, `-- Migration of staging to match prod, review it before running it
+CREATE TABLE "staging"."t" (
+    "id" serial NOT NULL,
+    "status" varchar(10) DEFAULT 'new'::character varying,
+    "parent_id" integer,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "t_status" ON "staging"."t" USING hash (lower(status));
+ALTER TABLE "staging"."t" ADD CONSTRAINT "t_parent" FOREIGN KEY ("parent_id") REFERENCES "staging"."t" ("id") ON DELETE SET NULL ON UPDATE NO ACTION;
+`},
+		{"MySQL", mysqlDialect, target, source, "-- Migration of prod to match staging, review it before running it\n" +
+			"ALTER TABLE `prod`.`t` DROP FOREIGN KEY `t_parent`;\n" +
+			"DROP INDEX `t_status` ON `prod`.`t`;\n" +
+			"ALTER TABLE `prod`.`t` MODIFY COLUMN `status` varchar(5) NOT NULL;\n" +
+			"ALTER TABLE `prod`.`t` DROP COLUMN `parent_id`;\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			r.Equal(tc.expected, migrationScript(tc.dialect, diffSchemas(tc.source, tc.target)))
+		})
+	}
+}
+
+func TestSequenceDefaults(t *testing.T) {
+	r := require.New(t)
+	table := func(schema string, defaultValue string) SchemaMetadata {
+		return SchemaMetadata{Name: schema, Tables: []TableMetadata{{
+			Name:    "t",
+			Columns: []ColumnMetadata{{Name: "id", Type: "integer", DefaultValue: defaultValue, PrimaryKey: true}},
+		}}}
+	}
+
+	diff := diffSchemas(table("src", "nextval('src.t_id_seq'::regclass)"), table("dst", "nextval('dst.t_id_seq'::regclass)"))
+	r.Empty(diff.Tables, "Expected the sequences of both schemas to compare equal")
+	diff = diffSchemas(table("public", "nextval('t_id_seq'::regclass)"), table("dst", `nextval('"Dst.Schema".t_id_seq'::regclass)`))
+	r.Empty(diff.Tables)
+
+	r.Equal(`-- Migration of dst to match src, review it before running it
+CREATE SEQUENCE IF NOT EXISTS "dst".t_id_seq OWNED BY "dst"."t"."id";
+ALTER TABLE "dst"."t" ALTER COLUMN "id" SET DEFAULT nextval('"dst".t_id_seq'::regclass);
+`, migrationScript(postgresDialect, diffSchemas(table("src", "nextval('src.t_id_seq'::regclass)"), table("dst", "NULL"))))
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type ScriptResult struct {
+	Statement string        `json:"statement"`
+	Line      int           `json:"line"`
+	Kind      StatementKind `json:"kind"`
+	Result    QueryResult   `json:"result"`
+	Error     string        `json:"error"`
+}
+
+type scriptStatement struct {
+	Query string
+	Line  int
+}
+
+// splitter cuts a script into statements as it is fed, so a script can be
+// read in chunks. It honours the mysql client DELIMITER command and the
+// BEGIN ... END bodies of sqlite triggers, literals and comments being left
+// to the lexer.
+type splitter struct {
+	dialect   dialect
+	delimiter string
+	buffer    strings.Builder
+	lexer     *lexer // goes on through the buffer as it grows
+	offset    int    // start of the text not consumed yet
+	line      int    // line of the character at offset
+	start     int    // offset of the current statement's first token, -1 until there is one
+	words     int
+	trigger   bool
+	depth     int
+}
+
+func newSplitter(d dialect) *splitter {
+	return &splitter{dialect: d, delimiter: ";", lexer: newLexer(d, ""), line: 1, start: -1}
+}
+
+func splitScript(d dialect, script string) []scriptStatement {
+	s := newSplitter(d)
+	return append(s.feed(script), s.end()...)
+}
+
+// feed adds a chunk of the script and returns the statements it completed.
+func (s *splitter) feed(chunk string) []scriptStatement {
+	// NOTE: the consumed text is dropped once it is most of the buffer, so
+	// the copy of what is left is paid for by what was consumed
+	if s.offset > 0 && s.offset >= s.buffer.Len()/2 {
+		rest := s.buffer.String()[s.offset:]
+		s.buffer.Reset()
+		s.buffer.WriteString(rest)
+		s.lexer.shift(s.offset)
+		if s.start >= 0 {
+			s.start -= s.offset
+		}
+		s.offset = 0
+	}
+	s.buffer.WriteString(chunk)
+	s.lexer.input = s.buffer.String()
+	return s.scan(false)
+}
+
+// end returns the statement left at the end of the script, if any.
+func (s *splitter) end() []scriptStatement {
+	return s.scan(true)
+}
+
+func (s *splitter) scan(final bool) []scriptStatement {
+	statements := make([]scriptStatement, 0)
+	input := s.lexer.input
+	for {
+		t, ok := s.lexer.next()
+		if !ok {
+			break
+		}
+		// NOTE: the token might go on in the next chunk
+		if !final && (t.unterminated || t.end == len(input)) {
+			s.lexer.unread(t)
+			break
+		}
+		if t.kind == commentToken {
+			continue
+		}
+
+		if s.start < 0 {
+			if s.dialect == mysqlDialect && t.kind == wordToken && strings.EqualFold(t.text, "DELIMITER") {
+				eol := strings.IndexByte(input[t.end:], '\n')
+				if eol < 0 && !final {
+					s.lexer.unread(t)
+					break
+				}
+				if eol < 0 {
+					eol = len(input) - t.end
+				}
+				s.delimiter = strings.TrimSpace(input[t.end : t.end+eol])
+				s.consume(t.end + eol)
+				continue
+			}
+			s.start = t.start
+		}
+
+		if t.kind != stringToken && t.kind != quotedToken && s.depth == 0 && strings.HasPrefix(input[t.start:], s.delimiter) {
+			if !final && t.start+len(s.delimiter) >= len(input) {
+				s.lexer.unread(t)
+				break
+			}
+			query := strings.TrimSpace(input[s.start:t.start])
+			if query != "" {
+				statements = append(statements, scriptStatement{Query: query, Line: s.line + strings.Count(input[s.offset:s.start], "\n")})
+			}
+			s.consume(t.start + len(s.delimiter))
+			continue
+		}
+
+		if s.dialect == sqliteDialect && t.kind == wordToken {
+			// NOTE: CREATE [TEMP] TRIGGER [IF NOT EXISTS] ... BEGIN stmt; stmt; END
+			word := strings.ToUpper(t.text)
+			s.words++
+			if s.words <= 3 && word == "TRIGGER" && strings.EqualFold(input[s.start:s.start+6], "CREATE") {
+				s.trigger = true
+			}
+			if s.trigger {
+				switch word {
+				case "BEGIN", "CASE":
+					s.depth++
+				case "END":
+					s.depth--
+				}
+			}
+		}
+	}
+
+	if final {
+		if s.start >= 0 {
+			query := strings.TrimSpace(input[s.start:])
+			statements = append(statements, scriptStatement{Query: query, Line: s.line + strings.Count(input[s.offset:s.start], "\n")})
+		}
+		s.consume(len(input))
+	}
+
+	return statements
+}
+
+// consume drops the text up to n, the statement there being done with.
+func (s *splitter) consume(n int) {
+	s.line += strings.Count(s.lexer.input[s.offset:n], "\n")
+	s.offset = n
+	s.lexer.pos = n
+	s.lexer.resume = nil
+	s.start = -1
+	s.words = 0
+	s.trigger = false
+	s.depth = 0
+}
+
+// executeScript runs the statements of the script one after the other on the
+// same connection, a transaction left open by the script is rolled back.
+func executeScript(ctx context.Context, db querier, d dialect, script string, stopOnError bool, limits Limits) []ScriptResult {
+	inTransaction := false
+	results := runScript(ctx, db, d, script, stopOnError, limits, func(query string) {
+		inTransaction = trackTransaction(d, query, inTransaction)
+	})
+
+	if inTransaction {
+		db.ExecContext(context.Background(), "ROLLBACK")
+	}
+
+	return results
+}
+
+// runScript runs the statements of the script one after the other, calling
+// onSuccess with each statement that succeeds.
+func runScript(ctx context.Context, db querier, d dialect, script string, stopOnError bool, limits Limits, onSuccess func(string)) []ScriptResult {
+	results := make([]ScriptResult, 0)
+
+	for _, statement := range splitScript(d, script) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		info := classifyStatement(d, statement.Query)
+		start := time.Now()
+		result, err := executeQuery(ctx, db, d, statement.Query, limits)
+		result.Duration = time.Since(start).String()
+
+		scriptResult := ScriptResult{
+			Statement: statement.Query,
+			Line:      statement.Line,
+			Kind:      info.Kind,
+			Result:    result,
+		}
+		if err != nil {
+			scriptResult.Error = err.Error()
+		}
+		results = append(results, scriptResult)
+
+		if err == nil {
+			onSuccess(statement.Query)
+		}
+		if err != nil && stopOnError {
+			break
+		}
+	}
+
+	return results
+}
+
+// trackTransaction tells whether a transaction is still open after the given
+// statement succeeded.
+func trackTransaction(d dialect, query string, inTransaction bool) bool {
+	switch classifyStatement(d, query).Kind {
+	case TransactionStatement:
+		return opensTransaction(d, query, inTransaction)
+	case DDLStatement:
+		// NOTE: mysql commits the transaction before running DDL
+		return inTransaction && d != mysqlDialect
+	}
+	return inTransaction
+}
+
+// opensTransaction tells whether a transaction is still open after the given
+// transaction control statement.
+func opensTransaction(d dialect, query string, inTransaction bool) bool {
+	words := make([]string, 0)
+	l := newLexer(d, query)
+	for t, ok := l.next(); ok && len(words) < 2; t, ok = l.next() {
+		if t.kind == wordToken {
+			words = append(words, strings.ToUpper(t.text))
+		}
+	}
+
+	switch words[0] {
+	case "BEGIN", "START":
+		return true
+	case "COMMIT", "END", "ABORT":
+		return false
+	case "ROLLBACK":
+		// NOTE: ROLLBACK TO [SAVEPOINT] keeps the transaction going
+		return inTransaction && len(words) > 1 && words[1] == "TO"
+	}
+	return inTransaction
+}
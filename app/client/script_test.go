@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSplitScript(t *testing.T) {
+	testCases := []struct {
+		name       string
+		dialect    dialect
+		script     string
+		statements []string
+		lines      []int
+	}{
+		{"Single without delimiter", sqliteDialect, "SELECT 1", []string{"SELECT 1"}, []int{1}},
+		{"Several", postgresDialect, "SELECT 1;\nSELECT 2;\n\nSELECT 3;", []string{"SELECT 1", "SELECT 2", "SELECT 3"}, []int{1, 2, 4}},
+		{"Empty statements", sqliteDialect, ";; SELECT 1;;", []string{"SELECT 1"}, []int{1}},
+		{"Delimiter in string", mysqlDialect, "SELECT 'a;b'; SELECT \"c;d\"", []string{"SELECT 'a;b'", "SELECT \"c;d\""}, []int{1, 1}},
+		{"Delimiter in identifier", postgresDialect, `SELECT 1 AS "a;b"; SELECT 2`, []string{`SELECT 1 AS "a;b"`, "SELECT 2"}, []int{1, 1}},
+		{"Delimiter in comments", postgresDialect, "SELECT 1; -- a;b\nSELECT /* c;d */ 2", []string{"SELECT 1", "SELECT /* c;d */ 2"}, []int{1, 2}},
+		{"Only comments", sqliteDialect, "SELECT 1; -- done", []string{"SELECT 1"}, []int{1}},
+		{
+			"Postgres function body",
+			postgresDialect,
+			"CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;\nSELECT f();",
+			[]string{"CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql", "SELECT f()"},
+			[]int{1, 6},
+		},
+		{
+			"Postgres tagged body",
+			postgresDialect,
+			"DO $body$ BEGIN PERFORM 1; END $body$; SELECT 1",
+			[]string{"DO $body$ BEGIN PERFORM 1; END $body$", "SELECT 1"},
+			[]int{1, 1},
+		},
+		{
+			"MySQL delimiter",
+			mysqlDialect,
+			"DELIMITER //\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND //\nDELIMITER ;\nCALL p();",
+			[]string{"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND", "CALL p()"},
+			[]int{2, 8},
+		},
+		{
+			"SQLite trigger",
+			sqliteDialect,
+			"CREATE TRIGGER t AFTER INSERT ON a\nBEGIN\n  UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n  INSERT INTO c VALUES (1);\nEND;\nSELECT 1;",
+			[]string{"CREATE TRIGGER t AFTER INSERT ON a\nBEGIN\n  UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n  INSERT INTO c VALUES (1);\nEND", "SELECT 1"},
+			[]int{1, 6},
+		},
+		{"Doubled quotes", sqliteDialect, "SELECT 'a''b;c'; SELECT 2", []string{"SELECT 'a''b;c'", "SELECT 2"}, []int{1, 1}},
+		{"Backslash in mysql string", mysqlDialect, `SELECT 'a\';b'; SELECT 2`, []string{`SELECT 'a\';b'`, "SELECT 2"}, []int{1, 1}},
+		{"Nested block comments", postgresDialect, "SELECT /* a /* b; */ c; */ 1; SELECT 2", []string{"SELECT /* a /* b; */ c; */ 1", "SELECT 2"}, []int{1, 1}},
+		{"Dash dash without space in mysql", mysqlDialect, "SELECT 1--1; SELECT 2", []string{"SELECT 1--1", "SELECT 2"}, []int{1, 1}},
+		{"Dollar tag prefix in body", postgresDialect, "DO $tag$ a; $ta; $tag$; SELECT 1", []string{"DO $tag$ a; $ta; $tag$", "SELECT 1"}, []int{1, 1}},
+		{
+			"SQLite transaction is not a trigger",
+			sqliteDialect,
+			"BEGIN; INSERT INTO a VALUES (1); END;",
+			[]string{"BEGIN", "INSERT INTO a VALUES (1)", "END"},
+			[]int{1, 1, 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			statements := splitScript(tc.dialect, tc.script)
+			queries := make([]string, 0)
+			lines := make([]int, 0)
+			for _, statement := range statements {
+				queries = append(queries, statement.Query)
+				lines = append(lines, statement.Line)
+			}
+			r.Equal(tc.statements, queries, "Wrong statements")
+			r.Equal(tc.lines, lines, "Wrong lines")
+
+			// NOTE: feeding the script one byte at a time must give the same result
+			s := newSplitter(tc.dialect)
+			chunked := make([]scriptStatement, 0)
+			for i := range tc.script {
+				chunked = append(chunked, s.feed(tc.script[i:i+1])...)
+			}
+			chunked = append(chunked, s.end()...)
+			r.Equal(statements, chunked, "Chunked split differs")
+		})
+	}
+}
+
+func TestSplitLargeStatement(t *testing.T) {
+	r := require.New(t)
+	// NOTE: a statement fed in small chunks is only scanned once, this would take minutes otherwise
+	value := strings.Repeat("x;", 1<<19)
+	script := "INSERT INTO t VALUES ('" + value + "');\nSELECT 1; -- " + value + "\nSELECT /* " + value + " */ 2"
+	s := newSplitter(postgresDialect)
+	statements := make([]scriptStatement, 0)
+	for i := 0; i < len(script); i += 16 {
+		statements = append(statements, s.feed(script[i:min(i+16, len(script))])...)
+	}
+	statements = append(statements, s.end()...)
+	r.Equal([]scriptStatement{
+		{Query: "INSERT INTO t VALUES ('" + value + "')", Line: 1},
+		{Query: "SELECT 1", Line: 2},
+		{Query: "SELECT /* " + value + " */ 2", Line: 3},
+	}, statements)
+}
+
+func TestExecuteScript(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	script := "CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT NOT NULL);\nINSERT INTO t (name) VALUES ('a'), ('b');\nINSERT INTO t (name) VALUES (NULL);\nSELECT * FROM t;"
+
+	results := executeScript(ctx, db, sqliteDialect, script, true, Limits{})
+	r.Len(results, 3, "Expected the script to stop on the first error")
+	r.Equal(DDLStatement, results[0].Kind)
+	r.Empty(results[0].Error)
+	r.Equal(int64(2), results[1].Result.RowsAffected)
+	r.NotEmpty(results[2].Error)
+	r.Equal(3, results[2].Line)
+	r.NotEmpty(results[2].Result.Duration)
+
+	results = executeScript(ctx, db, sqliteDialect, "DELETE FROM t;\nINSERT INTO t (name) VALUES (NULL);\nSELECT * FROM t;", false, Limits{})
+	r.Len(results, 3, "Expected the script to go on after an error")
+	r.NotEmpty(results[1].Error)
+	r.Empty(results[2].Error)
+	r.Len(results[2].Result.Rows, 0)
+
+	results = executeScript(ctx, db, sqliteDialect, "BEGIN;\nINSERT INTO t (name) VALUES ('c');\nINSERT INTO t (name) VALUES (NULL);\nCOMMIT;", true, Limits{})
+	r.Len(results, 3)
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM t").Scan(&count)
+	r.NoError(err)
+	r.Equal(0, count, "Expected the open transaction to be rolled back")
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Session pins a connection of the pool so that every statement of an editor
+// tab, BEGIN and COMMIT included, runs on the same connection.
+type Session struct {
+	mu            sync.Mutex
+	db            *sql.DB
+	conn          *sql.Conn
+	dialect       dialect
+	limits        Limits
+	pid           int64       // backend id of conn, to cancel its statements
+	inTransaction atomic.Bool // written under mu, read without it while a statement runs
+}
+
+func NewSession(ctx context.Context, c DatabaseClient) (*Session, error) {
+	s := &Session{db: dbOf(c), dialect: dialectOf(c), limits: limitsOf(c)}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+
+	pidQuery, _ := s.dialect.cancelQueries()
+	if pidQuery != "" {
+		err = conn.QueryRowContext(ctx, pidQuery).Scan(&s.pid)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// run runs fn on the pinned connection, cancelling the statement server side
+// when ctx is done.
+func (s *Session) run(ctx context.Context, limits Limits, fn func(ctx context.Context) error) error {
+	ctx, cancel := limits.withTimeout(ctx)
+	defer cancel()
+
+	_, cancelQuery := s.dialect.cancelQueries()
+	if cancelQuery == "" {
+		return fn(ctx)
+	}
+	return watchCancel(ctx, s.db, cancelQuery, s.pid, func() error {
+		return fn(ctx)
+	})
+}
+
+func (s *Session) ExecuteQuery(ctx context.Context, query string) (QueryResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result QueryResult
+	err := s.run(ctx, s.limits, func(ctx context.Context) error {
+		var err error
+		result, err = executeQuery(ctx, s.conn, s.dialect, query, s.limits)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+	s.inTransaction.Store(trackTransaction(s.dialect, query, s.inTransaction.Load()))
+	return result, nil
+}
+
+func (s *Session) ExecuteScript(ctx context.Context, script string, stopOnError bool) []ScriptResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []ScriptResult
+	// NOTE: the limits apply to each statement, not to the whole script
+	s.run(ctx, Limits{}, func(ctx context.Context) error {
+		results = runScript(ctx, s.conn, s.dialect, script, stopOnError, s.limits, func(query string) {
+			s.inTransaction.Store(trackTransaction(s.dialect, query, s.inTransaction.Load()))
+		})
+		return nil
+	})
+	return results
+}
+
+func (s *Session) Begin(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inTransaction.Load() {
+		return fmt.Errorf("a transaction is already open")
+	}
+	_, err := s.conn.ExecContext(ctx, "BEGIN")
+	if err != nil {
+		return err
+	}
+	s.inTransaction.Store(true)
+	return nil
+}
+
+func (s *Session) Commit(ctx context.Context) error {
+	return s.end(ctx, "COMMIT")
+}
+
+func (s *Session) Rollback(ctx context.Context) error {
+	return s.end(ctx, "ROLLBACK")
+}
+
+func (s *Session) end(ctx context.Context, statement string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.inTransaction.Load() {
+		return fmt.Errorf("no open transaction")
+	}
+	_, err := s.conn.ExecContext(ctx, statement)
+	if err != nil {
+		return err
+	}
+	s.inTransaction.Store(false)
+	return nil
+}
+
+// InTransaction doesn't wait for the running statement, if any.
+func (s *Session) InTransaction() bool {
+	return s.inTransaction.Load()
+}
+
+// Close rolls back the open transaction, if any, and returns the connection
+// to the pool.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inTransaction.Load() {
+		s.conn.ExecContext(context.Background(), "ROLLBACK")
+		s.inTransaction.Store(false)
+	}
+	return s.conn.Close()
+}
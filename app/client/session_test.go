@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSession(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "data.db"))
+	r.NoError(err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE t (id INTEGER)")
+	r.NoError(err)
+	c := &SqliteClient{Db: db}
+	count := func() string {
+		values, err := queryStrings(ctx, db, "SELECT count(*) FROM t")
+		r.NoError(err)
+		return values[0]
+	}
+
+	s, err := NewSession(ctx, c)
+	r.NoError(err)
+	_, err = s.ExecuteQuery(ctx, "BEGIN")
+	r.NoError(err)
+	r.True(s.InTransaction())
+	_, err = s.ExecuteQuery(ctx, "INSERT INTO t VALUES (1)")
+	r.NoError(err)
+	result, err := s.ExecuteQuery(ctx, "SELECT count(*) AS n FROM t")
+	r.NoError(err)
+	r.Equal(int64(1), result.Rows[0]["n"], "Expected the session to see its own changes")
+	r.Equal("0", count(), "Expected the pool not to see uncommitted changes")
+	r.NoError(s.Rollback(ctx))
+	r.False(s.InTransaction())
+	r.Error(s.Commit(ctx), "Expected no transaction to commit")
+
+	results := s.ExecuteScript(ctx, "BEGIN; INSERT INTO t VALUES (2); INSERT INTO missing VALUES (1);", false)
+	r.Len(results, 3)
+	r.NotEmpty(results[2].Error)
+	r.True(s.InTransaction(), "Expected the script to leave the transaction open")
+	r.NoError(s.Commit(ctx))
+	r.Equal("1", count())
+
+	r.NoError(s.Begin(ctx))
+	r.Error(s.Begin(ctx), "Expected a single transaction at once")
+	_, err = s.ExecuteQuery(ctx, "INSERT INTO t VALUES (3)")
+	r.NoError(err)
+	r.NoError(s.Close())
+	r.Equal("1", count(), "Expected closing the session to roll back")
+}
+
+func TestSessionInTransactionWhileRunning(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "data.db"))
+	r.NoError(err)
+	defer db.Close()
+
+	s, err := NewSession(context.Background(), &SqliteClient{Db: db})
+	r.NoError(err)
+	defer s.Close()
+	r.NoError(s.Begin(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.ExecuteQuery(ctx, "WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n) SELECT max(x) FROM n")
+	}()
+	r.Eventually(func() bool {
+		if s.mu.TryLock() {
+			s.mu.Unlock()
+			return false
+		}
+		return true
+	}, time.Second, time.Millisecond, "Query never started")
+
+	checked := make(chan bool)
+	go func() { checked <- s.InTransaction() }()
+	select {
+	case open := <-checked:
+		r.True(open)
+	case <-time.After(time.Second):
+		r.FailNow("Expected InTransaction not to wait for the running query")
+	}
+	cancel()
+	<-done
+}
+
+func TestTrackTransaction(t *testing.T) {
+	testCases := []struct {
+		dialect  dialect
+		query    string
+		open     bool
+		expected bool
+	}{
+		{postgresDialect, "BEGIN", false, true},
+		{mysqlDialect, "START TRANSACTION", false, true},
+		{postgresDialect, "END", true, false},
+		{postgresDialect, "ROLLBACK TO SAVEPOINT a", true, true},
+		{postgresDialect, "CREATE TABLE a (id int)", true, true},
+		{mysqlDialect, "CREATE TABLE a (id int)", true, false},
+		{mysqlDialect, "SELECT 1", true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			require.Equal(t, tc.expected, trackTransaction(tc.dialect, tc.query, tc.open))
+		})
+	}
+}
@@ -1,21 +1,23 @@
 package client
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"reflect"
+	"io"
 	"strings"
-	"time"
 )
 
 type SqliteClient struct {
-	Db *sql.DB
+	Db     *sql.DB
+	Limits Limits
 }
 
-func (c *SqliteClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
+func (c *SqliteClient) GetDatabaseMetadata(ctx context.Context) (DatabaseMetadata, error) {
 	var databaseMetadata DatabaseMetadata
 
-	tables, err := c.getTables()
+	tables, err := c.getTables(ctx)
 	if err != nil {
 		return databaseMetadata, err
 	}
@@ -23,7 +25,7 @@ func (c *SqliteClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
 	databaseMetadata.Columns = make(map[string]map[string][]string)
 	databaseMetadata.Columns["main"] = make(map[string][]string)
 	for _, table := range tables {
-		columns, err := c.getColumns(table)
+		columns, err := c.getColumns(ctx, table)
 		if err != nil {
 			continue
 		}
@@ -33,10 +35,10 @@ func (c *SqliteClient) GetDatabaseMetadata() (DatabaseMetadata, error) {
 	return databaseMetadata, nil
 }
 
-func (c *SqliteClient) getColumns(table string) ([]string, error) {
+func (c *SqliteClient) getColumns(ctx context.Context, table string) ([]string, error) {
 	columns := make([]string, 0)
 
-	rows, err := c.Db.Query("SELECT name FROM pragma_table_info(?)", table)
+	rows, err := c.Db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
 	if err != nil {
 		return columns, err
 	}
@@ -55,10 +57,10 @@ func (c *SqliteClient) getColumns(table string) ([]string, error) {
 	return columns, nil
 }
 
-func (c *SqliteClient) getTables() ([]string, error) {
+func (c *SqliteClient) getTables(ctx context.Context) ([]string, error) {
 	tables := make([]string, 0)
 
-	rows, err := c.Db.Query("SELECT name FROM sqlite_master WHERE type LIKE 'table'")
+	rows, err := c.Db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type LIKE 'table'")
 	if err != nil {
 		return tables, err
 	}
@@ -76,7 +78,7 @@ func (c *SqliteClient) getTables() ([]string, error) {
 	return tables, nil
 }
 
-func (c *SqliteClient) fetchColumnsMetadata(table string, columns []string) ([]ColumnMetadata, error) {
+func (c *SqliteClient) fetchColumnsMetadata(ctx context.Context, table string, columns []string) ([]ColumnMetadata, error) {
 	columnsMetadata := make([]ColumnMetadata, 0)
 
 	cColumns := ""
@@ -84,7 +86,7 @@ func (c *SqliteClient) fetchColumnsMetadata(table string, columns []string) ([]C
 		cColumns = fmt.Sprintf(" WHERE name IN (%s)", "'"+strings.Join(columns, "', '")+"'")
 	}
 
-	queryColumns, err := c.Db.Query(fmt.Sprintf("SELECT name, type, COALESCE(dflt_value, 'NULL') AS default_value, CASE \"notnull\" WHEN 1 THEN false ELSE true END nullable, pk AS primary_key FROM pragma_table_info('%s')%s", table, cColumns))
+	queryColumns, err := c.Db.QueryContext(ctx, fmt.Sprintf("SELECT name, type, COALESCE(dflt_value, 'NULL') AS default_value, CASE \"notnull\" WHEN 1 THEN false ELSE true END nullable, pk > 0 AS primary_key FROM pragma_table_info('%s')%s", table, cColumns))
 	if err != nil {
 		return columnsMetadata, err
 	}
@@ -96,11 +98,20 @@ func (c *SqliteClient) fetchColumnsMetadata(table string, columns []string) ([]C
 	return columnsMetadata, nil
 }
 
-func (c *SqliteClient) executeSelectQuery(query string, params QueryParams) (QueryResult, error) {
+func (c *SqliteClient) executeSelectQuery(ctx context.Context, query string, params QueryParams) (QueryResult, error) {
 	queryParts := strings.Split(query, " ")
 	table := queryParts[0]
 
-	result, err := executeSelectQuery(c.Db, query, params)
+	info := tableInfo{schema: "main", name: table}
+	if params.Cursor != nil {
+		columnsMetadata, err := c.fetchColumnsMetadata(ctx, table, []string{})
+		if err != nil {
+			return QueryResult{}, err
+		}
+		info.primaryKey = primaryKeyColumns(columnsMetadata)
+	}
+
+	result, err := executeSelectQuery(ctx, c.Db, sqliteDialect, query, params, info, c.Limits)
 	if err != nil {
 		return result, err
 	}
@@ -115,7 +126,7 @@ func (c *SqliteClient) executeSelectQuery(query string, params QueryParams) (Que
 		}
 	}
 
-	columnsMetadata, err := c.fetchColumnsMetadata(table, columns)
+	columnsMetadata, err := c.fetchColumnsMetadata(ctx, table, columns)
 	if err != nil {
 		return result, err
 	}
@@ -132,7 +143,7 @@ func (c *SqliteClient) executeSelectQuery(query string, params QueryParams) (Que
 	return result, err
 }
 
-func (c *SqliteClient) GetConnectionDatabases(params QueryParams) (QueryResult, error) {
+func (c *SqliteClient) GetConnectionDatabases(ctx context.Context, params QueryParams) (QueryResult, error) {
 	rows := make([]Row, 0)
 	row := make(Row)
 	row["name"] = "main"
@@ -145,207 +156,248 @@ func (c *SqliteClient) GetConnectionDatabases(params QueryParams) (QueryResult,
 	}, nil
 }
 
-func (c *SqliteClient) GetDatabaseSchemas(params QueryParams) (QueryResult, error) {
+func (c *SqliteClient) GetDatabaseSchemas(ctx context.Context, params QueryParams) (QueryResult, error) {
 	params.Columns = []string{"name"}
-	return c.executeSelectQuery("sqlite_master WHERE type LIKE 'table'", params)
+	return c.executeSelectQuery(ctx, "sqlite_master WHERE type LIKE 'table'", params)
 }
 
-func (c *SqliteClient) GetSchemaTables(params QueryParams, schema string) (QueryResult, error) {
+func (c *SqliteClient) GetSchemaTables(ctx context.Context, params QueryParams, schema string) (QueryResult, error) {
 	params.Columns = []string{"name"}
-	return c.executeSelectQuery(fmt.Sprintf("sqlite_master WHERE type LIKE 'table' AND name = '%s'", schema), params)
+	return c.executeSelectQuery(ctx, fmt.Sprintf("sqlite_master WHERE type LIKE 'table' AND name = '%s'", schema), params)
 }
 
-func (c *SqliteClient) GetTableRows(params QueryParams, schema string, table string) (QueryResult, error) {
-	return c.executeSelectQuery(table, params)
+func (c *SqliteClient) GetTableRows(ctx context.Context, params QueryParams, schema string, table string) (QueryResult, error) {
+	return c.executeSelectQuery(ctx, table, params)
 }
 
-func (c *SqliteClient) ExecuteQuery(query string) (QueryResult, error) {
-	return executeQuery(c.Db, query)
+func (c *SqliteClient) ExecuteQuery(ctx context.Context, query string) (QueryResult, error) {
+	return executeQuery(ctx, c.Db, sqliteDialect, query, c.Limits)
 }
 
-func (c *SqliteClient) Execute(query string) error {
-	return execute(c.Db, query)
+func (c *SqliteClient) ExecuteScript(ctx context.Context, script string, stopOnError bool) ([]ScriptResult, error) {
+	conn, err := c.Db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return executeScript(ctx, conn, sqliteDialect, script, stopOnError, c.Limits), nil
 }
 
-func (c *SqliteClient) Export(options ExportOptions) (string, error) {
-	contents := ""
-
-	if options.WrapInTransaction {
-		contents += "BEGIN;\n"
-	}
-
-	currentTable := ""
-	currentTableMetadata := make([]ColumnMetadata, 0)
-
-	tableColumnsMap := make(map[string][]string)
-
-	// NOTE: STEP 1 => Create tables
-	// TODO: refactor and use helper function to avoid duplicate code
-	if options.SchemaOnly || options.DropTable != DoNothing {
-		for i, entity := range options.Selected {
-			if strings.Count(entity, ".") == 0 {
-				// NOTE: ignore default schema
-			}
-			if strings.Count(entity, ".") == 1 {
-				parts := strings.Split(entity, ".")
-				// schema := parts[0]
-				table := parts[1]
-				if table != currentTable {
-					var err error
-					currentTableMetadata, err = c.fetchColumnsMetadata(table, []string{})
-					if err != nil {
-						return "", err
-					}
-					currentTable = table
-					tableColumnsMap[table] = make([]string, 0)
-				}
-				switch options.DropTable {
-				case DropAndCreate:
-					contents += fmt.Sprintf("DROP TABLE %s;\n", table)
-					contents += fmt.Sprintf("CREATE TABLE %s (\n", table)
-				case Create:
-					contents += fmt.Sprintf("CREATE TABLE %s (\n", table)
-				case CreateIfNotExists:
-					contents += fmt.Sprintf("CREATE IF NOT EXISTS TABLE %s (\n", table)
-				}
-			}
-			if strings.Count(entity, ".") == 2 {
-				parts := strings.Split(entity, ".")
-				// schema := parts[0]
-				table := parts[1]
-				column := parts[2]
-				tableColumnsMap[table] = append(tableColumnsMap[table], column)
-				var currentColumn *ColumnMetadata = nil
-				for _, col := range currentTableMetadata {
-					if col.Name == column {
-						currentColumn = &col
-						break
-					}
-				}
-				if currentColumn == nil {
-					return "", fmt.Errorf("invalid column name: %s", column)
-				}
-
-				nullable := ""
-				defaultValue := ""
-				primaryKey := ""
-				if !currentColumn.Nullable {
-					nullable = " NOT NULL"
-				}
-				if currentColumn.DefaultValue != "NULL" {
-					defaultValue = fmt.Sprintf(" DEFAULT %s", currentColumn.DefaultValue)
-				}
-				if currentColumn.PrimaryKey {
-					primaryKey = " PRIMARY KEY"
-				}
-				contents += fmt.Sprintf("    %s %s%s%s%s", currentColumn.Name, currentColumn.Type, nullable, defaultValue, primaryKey)
-				if i+1 < len(options.Selected) {
-					next := options.Selected[i+1]
-					// NOTE: only part differing from others as we can use the schema here
-					if strings.HasPrefix(next, "main."+table+".") {
-						contents += ","
-					} else {
-						contents += "\n);"
-					}
-				} else {
-					contents += "\n);"
-				}
-				contents += "\n"
-			}
-		}
+func (c *SqliteClient) Execute(ctx context.Context, query string) error {
+	return execute(ctx, c.Db, query, c.Limits)
+}
+
+func (c *SqliteClient) Export(ctx context.Context, w io.Writer, options ExportOptions) error {
+	if options.Type != SQL {
+		// NOTE: exports are not subject to the connection limits
+		return exportData(ctx, c.Db, sqliteDialect, w, options)
+	}
+
+	return dumpSQL(ctx, c.Db, sqliteDialect, w, options, func(schema string, table string) (tableDDL, error) {
+		return c.tableDDL(ctx, schema, table)
+	})
+}
+
+func (c *SqliteClient) ExportQuery(ctx context.Context, w io.Writer, query string, options ExportOptions) error {
+	return exportQuery(ctx, c.Db, sqliteDialect, w, query, options)
+}
+
+func (c *SqliteClient) Import(ctx context.Context, r io.Reader, options ImportOptions, onProgress func(ImportProgress)) error {
+	conn, err := c.Db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return importScript(ctx, conn, sqliteDialect, r, options, onProgress)
+}
+
+func (c *SqliteClient) PreviewCSV(ctx context.Context, r io.Reader, options CSVImportOptions) (CSVPreview, error) {
+	tableColumns, err := c.fetchColumnsMetadata(ctx, options.Table, []string{})
+	if err != nil {
+		return CSVPreview{}, err
+	}
+	return previewCSV(r, options, tableColumns)
+}
+
+func (c *SqliteClient) ImportCSV(ctx context.Context, r io.Reader, options CSVImportOptions, onProgress func(ImportProgress)) error {
+	tableColumns, err := c.fetchColumnsMetadata(ctx, options.Table, []string{})
+	if err != nil {
+		return err
+	}
+	return importCSV(ctx, c.Db, sqliteDialect, r, options, tableColumns, onProgress)
+}
+
+func (c *SqliteClient) GetTableMetadata(ctx context.Context, schema string, table string) (TableMetadata, error) {
+	metadata := TableMetadata{Schema: schema, Name: table}
+
+	var statement string
+	err := c.Db.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&statement)
+	if errors.Is(err, sql.ErrNoRows) {
+		return metadata, fmt.Errorf("%w %s.%s", errUnknownTable, schema, table)
+	}
+	if err != nil {
+		return metadata, err
+	}
+	// NOTE: sqlite doesn't keep check constraints anywhere but in the CREATE TABLE statement
+	metadata.Checks = parseChecks(sqliteDialect, statement)
+
+	metadata.Columns, err = c.fetchColumnsMetadata(ctx, table, []string{})
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Indexes, err = c.fetchIndexes(ctx, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.ForeignKeys, err = c.fetchForeignKeys(ctx, schema, table)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Triggers, err = c.fetchTriggers(ctx, table)
+	if err != nil {
+		return metadata, err
+	}
+
+	return metadata, nil
+}
+
+func (c *SqliteClient) GetSchemaMetadata(ctx context.Context, schema string) (SchemaMetadata, error) {
+	tables, err := queryStrings(ctx, c.Db, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite\_%' ESCAPE '\' ORDER BY name`)
+	if err != nil {
+		return SchemaMetadata{}, err
+	}
+
+	rows, err := c.Db.QueryContext(ctx, "SELECT name, sql, false FROM sqlite_master WHERE type = 'view' ORDER BY name")
+	if err != nil {
+		return SchemaMetadata{}, err
+	}
+	views, err := scanViews(rows)
+	if err != nil {
+		return SchemaMetadata{}, err
 	}
+	for i := range views {
+		views[i].Definition = parseViewQuery(sqliteDialect, views[i].Definition)
+	}
+
+	return schemaMetadata(ctx, schema, tables, views, c.GetTableMetadata)
+}
 
-	// NOTE: STEP 2 => Insert data
-	// TODO: use helper function to avoid duplicate code
-	if !options.SchemaOnly {
-		contents += "\n"
-		for table, columns := range tableColumnsMap {
-			query := "SELECT "
-			for i, column := range columns {
-				query += fmt.Sprintf("\"%s\"", column)
-				if i+1 < len(columns) {
-					query += ", "
-				}
-			}
-			query += fmt.Sprintf(" FROM %s;", table)
-			result, err := c.ExecuteQuery(query)
-			if err != nil {
-				return "", err
-			}
-			if len(result.Rows) == 0 {
-				continue
-			}
-
-			contents += fmt.Sprintf("INSERT INTO %s (", table)
-			for i, column := range columns {
-				contents += fmt.Sprintf("\"%s\"", column)
-				if i+1 < len(columns) {
-					contents += ", "
-				}
-			}
-			contents += ") VALUES\n"
-
-			for i, row := range result.Rows {
-				contents += "    ("
-				for j, column := range columns {
-					value := row[column]
-					switch v := value.(type) {
-					case nil:
-						contents += "NULL"
-					case []byte:
-						// TODO: check type directly from column metadata to correctly add quotes
-						contents += fmt.Sprintf("'%s'", strings.ReplaceAll(string(v), "'", "''"))
-					case bool:
-						if v {
-							contents += "TRUE"
-						} else {
-							contents += "FALSE"
-						}
-					case int:
-						contents += fmt.Sprint(v)
-					case int64:
-						contents += fmt.Sprint(v)
-					case float64:
-						contents += fmt.Sprint(v)
-					case string:
-						contents += fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
-					case time.Time:
-						contents += fmt.Sprintf("'%s'", v.Format(time.RFC3339))
-					default:
-						return "", fmt.Errorf("invalid value type: %s (%s)", v, reflect.TypeOf(value))
-					}
-					if j+1 < len(columns) {
-						contents += ", "
-					} else {
-						contents += ")"
-					}
-				}
-				if i+1 < len(result.Rows) {
-					contents += ","
-				} else {
-					contents += ";"
-				}
-				contents += "\n"
-			}
+func (c *SqliteClient) fetchIndexes(ctx context.Context, table string) ([]IndexMetadata, error) {
+	rows, err := c.Db.QueryContext(ctx, `SELECT il.name, il."unique", il.origin = 'pk', 'btree', COALESCE(ii.name, ?) FROM pragma_index_list(?) il JOIN pragma_index_info(il.name) ii ORDER BY il.name, ii.seqno`, expressionColumn, table)
+	if err != nil {
+		return nil, err
+	}
+	return scanIndexes(rows)
+}
+
+func (c *SqliteClient) fetchForeignKeys(ctx context.Context, schema string, table string) ([]ForeignKeyMetadata, error) {
+	foreignKeys := make([]ForeignKeyMetadata, 0)
+
+	rows, err := c.Db.QueryContext(ctx, `SELECT id, "table", "from", "to", on_delete, on_update FROM pragma_foreign_key_list(?) ORDER BY id, seq`, table)
+	if err != nil {
+		return foreignKeys, err
+	}
+	defer rows.Close()
+
+	lastID := -1
+	for rows.Next() {
+		var id int
+		var foreignKey ForeignKeyMetadata
+		var column string
+		var referenced sql.NullString
+		err := rows.Scan(&id, &foreignKey.ReferencedTable, &column, &referenced, &foreignKey.OnDelete, &foreignKey.OnUpdate)
+		if err != nil {
+			return foreignKeys, err
+		}
+		if id != lastID {
+			foreignKey.ReferencedSchema = schema
+			foreignKeys = append(foreignKeys, foreignKey)
+			lastID = id
 		}
+		last := &foreignKeys[len(foreignKeys)-1]
+		last.Columns = append(last.Columns, column)
+		if referenced.Valid {
+			last.ReferencedColumns = append(last.ReferencedColumns, referenced.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return foreignKeys, err
+	}
 
-		contents += "\n"
+	// NOTE: REFERENCES parent without columns points at the parent primary key
+	for i, foreignKey := range foreignKeys {
+		if len(foreignKey.ReferencedColumns) > 0 {
+			continue
+		}
+		foreignKeys[i].ReferencedColumns, err = queryStrings(ctx, c.Db, "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", foreignKey.ReferencedTable)
+		if err != nil {
+			return foreignKeys, err
+		}
 	}
 
-	if options.WrapInTransaction {
-		contents += "COMMIT;\n"
+	return foreignKeys, nil
+}
+
+func (c *SqliteClient) fetchTriggers(ctx context.Context, table string) ([]TriggerMetadata, error) {
+	rows, err := c.Db.QueryContext(ctx, "SELECT name, '', '', sql FROM sqlite_master WHERE type = 'trigger' AND tbl_name = ? ORDER BY name", table)
+	if err != nil {
+		return nil, err
+	}
+	triggers, err := scanTriggers(rows)
+	if err != nil {
+		return triggers, err
 	}
+	for i := range triggers {
+		triggers[i].Timing, triggers[i].Event = parseTrigger(sqliteDialect, triggers[i].Definition)
+	}
+	return triggers, nil
+}
 
-	return contents, nil
+func (c *SqliteClient) GetTableDDL(ctx context.Context, schema string, table string) (string, error) {
+	ddl, err := c.tableDDL(ctx, schema, table)
+	if err != nil {
+		return "", err
+	}
+	return ddl.String(sqliteDialect), nil
 }
 
-func (c *SqliteClient) Import(contents string) error {
-	err := c.Execute(contents)
+// tableDDL reads the statements sqlite kept when the table, its indexes and
+// its triggers were created, indexes backing constraints have none.
+func (c *SqliteClient) tableDDL(ctx context.Context, schema string, table string) (tableDDL, error) {
+	var ddl tableDDL
+
+	rows, err := c.Db.QueryContext(ctx, "SELECT type, sql FROM sqlite_master WHERE tbl_name = ? AND sql IS NOT NULL ORDER BY type <> 'table', type <> 'index', name", table)
 	if err != nil {
-		if strings.Contains(contents, "BEGIN;") || strings.Contains(contents, "BEGIN TRANSACTION;") {
-			c.Execute("ROLLBACK;")
+		return ddl, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, statement string
+		err := rows.Scan(&kind, &statement)
+		if err != nil {
+			return ddl, err
+		}
+		if kind == "table" {
+			ddl.create = append(ddl.create, statement)
+		} else {
+			ddl.after = append(ddl.after, statement)
 		}
-		return err
 	}
-	return nil
+	if err := rows.Err(); err != nil {
+		return ddl, err
+	}
+	if len(ddl.create) == 0 {
+		return ddl, fmt.Errorf("%w %s.%s", errUnknownTable, schema, table)
+	}
+
+	// NOTE: hidden is 2 for virtual and 3 for stored generated columns
+	ddl.generated, err = queryStrings(ctx, c.Db, "SELECT name FROM pragma_table_xinfo(?) WHERE hidden IN (2, 3) ORDER BY cid", table)
+	if err != nil {
+		return ddl, err
+	}
+
+	return ddl, nil
 }
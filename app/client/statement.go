@@ -0,0 +1,404 @@
+package client
+
+import (
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	wordToken    tokenKind = iota // keywords, bare identifiers and numbers
+	quotedToken                   // quoted identifiers: "name", `name`, [name]
+	stringToken                   // string literals, including dollar-quoted bodies
+	commentToken                  // -- line, # line and /* block */ comments
+	symbolToken                   // anything else, one character at a time
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	start int
+	end   int
+	// unterminated is set when the input ended inside a string, quoted identifier or comment,
+	// or before a dollar-quoted string could be told apart from a lone $
+	unterminated bool
+}
+
+// lexer splits SQL into tokens, it knows just enough about each dialect to
+// never mistake the content of a literal, an identifier or a comment for code.
+type lexer struct {
+	dialect dialect
+	input   string
+	pos     int
+	stopped *partialToken // the last token, when it ran into the end of the input
+	resume  *partialToken // the token next goes on with, see unread
+}
+
+// partialToken is where a token running into the end of the input can be
+// scanned again from once the input goes on, so a long string or comment
+// read in chunks is only scanned once.
+type partialToken struct {
+	start int
+	pos   int
+	scan  func() token // goes on from pos
+}
+
+func newLexer(d dialect, input string) *lexer {
+	return &lexer{dialect: d, input: input}
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isWordChar(c byte) bool {
+	return isWordStart(c) || c >= '0' && c <= '9' || c == '$'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset < len(l.input) {
+		return l.input[l.pos+offset]
+	}
+	return 0
+}
+
+// next returns the next token, or false once the input is exhausted.
+func (l *lexer) next() (token, bool) {
+	l.stopped = nil
+	if l.resume != nil {
+		resume := l.resume
+		l.resume = nil
+		l.pos = resume.pos
+		t := resume.scan()
+		return l.token(t, resume.start), true
+	}
+
+	for l.pos < len(l.input) && isSpace(l.input[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return token{}, false
+	}
+
+	start := l.pos
+	c := l.input[l.pos]
+	var t token
+	switch {
+	case c == '-' && l.peek(1) == '-' && (l.dialect != mysqlDialect || l.peek(2) == 0 || isSpace(l.peek(2))):
+		t = l.lineComment()
+		// NOTE: mysql only knows it is a comment once what follows -- is there
+		if l.pos == start+2 {
+			l.stopped = nil
+		}
+	case c == '#' && l.dialect == mysqlDialect:
+		t = l.lineComment()
+	case c == '/' && l.peek(1) == '*':
+		t = l.blockComment()
+	case c == '\'':
+		t = l.quoted(stringToken, '\'', l.dialect == mysqlDialect)
+	case (c == 'E' || c == 'e') && l.peek(1) == '\'' && l.dialect == postgresDialect:
+		l.pos++
+		t = l.quoted(stringToken, '\'', true)
+	case c == '"' && l.dialect == mysqlDialect:
+		t = l.quoted(stringToken, '"', true)
+	case c == '"':
+		t = l.quoted(quotedToken, '"', false)
+	case c == '`' && l.dialect != postgresDialect:
+		t = l.quoted(quotedToken, '`', false)
+	case c == '[' && l.dialect == sqliteDialect:
+		t = l.quoted(quotedToken, ']', false)
+	case c == '$' && l.dialect == postgresDialect && l.dollarTag() != "":
+		t = l.dollarQuoted()
+	case c == '$' && l.dialect == postgresDialect && l.dollarTagMayFollow():
+		l.pos++
+		t = token{kind: symbolToken, unterminated: true}
+	case isWordStart(c) || c >= '0' && c <= '9':
+		for l.pos < len(l.input) && isWordChar(l.input[l.pos]) {
+			l.pos++
+		}
+		t = token{kind: wordToken}
+	default:
+		l.pos++
+		t = token{kind: symbolToken}
+	}
+
+	return l.token(t, start), true
+}
+
+func (l *lexer) token(t token, start int) token {
+	t.start = start
+	t.end = l.pos
+	t.text = l.input[start:l.pos]
+	if l.stopped != nil {
+		l.stopped.start = start
+	}
+	return t
+}
+
+// stop records where the current token can be scanned again from when the
+// input goes on.
+func (l *lexer) stop(pos int, scan func() token) {
+	l.stopped = &partialToken{pos: pos, scan: scan}
+}
+
+// unread gives the token back for next to return it again, once the input is
+// extended. A token that ran into the end of the input goes on from where it
+// stopped instead of being scanned again from its start.
+func (l *lexer) unread(t token) {
+	if l.stopped != nil && l.stopped.start == t.start {
+		l.resume = l.stopped
+	} else {
+		l.pos = t.start
+	}
+	l.stopped = nil
+}
+
+// shift moves the positions back by n, once the input lost its first n bytes.
+func (l *lexer) shift(n int) {
+	l.pos -= n
+	if l.resume != nil {
+		l.resume.start -= n
+		l.resume.pos -= n
+	}
+}
+
+func (l *lexer) lineComment() token {
+	for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+		l.pos++
+	}
+	if l.pos == len(l.input) {
+		l.stop(l.pos, l.lineComment)
+	}
+	return token{kind: commentToken}
+}
+
+func (l *lexer) blockComment() token {
+	l.pos += 2
+	return l.blockCommentBody(1)
+}
+
+func (l *lexer) blockCommentBody(depth int) token {
+	for l.pos < len(l.input) {
+		// NOTE: the */ or /* might be cut by the end of the input
+		if l.pos == len(l.input)-1 && (l.input[l.pos] == '*' || l.input[l.pos] == '/') {
+			break
+		}
+		switch {
+		case l.input[l.pos] == '*' && l.peek(1) == '/':
+			l.pos += 2
+			depth--
+			if depth == 0 {
+				return token{kind: commentToken}
+			}
+		// NOTE: only postgres allows nested block comments
+		case l.input[l.pos] == '/' && l.peek(1) == '*' && l.dialect == postgresDialect:
+			l.pos += 2
+			depth++
+		default:
+			l.pos++
+		}
+	}
+	l.stop(l.pos, func() token { return l.blockCommentBody(depth) })
+	l.pos = len(l.input)
+	return token{kind: commentToken, unterminated: true}
+}
+
+// quoted consumes up to the closing quote, a doubled closing quote being an
+// escaped one, and a backslash escaping the next character when allowed.
+func (l *lexer) quoted(kind tokenKind, closing byte, backslash bool) token {
+	l.pos++
+	return l.quotedBody(kind, closing, backslash)
+}
+
+func (l *lexer) quotedBody(kind tokenKind, closing byte, backslash bool) token {
+	resume := func() token { return l.quotedBody(kind, closing, backslash) }
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case backslash && c == '\\':
+			if l.pos == len(l.input)-1 {
+				l.stop(l.pos, resume)
+				l.pos = len(l.input)
+				return token{kind: kind, unterminated: true}
+			}
+			l.pos += 2
+		case c == closing && l.peek(1) == closing && closing != ']':
+			l.pos += 2
+		case c == closing:
+			// NOTE: the quote might be doubled at the start of the next input
+			if l.pos == len(l.input)-1 && closing != ']' {
+				l.stop(l.pos, resume)
+			}
+			l.pos++
+			return token{kind: kind}
+		default:
+			l.pos++
+		}
+	}
+	l.stop(l.pos, resume)
+	return token{kind: kind, unterminated: true}
+}
+
+// dollarTag returns the $tag$ opening a dollar-quoted string at the current
+// position, or an empty string if there is none ($1 being a parameter).
+func (l *lexer) dollarTag() string {
+	i := l.pos + 1
+	if i < len(l.input) && isWordStart(l.input[i]) {
+		for i < len(l.input) && isWordChar(l.input[i]) && l.input[i] != '$' {
+			i++
+		}
+	}
+	if i < len(l.input) && l.input[i] == '$' {
+		return l.input[l.pos : i+1]
+	}
+	return ""
+}
+
+// dollarTagMayFollow tells whether the input ends before we can tell if the
+// current $ opens a dollar-quoted string.
+func (l *lexer) dollarTagMayFollow() bool {
+	i := l.pos + 1
+	for i < len(l.input) && isWordChar(l.input[i]) && l.input[i] != '$' {
+		i++
+	}
+	return i == len(l.input) && (i == l.pos+1 || isWordStart(l.input[l.pos+1]))
+}
+
+func (l *lexer) dollarQuoted() token {
+	tag := l.dollarTag()
+	l.pos += len(tag)
+	return l.dollarQuotedBody(tag)
+}
+
+func (l *lexer) dollarQuotedBody(tag string) token {
+	end := strings.Index(l.input[l.pos:], tag)
+	if end < 0 {
+		// NOTE: the closing tag might be cut by the end of the input
+		l.stop(max(l.pos, len(l.input)-len(tag)+1), func() token { return l.dollarQuotedBody(tag) })
+		l.pos = len(l.input)
+		return token{kind: stringToken, unterminated: true}
+	}
+	l.pos += end + len(tag)
+	return token{kind: stringToken}
+}
+
+type StatementKind string
+
+const (
+	ReadStatement        StatementKind = "read"
+	WriteStatement       StatementKind = "write"
+	DDLStatement         StatementKind = "ddl"
+	TransactionStatement StatementKind = "transaction"
+	OtherStatement       StatementKind = "other"
+)
+
+type statementInfo struct {
+	Kind      StatementKind
+	Keyword   string // upper-cased keyword of the main statement (e.g. INSERT for WITH ... INSERT)
+	Returning bool
+}
+
+// returnsRows tells whether the statement must be run with Query rather than Exec.
+func (s statementInfo) returnsRows() bool {
+	return s.Kind == ReadStatement || s.Kind == OtherStatement || s.Returning
+}
+
+var statementKinds = map[string]StatementKind{
+	"SELECT":    ReadStatement,
+	"VALUES":    ReadStatement,
+	"TABLE":     ReadStatement,
+	"SHOW":      ReadStatement,
+	"EXPLAIN":   ReadStatement,
+	"DESCRIBE":  ReadStatement,
+	"DESC":      ReadStatement,
+	"PRAGMA":    ReadStatement,
+	"INSERT":    WriteStatement,
+	"UPDATE":    WriteStatement,
+	"DELETE":    WriteStatement,
+	"REPLACE":   WriteStatement,
+	"UPSERT":    WriteStatement,
+	"MERGE":     WriteStatement,
+	"COPY":      WriteStatement,
+	"LOAD":      WriteStatement,
+	"CREATE":    DDLStatement,
+	"ALTER":     DDLStatement,
+	"DROP":      DDLStatement,
+	"TRUNCATE":  DDLStatement,
+	"RENAME":    DDLStatement,
+	"COMMENT":   DDLStatement,
+	"GRANT":     DDLStatement,
+	"REVOKE":    DDLStatement,
+	"REINDEX":   DDLStatement,
+	"BEGIN":     TransactionStatement,
+	"START":     TransactionStatement,
+	"COMMIT":    TransactionStatement,
+	"END":       TransactionStatement,
+	"ROLLBACK":  TransactionStatement,
+	"ABORT":     TransactionStatement,
+	"SAVEPOINT": TransactionStatement,
+	"RELEASE":   TransactionStatement,
+}
+
+// classifyStatement looks at the significant tokens of a single statement to
+// tell what it does, ignoring anything hidden in literals or comments.
+func classifyStatement(d dialect, query string) statementInfo {
+	tokens := make([]token, 0)
+	l := newLexer(d, query)
+	for t, ok := l.next(); ok; t, ok = l.next() {
+		if t.kind != commentToken {
+			tokens = append(tokens, t)
+		}
+	}
+
+	info := statementInfo{Kind: OtherStatement}
+	if len(tokens) == 0 || tokens[0].kind != wordToken {
+		return info
+	}
+
+	first := strings.ToUpper(tokens[0].text)
+	info.Keyword = first
+	if kind, ok := statementKinds[first]; ok {
+		info.Kind = kind
+	}
+	if first == "SET" && len(tokens) > 1 && strings.EqualFold(tokens[1].text, "TRANSACTION") {
+		info.Kind = TransactionStatement
+	}
+
+	depth := 0
+	mainFound := first != "WITH"
+	modifyingCTE := false
+	for i, t := range tokens[1:] {
+		previous := tokens[i]
+		switch {
+		case t.kind == symbolToken && t.text == "(":
+			depth++
+		case t.kind == symbolToken && t.text == ")":
+			depth--
+		case t.kind != wordToken:
+		case depth == 0 && strings.EqualFold(t.text, "RETURNING"):
+			info.Returning = true
+		case depth == 0 && !mainFound:
+			// NOTE: the statement following the CTEs, everything before it is a name or a keyword of the WITH clause
+			if kind, ok := statementKinds[strings.ToUpper(t.text)]; ok && (kind == ReadStatement || kind == WriteStatement) {
+				info.Kind = kind
+				info.Keyword = strings.ToUpper(t.text)
+				mainFound = true
+			}
+		case depth > 0 && !mainFound && previous.text == "(":
+			// NOTE: data-modifying CTE, WITH x AS (DELETE ... RETURNING *) SELECT ...
+			if statementKinds[strings.ToUpper(t.text)] == WriteStatement {
+				modifyingCTE = true
+			}
+		}
+	}
+	if modifyingCTE {
+		info.Returning = info.Returning || info.Kind == ReadStatement
+		info.Kind = WriteStatement
+	}
+
+	return info
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyStatement(t *testing.T) {
+	testCases := []struct {
+		name      string
+		dialect   dialect
+		query     string
+		kind      StatementKind
+		returning bool
+	}{
+		{"Select", sqliteDialect, "SELECT * FROM users", ReadStatement, false},
+		{"Lowercase select", postgresDialect, "select 1", ReadStatement, false},
+		{"Select column named like a keyword", postgresDialect, "SELECT created_at, updated_at, deleted FROM users", ReadStatement, false},
+		{"Select with mutation in string", postgresDialect, "SELECT 'insert into users values (1)' AS q", ReadStatement, false},
+		{"Select with mutation in comment", mysqlDialect, "-- delete from users\nSELECT 1", ReadStatement, false},
+		{"Select with mutation in hash comment", mysqlDialect, "# drop table users\nSELECT 1", ReadStatement, false},
+		{"Select with mutation in block comment", sqliteDialect, "/* update users set a = 1 */ SELECT 1", ReadStatement, false},
+		{"Select with nested block comment", postgresDialect, "/* outer /* drop table x; */ still comment */ SELECT 1", ReadStatement, false},
+		{"Select with quoted identifier", postgresDialect, `SELECT "update" FROM "insert"`, ReadStatement, false},
+		{"Select with backtick identifier", mysqlDialect, "SELECT `delete` FROM `drop`", ReadStatement, false},
+		{"Select with bracket identifier", sqliteDialect, "SELECT [returning] FROM t", ReadStatement, false},
+		{"Select with escaped quote", sqliteDialect, "SELECT 'it''s an update' FROM t", ReadStatement, false},
+		{"Select with backslash escape", mysqlDialect, `SELECT 'it\'s returning' FROM t`, ReadStatement, false},
+		{"Select with escape string", postgresDialect, `SELECT E'it\'s returning' FROM t`, ReadStatement, false},
+		{"Select with dollar quote", postgresDialect, "SELECT $$ returning $$", ReadStatement, false},
+		{"Select with tagged dollar quote", postgresDialect, "SELECT $fn$ it's $$ returning $fn$", ReadStatement, false},
+		{"Select with parameter", postgresDialect, "SELECT * FROM t WHERE id = $1", ReadStatement, false},
+		{"Select for update", mysqlDialect, "SELECT * FROM t FOR UPDATE", ReadStatement, false},
+		{"Show", mysqlDialect, "SHOW TABLES", ReadStatement, false},
+		{"Explain", postgresDialect, "EXPLAIN ANALYZE SELECT 1", ReadStatement, false},
+		{"Pragma", sqliteDialect, "PRAGMA table_info(users)", ReadStatement, false},
+		{"Values", postgresDialect, "VALUES (1), (2)", ReadStatement, false},
+		{"CTE select", postgresDialect, "WITH recent AS (SELECT * FROM t) SELECT * FROM recent", ReadStatement, false},
+		{"Recursive CTE select", sqliteDialect, "WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n) SELECT x FROM n", ReadStatement, false},
+		{"CTE insert", postgresDialect, "WITH src AS (SELECT 1 AS id) INSERT INTO t SELECT id FROM src", WriteStatement, false},
+		{"CTE delete returning", postgresDialect, "WITH gone AS (DELETE FROM t RETURNING *) SELECT count(*) FROM gone", WriteStatement, true},
+		{"Insert", sqliteDialect, "INSERT INTO t (a) VALUES (1)", WriteStatement, false},
+		{"Insert select", mysqlDialect, "INSERT INTO t SELECT * FROM u", WriteStatement, false},
+		{"Insert returning", postgresDialect, "INSERT INTO t (a) VALUES (1) RETURNING id", WriteStatement, true},
+		{"Insert with returning in string", postgresDialect, "INSERT INTO t (a) VALUES ('returning')", WriteStatement, false},
+		{"Insert with returning column", postgresDialect, `INSERT INTO t ("returning") VALUES (1)`, WriteStatement, false},
+		{"Update", postgresDialect, "UPDATE t SET a = 1 WHERE id = 2", WriteStatement, false},
+		{"Update returning", sqliteDialect, "UPDATE t SET a = 1 RETURNING *", WriteStatement, true},
+		{"Delete", mysqlDialect, "DELETE FROM t", WriteStatement, false},
+		{"Replace", mysqlDialect, "REPLACE INTO t VALUES (1)", WriteStatement, false},
+		{"Leading comment and spaces", postgresDialect, "  /* header */\n  -- more\n  UPDATE t SET a = 1", WriteStatement, false},
+		{"Create table", sqliteDialect, "CREATE TABLE t (id INTEGER PRIMARY KEY)", DDLStatement, false},
+		{"Create function", postgresDialect, "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", DDLStatement, false},
+		{"Alter table", mysqlDialect, "ALTER TABLE t ADD COLUMN a INT", DDLStatement, false},
+		{"Drop table", postgresDialect, "DROP TABLE t", DDLStatement, false},
+		{"Truncate", postgresDialect, "TRUNCATE t", DDLStatement, false},
+		{"Begin", sqliteDialect, "BEGIN TRANSACTION", TransactionStatement, false},
+		{"Start transaction", mysqlDialect, "START TRANSACTION", TransactionStatement, false},
+		{"Commit", postgresDialect, "COMMIT", TransactionStatement, false},
+		{"Rollback", postgresDialect, "ROLLBACK", TransactionStatement, false},
+		{"Savepoint", sqliteDialect, "SAVEPOINT a", TransactionStatement, false},
+		{"Set transaction", postgresDialect, "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE", TransactionStatement, false},
+		{"Set", mysqlDialect, "SET NAMES utf8mb4", OtherStatement, false},
+		{"Empty", postgresDialect, "", OtherStatement, false},
+		{"Only comments", postgresDialect, "-- nothing\n/* here */", OtherStatement, false},
+		{"Unterminated string", sqliteDialect, "SELECT 'oops", ReadStatement, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			info := classifyStatement(tc.dialect, tc.query)
+			r.Equal(tc.kind, info.Kind, "Wrong statement kind")
+			r.Equal(tc.returning, info.Returning, "Wrong returning flag")
+		})
+	}
+}
+
+func TestLexer(t *testing.T) {
+	testCases := []struct {
+		name         string
+		dialect      dialect
+		input        string
+		kinds        []tokenKind
+		unterminated bool
+	}{
+		{"Words and symbols", sqliteDialect, "a.b = 1;", []tokenKind{wordToken, symbolToken, wordToken, symbolToken, wordToken, symbolToken}, false},
+		{"Double quotes are identifiers", postgresDialect, `"a""b"`, []tokenKind{quotedToken}, false},
+		{"Double quotes are strings in mysql", mysqlDialect, `"a\"b"`, []tokenKind{stringToken}, false},
+		{"Backticks are symbols in postgres", postgresDialect, "`a`", []tokenKind{symbolToken, wordToken, symbolToken}, false},
+		{"Dash dash needs a space in mysql", mysqlDialect, "1--1", []tokenKind{wordToken, symbolToken, symbolToken, wordToken}, false},
+		{"Dash dash comment", sqliteDialect, "1--1", []tokenKind{wordToken, commentToken}, false},
+		{"Unterminated block comment", sqliteDialect, "/* a", []tokenKind{commentToken}, true},
+		{"Unterminated dollar quote", postgresDialect, "$body$ a", []tokenKind{stringToken}, true},
+		{"Unterminated identifier", sqliteDialect, "[a", []tokenKind{quotedToken}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			kinds := make([]tokenKind, 0)
+			unterminated := false
+			l := newLexer(tc.dialect, tc.input)
+			for tok, ok := l.next(); ok; tok, ok = l.next() {
+				kinds = append(kinds, tok.kind)
+				unterminated = unterminated || tok.unterminated
+			}
+			r.Equal(tc.kinds, kinds, "Wrong tokens")
+			r.Equal(tc.unterminated, unterminated, "Wrong unterminated flag")
+		})
+	}
+}
@@ -1,23 +1,48 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
+
 	"github.com/google/uuid"
 
 	"dbisous/app/client"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 )
 
 type Connection struct {
-	ID               string         `json:"id"`
-	CreatedAt        string         `json:"created_at"`
-	UpdatedAt        string         `json:"updated_at"`
-	Name             string         `json:"name"`
-	Type             ConnectionType `json:"type"`
-	ConnectionString string         `json:"connection_string"`
+	ID               string             `json:"id"`
+	CreatedAt        string             `json:"created_at"`
+	UpdatedAt        string             `json:"updated_at"`
+	Name             string             `json:"name"`
+	Type             ConnectionType     `json:"type"`
+	ConnectionString string             `json:"connection_string"`
+	Settings         ConnectionSettings `json:"settings"` // parsed from ConnectionString, which is built from them when empty
+	SSH              SSHTunnel          `json:"ssh"`
+	TLS              TLSSettings        `json:"tls"`
+	StatementTimeout int                `json:"statement_timeout"` // in seconds, 0 means no timeout
+	MaxRows          int                `json:"max_rows"`          // 0 means no limit
+}
+
+// connectionString returns the connection string to save, built from the
+// settings when it isn't set.
+func (c Connection) connectionString() (string, error) {
+	if c.ConnectionString != "" {
+		return c.ConnectionString, nil
+	}
+	return buildConnectionString(c.Type, c.Settings)
+}
+
+func (c Connection) limits() client.Limits {
+	return client.Limits{
+		StatementTimeout: time.Duration(c.StatementTimeout) * time.Second,
+		MaxRows:          c.MaxRows,
+	}
 }
 
 type ConnectionType string
@@ -41,7 +66,7 @@ var activeConnections = make(map[string]*sql.DB)
 var dbClients = make(map[string]client.DatabaseClient)
 
 func getConnections(db *sql.DB) ([]Connection, error) {
-	rows, err := db.Query(`SELECT id, created_at, updated_at, name, type, connection_string FROM connection`)
+	rows, err := db.Query(`SELECT id, created_at, updated_at, name, type, connection_string, secret_storage, statement_timeout, max_rows, ssh_host, ssh_port, ssh_user, ssh_key_file, ssh_known_hosts, tls_ca, tls_cert, tls_key, tls_verify_mode, tls_server_name FROM connection`)
 	if err != nil {
 		return nil, err
 	}
@@ -50,10 +75,17 @@ func getConnections(db *sql.DB) ([]Connection, error) {
 	connections := make([]Connection, 0)
 	for rows.Next() {
 		var connection Connection
-		err := rows.Scan(&connection.ID, &connection.CreatedAt, &connection.UpdatedAt, &connection.Name, &connection.Type, &connection.ConnectionString)
+		var storage secretStorage
+		err := rows.Scan(&connection.ID, &connection.CreatedAt, &connection.UpdatedAt, &connection.Name, &connection.Type, &connection.ConnectionString, &storage, &connection.StatementTimeout, &connection.MaxRows, &connection.SSH.Host, &connection.SSH.Port, &connection.SSH.User, &connection.SSH.KeyFile, &connection.SSH.KnownHosts, &connection.TLS.CA, &connection.TLS.Cert, &connection.TLS.Key, &connection.TLS.VerifyMode, &connection.TLS.ServerName)
 		if err != nil {
 			return nil, err
 		}
+		connection.ConnectionString, err = openSecret(connection.ID, storage, connection.ConnectionString)
+		if err != nil {
+			return nil, err
+		}
+		// NOTE: a string the parser doesn't understand can still be used as is
+		connection.Settings, _ = parseConnectionString(connection.Type, connection.ConnectionString)
 		connections = append(connections, connection)
 	}
 
@@ -68,41 +100,105 @@ func createConnection(db *sql.DB, connection Connection) error {
 
 	connection.ID = id.String()
 
-	_, err = db.Exec(`INSERT INTO connection (id, name, type, connection_string)
-  VALUES (?, ?, ?, ?)`, connection.ID, connection.Name, connection.Type, connection.ConnectionString)
+	connectionString, err := connection.connectionString()
+	if err != nil {
+		return err
+	}
+	storage, stored, err := sealSecret(connection.ID, connectionString)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT INTO connection (id, name, type, connection_string, secret_storage, statement_timeout, max_rows, ssh_host, ssh_port, ssh_user, ssh_key_file, ssh_known_hosts, tls_ca, tls_cert, tls_key, tls_verify_mode, tls_server_name)
+  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, connection.ID, connection.Name, connection.Type, stored, storage, connection.StatementTimeout, connection.MaxRows, connection.SSH.Host, connection.SSH.Port, connection.SSH.User, connection.SSH.KeyFile, connection.SSH.KnownHosts, connection.TLS.CA, connection.TLS.Cert, connection.TLS.Key, connection.TLS.VerifyMode, connection.TLS.ServerName)
 
 	return err
 }
 
 func updateConnection(db *sql.DB, connection Connection) error {
-	_, err := db.Exec(`UPDATE connection
-  SET name = ?, type = ?, connection_string = ?, updated_at = CURRENT_TIMESTAMP
-  WHERE id = ?`, connection.Name, connection.Type, connection.ConnectionString, connection.ID)
+	connectionString, err := connection.connectionString()
+	if err != nil {
+		return err
+	}
+	storage, stored, err := sealSecret(connection.ID, connectionString)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`UPDATE connection
+  SET name = ?, type = ?, connection_string = ?, secret_storage = ?, statement_timeout = ?, max_rows = ?, ssh_host = ?, ssh_port = ?, ssh_user = ?, ssh_key_file = ?, ssh_known_hosts = ?, tls_ca = ?, tls_cert = ?, tls_key = ?, tls_verify_mode = ?, tls_server_name = ?, updated_at = CURRENT_TIMESTAMP
+  WHERE id = ?`, connection.Name, connection.Type, stored, storage, connection.StatementTimeout, connection.MaxRows, connection.SSH.Host, connection.SSH.Port, connection.SSH.User, connection.SSH.KeyFile, connection.SSH.KnownHosts, connection.TLS.CA, connection.TLS.Cert, connection.TLS.Key, connection.TLS.VerifyMode, connection.TLS.ServerName, connection.ID)
 	return err
 }
 
 func deleteConnection(db *sql.DB, id string) error {
-	_, err := db.Exec(`DELETE FROM connection WHERE id = ?`, id)
+	var storage secretStorage
+	err := db.QueryRow(`SELECT secret_storage FROM connection WHERE id = ?`, id).Scan(&storage)
+	if err == nil {
+		err = deleteSecret(id, storage)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = db.Exec(`DELETE FROM connection WHERE id = ?`, id)
 	return err
 }
 
-func testConnection(dbType ConnectionType, connectionString string) error {
-	var db *sql.DB
-	var err error
-
-	switch dbType {
+// openDatabase opens the database of the connection with its TLS settings
+// registered under id, through its SSH tunnel when it has one, the tunnel
+// having to be closed after the database.
+func openDatabase(id string, connection Connection) (*sql.DB, *tunnel, error) {
+	var driver string
+	switch connection.Type {
 	case SQLite:
-		db, err = sql.Open("sqlite3", connectionString)
+		driver = "sqlite3"
 	case MySQL:
-		db, err = sql.Open("mysql", connectionString)
+		driver = "mysql"
 	case PostgreSQL:
-		db, err = sql.Open("postgres", connectionString)
+		driver = "postgres"
 	default:
-		return fmt.Errorf("unsupported database type: %s", dbType)
+		return nil, nil, fmt.Errorf("unsupported database type: %s", connection.Type)
+	}
+
+	connectionString := driverConnectionString(connection.Type, connection.ConnectionString)
+	// NOTE: before the tunnel, which changes the host the server name defaults to
+	connectionString, err := applyTLS(connection.Type, connectionString, connection.TLS, tlsConfigName(id), connection.SSH.Host != "")
+	if err != nil {
+		return nil, nil, err
+	}
+	var t *tunnel
+	if connection.SSH.Host != "" {
+		t, connectionString, err = tunnelConnection(connection.Type, connectionString, connection.SSH)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
+
+	db, err := sql.Open(driver, connectionString)
+	if err != nil {
+		if t != nil {
+			t.Close()
+		}
+		return nil, nil, err
+	}
+	return db, t, nil
+}
+
+func testConnection(connection Connection) error {
+	id := uuid.NewString()
+	defer mysql.DeregisterTLSConfig(tlsConfigName(id))
+
+	db, t, err := openDatabase(id, connection)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		db.Close()
+		if t != nil {
+			t.Close()
+		}
+	}()
 
 	err = db.Ping()
 	if err != nil {
@@ -115,38 +211,47 @@ func testConnection(dbType ConnectionType, connectionString string) error {
 func connect(activeConnections map[string]*sql.DB, db *sql.DB, id string) (client.DatabaseMetadata, error) {
 	var databaseMetadata client.DatabaseMetadata
 
-	var dbType, connectionString string
-	err := db.QueryRow(`SELECT type, connection_string FROM connection WHERE id = ?`, id).Scan(&dbType, &connectionString)
+	var connection Connection
+	var storage secretStorage
+	err := db.QueryRow(`SELECT type, connection_string, secret_storage, statement_timeout, max_rows, ssh_host, ssh_port, ssh_user, ssh_key_file, ssh_known_hosts, tls_ca, tls_cert, tls_key, tls_verify_mode, tls_server_name FROM connection WHERE id = ?`, id).Scan(&connection.Type, &connection.ConnectionString, &storage, &connection.StatementTimeout, &connection.MaxRows, &connection.SSH.Host, &connection.SSH.Port, &connection.SSH.User, &connection.SSH.KeyFile, &connection.SSH.KnownHosts, &connection.TLS.CA, &connection.TLS.Cert, &connection.TLS.Key, &connection.TLS.VerifyMode, &connection.TLS.ServerName)
 	if err != nil {
 		return databaseMetadata, err
 	}
-
-	var connectionDb *sql.DB
-	switch dbType {
-	case string(SQLite):
-		connectionDb, err = sql.Open("sqlite3", connectionString)
-		dbClients[id] = &client.SqliteClient{Db: connectionDb}
-	case string(MySQL):
-		connectionDb, err = sql.Open("mysql", connectionString)
-		dbClients[id] = &client.MysqlClient{Db: connectionDb}
-	case string(PostgreSQL):
-		connectionDb, err = sql.Open("postgres", connectionString)
-		dbClients[id] = &client.PostgresClient{Db: connectionDb}
-	default:
-		return databaseMetadata, fmt.Errorf("unsupported database type: %s", dbType)
+	connection.ConnectionString, err = openSecret(id, storage, connection.ConnectionString)
+	if err != nil {
+		return databaseMetadata, err
 	}
+
+	connectionDb, t, err := openDatabase(id, connection)
 	if err != nil {
 		return databaseMetadata, err
 	}
 
 	err = connectionDb.Ping()
 	if err != nil {
+		connectionDb.Close()
+		if t != nil {
+			t.Close()
+		}
 		return databaseMetadata, err
 	}
 
+	switch connection.Type {
+	case SQLite:
+		dbClients[id] = &client.SqliteClient{Db: connectionDb, Limits: connection.limits()}
+	case MySQL:
+		dbClients[id] = &client.MysqlClient{Db: connectionDb, Limits: connection.limits()}
+	case PostgreSQL:
+		dbClients[id] = &client.PostgresClient{Db: connectionDb, Limits: connection.limits()}
+	}
 	activeConnections[id] = connectionDb
+	if t != nil {
+		tunnelsMu.Lock()
+		tunnels[id] = t
+		tunnelsMu.Unlock()
+	}
 
-	return dbClients[id].GetDatabaseMetadata()
+	return dbClients[id].GetDatabaseMetadata(context.Background())
 }
 
 func disconnect(activeConnections map[string]*sql.DB, id string) error {
@@ -155,7 +260,15 @@ func disconnect(activeConnections map[string]*sql.DB, id string) error {
 		return fmt.Errorf("no active connection for database ID: %s", id)
 	}
 
+	cancelQueries(id)
+	discardChanges(id)
+	// NOTE: before closing the pool, which waits for the pinned connections
+	closeSessions(id)
 	delete(dbClients, id)
 	delete(activeConnections, id) // Add this line
-	return conn.Close()
+	err := conn.Close()
+	// NOTE: after the pool, whose connections go through the tunnel
+	closeTunnel(id)
+	mysql.DeregisterTLSConfig(tlsConfigName(id))
+	return err
 }
@@ -15,8 +15,11 @@ func setupTestDB(t *testing.T) *sql.DB {
 	r := require.New(t)
 	db, err := InitMetadataDB(":memory:")
 	r.NoError(err, "Setup: Failed to initialize in-memory DB")
+	err = unlockSecrets(db, "master password")
+	r.NoError(err, "Setup: Failed to set the master password")
 
 	t.Cleanup(func() {
+		setMasterKey(nil)
 		err := db.Close()
 		r.NoError(err, "Teardown: Failed to close DB")
 	})
@@ -134,7 +137,7 @@ func TestTestConnection(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := testConnection(tc.dbType, tc.connStr)
+			err := testConnection(Connection{Type: tc.dbType, ConnectionString: tc.connStr})
 			if tc.expectSuccess {
 				r.NoError(err, "Expected connection test to succeed, but it failed")
 			} else {
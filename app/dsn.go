@@ -0,0 +1,359 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ConnectionSettings are the parts of a connection string, edited as fields
+// instead of a string whose syntax depends on the driver.
+type ConnectionSettings struct {
+	Host     string            `json:"host"` // a path for unix sockets
+	Port     int               `json:"port"` // 0 means the driver default
+	User     string            `json:"user"`
+	Password string            `json:"password"`
+	Database string            `json:"database"`
+	SSLMode  string            `json:"ssl_mode"` // sslmode for lib/pq, tls for the mysql driver
+	File     string            `json:"file"`     // database file for sqlite
+	Params   []ConnectionParam `json:"params"`   // the other driver options, in order
+}
+
+type ConnectionParam struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+const mysqlPrefix = "mysql://"
+
+// parseConnectionString splits the connection string of the driver into
+// settings, the options the settings don't have a field for going to Params.
+func parseConnectionString(dbType ConnectionType, connectionString string) (ConnectionSettings, error) {
+	switch dbType {
+	case SQLite:
+		return parseSqlite(connectionString)
+	case PostgreSQL:
+		return parsePostgres(connectionString)
+	case MySQL:
+		return parseMysql(connectionString)
+	}
+	return ConnectionSettings{}, fmt.Errorf("unsupported database type: %s", dbType)
+}
+
+// buildConnectionString writes the settings as a connection string of the
+// driver.
+func buildConnectionString(dbType ConnectionType, settings ConnectionSettings) (string, error) {
+	switch dbType {
+	case SQLite:
+		return buildSqlite(settings)
+	case PostgreSQL:
+		return buildPostgres(settings), nil
+	case MySQL:
+		return buildMysql(settings)
+	}
+	return "", fmt.Errorf("unsupported database type: %s", dbType)
+}
+
+// driverConnectionString fixes the connection strings saved by older
+// versions of the connection form, which the drivers don't accept, and sets
+// the driver options the clients rely on.
+func driverConnectionString(dbType ConnectionType, connectionString string) string {
+	if dbType == MySQL {
+		connectionString = strings.TrimPrefix(connectionString, mysqlPrefix)
+		// NOTE: UPDATEs report the rows they matched, not only the ones they changed, the edits count on it
+		separator := "?"
+		if strings.Contains(connectionString[strings.LastIndex(connectionString, "/")+1:], "?") {
+			separator = "&"
+		}
+		return connectionString + separator + "clientFoundRows=true"
+	}
+	return connectionString
+}
+
+// parseQuery reads the options of a connection string in order, an option
+// without value being kept with an empty one.
+func parseQuery(query string) ([]ConnectionParam, error) {
+	params := make([]ConnectionParam, 0)
+	for _, option := range strings.Split(query, "&") {
+		if option == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(option, "=")
+		name, err := url.QueryUnescape(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, ConnectionParam{Name: name, Value: value})
+	}
+	return params, nil
+}
+
+func formatQuery(params []ConnectionParam) string {
+	options := make([]string, len(params))
+	for i, param := range params {
+		options[i] = url.QueryEscape(param.Name) + "=" + url.QueryEscape(param.Value)
+	}
+	return strings.Join(options, "&")
+}
+
+func parsePort(port string) (int, error) {
+	if port == "" {
+		return 0, nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		return 0, fmt.Errorf("invalid port: %s", port)
+	}
+	return p, nil
+}
+
+func parseSqlite(connectionString string) (ConnectionSettings, error) {
+	file, query, _ := strings.Cut(connectionString, "?")
+	params, err := parseQuery(query)
+	if err != nil {
+		return ConnectionSettings{}, err
+	}
+	return ConnectionSettings{File: file, Params: params}, nil
+}
+
+func buildSqlite(settings ConnectionSettings) (string, error) {
+	if settings.File == "" {
+		return "", fmt.Errorf("missing database file")
+	}
+	if len(settings.Params) == 0 {
+		return settings.File, nil
+	}
+	return settings.File + "?" + formatQuery(settings.Params), nil
+}
+
+// parsePostgres reads both the URL and the key=value forms lib/pq accepts.
+func parsePostgres(connectionString string) (ConnectionSettings, error) {
+	var settings ConnectionSettings
+	var params []ConnectionParam
+	if strings.HasPrefix(connectionString, "postgres://") || strings.HasPrefix(connectionString, "postgresql://") {
+		u, err := url.Parse(connectionString)
+		if err != nil {
+			return settings, err
+		}
+		settings.Host = u.Hostname()
+		settings.Port, err = parsePort(u.Port())
+		if err != nil {
+			return settings, err
+		}
+		if u.User != nil {
+			settings.User = u.User.Username()
+			settings.Password, _ = u.User.Password()
+		}
+		settings.Database = strings.TrimPrefix(u.Path, "/")
+		params, err = parseQuery(u.RawQuery)
+		if err != nil {
+			return settings, err
+		}
+	} else {
+		var err error
+		params, err = parsePostgresOptions(connectionString)
+		if err != nil {
+			return settings, err
+		}
+	}
+
+	// NOTE: options override the URL, as in lib/pq
+	settings.Params = make([]ConnectionParam, 0, len(params))
+	for _, param := range params {
+		var err error
+		switch param.Name {
+		case "host":
+			settings.Host = param.Value
+		case "port":
+			settings.Port, err = parsePort(param.Value)
+		case "user":
+			settings.User = param.Value
+		case "password":
+			settings.Password = param.Value
+		case "dbname":
+			settings.Database = param.Value
+		case "sslmode":
+			settings.SSLMode = param.Value
+		default:
+			settings.Params = append(settings.Params, param)
+		}
+		if err != nil {
+			return settings, err
+		}
+	}
+	return settings, nil
+}
+
+// parsePostgresOptions reads the key=value form, values being quoted with
+// single quotes when they hold spaces.
+func parsePostgresOptions(connectionString string) ([]ConnectionParam, error) {
+	params := make([]ConnectionParam, 0)
+	s := []rune(connectionString)
+	i := 0
+	skipSpaces := func() {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+			i++
+		}
+	}
+	for {
+		skipSpaces()
+		if i >= len(s) {
+			return params, nil
+		}
+
+		start := i
+		for i < len(s) && s[i] != '=' && s[i] != ' ' {
+			i++
+		}
+		name := string(s[start:i])
+		skipSpaces()
+		if i >= len(s) || s[i] != '=' {
+			return nil, fmt.Errorf("missing value for option: %s", name)
+		}
+		i++
+		skipSpaces()
+
+		var value strings.Builder
+		if i < len(s) && s[i] == '\'' {
+			i++
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteRune(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated quoted value for option: %s", name)
+			}
+			i++
+		} else {
+			for ; i < len(s) && s[i] != ' '; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteRune(s[i])
+			}
+		}
+		params = append(params, ConnectionParam{Name: name, Value: value.String()})
+	}
+}
+
+// buildPostgres writes the URL form, unix socket directories going to the
+// options as they can't be the host of a URL.
+func buildPostgres(settings ConnectionSettings) string {
+	u := url.URL{Scheme: "postgres", Path: "/" + settings.Database}
+	if settings.Password != "" {
+		u.User = url.UserPassword(settings.User, settings.Password)
+	} else if settings.User != "" {
+		u.User = url.User(settings.User)
+	}
+
+	params := make([]ConnectionParam, 0, len(settings.Params)+3)
+	switch {
+	case strings.HasPrefix(settings.Host, "/"):
+		params = append(params, ConnectionParam{Name: "host", Value: settings.Host})
+		if settings.Port != 0 {
+			params = append(params, ConnectionParam{Name: "port", Value: strconv.Itoa(settings.Port)})
+		}
+	case settings.Port != 0:
+		u.Host = net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port))
+	default:
+		u.Host = settings.Host
+	}
+	if settings.SSLMode != "" {
+		params = append(params, ConnectionParam{Name: "sslmode", Value: settings.SSLMode})
+	}
+	params = append(params, settings.Params...)
+	u.RawQuery = formatQuery(params)
+
+	return u.String()
+}
+
+// parseMysql reads the DSN of the mysql driver, which has no scheme.
+func parseMysql(connectionString string) (ConnectionSettings, error) {
+	connectionString = strings.TrimPrefix(connectionString, mysqlPrefix)
+	config, err := mysql.ParseDSN(connectionString)
+	if err != nil {
+		return ConnectionSettings{}, err
+	}
+	settings := ConnectionSettings{User: config.User, Password: config.Passwd, Database: config.DBName}
+
+	// NOTE: the address and options are read from the string as the config
+	// has the driver defaults filled in
+	slash := strings.LastIndex(connectionString, "/")
+	if slash == -1 {
+		return ConnectionSettings{}, fmt.Errorf("no / before the database name in the MySQL connection string")
+	}
+	address := connectionString[strings.LastIndex(connectionString[:slash], "@")+1 : slash]
+	network, address, _ := strings.Cut(strings.TrimSuffix(address, ")"), "(")
+	if network == "unix" {
+		settings.Host = address
+	} else if host, port, err := net.SplitHostPort(address); err == nil {
+		settings.Host = host
+		settings.Port, err = parsePort(port)
+		if err != nil {
+			return settings, err
+		}
+	} else {
+		settings.Host = address
+	}
+
+	_, query, _ := strings.Cut(connectionString[slash+1:], "?")
+	params, err := parseQuery(query)
+	if err != nil {
+		return settings, err
+	}
+	settings.Params = make([]ConnectionParam, 0, len(params))
+	for _, param := range params {
+		if param.Name == "tls" {
+			settings.SSLMode = param.Value
+			continue
+		}
+		settings.Params = append(settings.Params, param)
+	}
+	return settings, nil
+}
+
+func buildMysql(settings ConnectionSettings) (string, error) {
+	var b strings.Builder
+	if settings.User != "" || settings.Password != "" {
+		b.WriteString(settings.User)
+		if settings.Password != "" {
+			b.WriteString(":" + settings.Password)
+		}
+		b.WriteString("@")
+	}
+	switch {
+	case strings.HasPrefix(settings.Host, "/"):
+		b.WriteString("unix(" + settings.Host + ")")
+	case settings.Port != 0:
+		b.WriteString("tcp(" + net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port)) + ")")
+	case settings.Host != "":
+		b.WriteString("tcp(" + settings.Host + ")")
+	}
+	b.WriteString("/" + settings.Database)
+
+	params := make([]ConnectionParam, 0, len(settings.Params)+1)
+	if settings.SSLMode != "" {
+		params = append(params, ConnectionParam{Name: "tls", Value: settings.SSLMode})
+	}
+	params = append(params, settings.Params...)
+	if len(params) > 0 {
+		b.WriteString("?" + formatQuery(params))
+	}
+
+	connectionString := b.String()
+	_, err := mysql.ParseDSN(connectionString)
+	if err != nil {
+		return "", err
+	}
+	return connectionString, nil
+}
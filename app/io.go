@@ -2,69 +2,173 @@ package app
 
 import (
 	"bufio"
+	"context"
 	"dbisous/app/client"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
-func exportDatabase(file string, id string, options client.ExportOptions) (string, error) {
-	// TODO: savefiledialog before exporting to make use of buffered writes and avoid memory issues
+func exportDatabase(file string, id string, queryID string, options client.ExportOptions) (string, error) {
 	dbClient, exists := dbClients[id]
 	if !exists {
 		return "", fmt.Errorf("no database client for database ID: %s", id)
 	}
 
-	contents, err := dbClient.Export(options)
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	if options.Type == client.SQL {
+		err := exportToFile(file, func(w io.Writer) error {
+			return dbClient.Export(ctx, w, options)
+		})
+		if err != nil {
+			return "", err
+		}
+		return file, nil
+	}
+
+	// NOTE: data formats hold a single table, each one goes to its own file
+	tables := client.SelectedTables(options.Selected)
+	files := make([]string, 0)
+	for _, selected := range tables {
+		tableFile := file
+		if len(tables) > 1 {
+			ext := filepath.Ext(file)
+			tableFile = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(file, ext), selected[0], ext)
+		}
+		tableOptions := options
+		tableOptions.Selected = selected
+		err := exportToFile(tableFile, func(w io.Writer) error {
+			return dbClient.Export(ctx, w, tableOptions)
+		})
+		if err != nil {
+			return "", err
+		}
+		files = append(files, tableFile)
+	}
+
+	return strings.Join(files, ", "), nil
+}
+
+func exportQuery(file string, id string, queryID string, query string, options client.ExportOptions) (string, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return "", fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	err := exportToFile(file, func(w io.Writer) error {
+		return dbClient.ExportQuery(ctx, w, query, options)
+	})
 	if err != nil {
 		return "", err
 	}
 
+	return file, nil
+}
+
+// exportToFile streams the export to the file through a buffer, the file is
+// removed when the export fails halfway.
+func exportToFile(file string, export func(io.Writer) error) error {
 	f, err := os.Create(file)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer f.Close()
 
 	w := bufio.NewWriter(f)
-	_, err = w.WriteString(contents)
+	err = export(w)
+	if err == nil {
+		err = w.Flush()
+	}
 	if err != nil {
-		return "", err
+		f.Close()
+		os.Remove(file)
+		return err
 	}
-	w.Flush()
 
-	return file, nil
+	return f.Close()
 }
 
-func importDatabase(file string, id string) (string, error) {
+func importDatabase(file string, id string, queryID string, options client.ImportOptions, onProgress func(client.ImportProgress)) (string, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return "", fmt.Errorf("no database client for database ID: %s", id)
+	}
+
 	f, err := os.Open(file)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 
-	reader := bufio.NewReader(f)
-	contents := ""
-	for {
-		line, err := reader.ReadString('\n') // FIXME: replace with ";" ig?
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return "", err
-		}
-		contents += line
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	err = dbClient.Import(ctx, bufio.NewReader(f), options, onProgress)
+	if err != nil {
+		return "", err
 	}
 
+	return file, nil
+}
+
+func previewCSV(file string, id string, options client.CSVImportOptions) (client.CSVPreview, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return client.CSVPreview{}, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return client.CSVPreview{}, err
+	}
+	defer f.Close()
+
+	return dbClient.PreviewCSV(context.Background(), bufio.NewReader(f), options)
+}
+
+func importCSV(file string, id string, queryID string, options client.CSVImportOptions, onProgress func(client.ImportProgress)) (string, error) {
 	dbClient, exists := dbClients[id]
 	if !exists {
 		return "", fmt.Errorf("no database client for database ID: %s", id)
 	}
 
-	err = dbClient.Import(contents)
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	err = dbClient.ImportCSV(ctx, bufio.NewReader(f), options, onProgress)
 	if err != nil {
 		return "", err
 	}
 
 	return file, nil
 }
+
+// copyTables runs as a query of the source connection, which cancels it.
+func copyTables(sourceID string, targetID string, queryID string, options client.CopyOptions, onProgress func(client.CopyProgress)) error {
+	source, exists := dbClients[sourceID]
+	if !exists {
+		return fmt.Errorf("no database client for database ID: %s", sourceID)
+	}
+	target, exists := dbClients[targetID]
+	if !exists {
+		return fmt.Errorf("no database client for database ID: %s", targetID)
+	}
+
+	ctx, done := startQuery(sourceID, queryID)
+	defer done()
+
+	return client.CopyTables(ctx, source, target, options, onProgress)
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"dbisous/app/client"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportDatabaseCSV(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+	dir := t.TempDir()
+
+	connection := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName, ConnectionString: filepath.Join(dir, "data.db")})
+	_, err := connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	defer disconnect(activeConnections, connection.ID)
+
+	err = execute(connection.ID, "setup", "CREATE TABLE a (id INTEGER); INSERT INTO a VALUES (1); CREATE TABLE b (name TEXT); INSERT INTO b VALUES ('x')")
+	r.NoError(err)
+
+	file := filepath.Join(dir, "export.csv")
+	options := client.ExportOptions{Type: client.CSV, Selected: []string{"main.a", "main.a.id"}, CSV: client.CSVOptions{Header: true}}
+	exported, err := exportDatabase(file, connection.ID, "export", options)
+	r.NoError(err)
+	r.Equal(file, exported)
+	contents, err := os.ReadFile(file)
+	r.NoError(err)
+	r.Equal("id\n1\n", string(contents))
+
+	options.Selected = []string{"main.a", "main.a.id", "main.b", "main.b.name"}
+	_, err = exportDatabase(file, connection.ID, "export", options)
+	r.NoError(err)
+	contents, err = os.ReadFile(filepath.Join(dir, "export_main.b.csv"))
+	r.NoError(err)
+	r.Equal("name\nx\n", string(contents), "Expected each table in its own file")
+
+	query := filepath.Join(dir, "query.csv")
+	_, err = exportQuery(query, connection.ID, "export", "SELECT id * 2 AS double FROM a", options)
+	r.NoError(err)
+	contents, err = os.ReadFile(query)
+	r.NoError(err)
+	r.Equal("double\n2\n", string(contents))
+
+	_, err = exportQuery(query, connection.ID, "export", "SELECT * FROM missing", options)
+	r.Error(err)
+	r.NoFileExists(query, "Expected a failed export to leave no file behind")
+}
+
+func TestImportDatabase(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+	dir := t.TempDir()
+
+	connection := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName, ConnectionString: filepath.Join(dir, "data.db")})
+	_, err := connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	defer disconnect(activeConnections, connection.ID)
+
+	file := filepath.Join(dir, "dump.sql")
+	err = os.WriteFile(file, []byte("CREATE TABLE a (id INTEGER NOT NULL);\nINSERT INTO a VALUES (1), (2);\nINSERT INTO a VALUES (NULL);\n"), 0644)
+	r.NoError(err)
+
+	statements := 0
+	_, err = importDatabase(file, connection.ID, "import", client.ImportOptions{}, func(progress client.ImportProgress) {
+		statements = progress.Statements
+	})
+	r.ErrorContains(err, "line 3")
+	r.Equal(2, statements)
+
+	err = os.WriteFile(file, []byte("CREATE TABLE b (id INTEGER);\nINSERT INTO b VALUES (1);\nINSERT INTO b VALUES (2);\n"), 0644)
+	r.NoError(err)
+	_, err = importDatabase(file, connection.ID, "import", client.ImportOptions{}, func(progress client.ImportProgress) {
+		r.NoError(cancelQuery(connection.ID, "import"))
+	})
+	r.ErrorIs(err, context.Canceled, "Expected the import to be cancellable")
+	r.Empty(runningQueries[connection.ID], "Expected the import to be released")
+}
+
+func TestDumpPostgresRoundTrip(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+	dir := t.TempDir()
+
+	connection := createTestConnection(t, db, Connection{Type: PostgreSQL, Name: testConnectionName, ConnectionString: testPostgresConnectionString})
+	_, err := connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	defer disconnect(activeConnections, connection.ID)
+
+	err = execute(connection.ID, "setup", `DROP SCHEMA IF EXISTS dump_test CASCADE;
+CREATE SCHEMA dump_test;
+CREATE TABLE dump_test.t (id serial PRIMARY KEY, a integer, b integer GENERATED ALWAYS AS (a * 2) STORED);
+CREATE TABLE dump_test.u (id integer GENERATED ALWAYS AS IDENTITY (START WITH 100 INCREMENT BY 10) PRIMARY KEY, name text);
+CREATE TABLE dump_test.v (id smallserial PRIMARY KEY);
+ALTER SEQUENCE dump_test.v_id_seq INCREMENT BY 5 MAXVALUE 1000 CACHE 2 CYCLE;
+INSERT INTO dump_test.t (a) VALUES (1), (2);
+INSERT INTO dump_test.u (name) VALUES ('x'), ('y')`)
+	r.NoError(err)
+	defer execute(connection.ID, "teardown", "DROP SCHEMA IF EXISTS dump_test CASCADE")
+
+	file := filepath.Join(dir, "dump.sql")
+	options := client.ExportOptions{Type: client.SQL, DropTable: client.DropAndCreate, Selected: []string{"dump_test.t", "dump_test.t.id", "dump_test.t.a", "dump_test.t.b", "dump_test.u", "dump_test.u.id", "dump_test.u.name", "dump_test.v", "dump_test.v.id"}}
+	_, err = exportDatabase(file, connection.ID, "export", options)
+	r.NoError(err)
+
+	_, err = importDatabase(file, connection.ID, "import", client.ImportOptions{}, func(client.ImportProgress) {})
+	r.NoError(err, "Expected the dump to be restorable")
+
+	err = execute(connection.ID, "insert", "INSERT INTO dump_test.t (a) VALUES (3); INSERT INTO dump_test.u (name) VALUES ('z')")
+	r.NoError(err, "Expected the sequences to be past the restored rows")
+	result, err := executeQuery(connection.ID, "check", "SELECT t.id, t.b, u.id FROM dump_test.t JOIN dump_test.u ON u.name = 'z' WHERE t.a = 3")
+	r.NoError(err)
+	r.Len(result.Rows, 1)
+
+	result, err = executeQuery(connection.ID, "check", `SELECT c.relname, format_type(s.seqtypid, NULL) AS type, s.seqincrement, s.seqmax, s.seqcache, s.seqcycle
+FROM pg_sequence s JOIN pg_class c ON c.oid = s.seqrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = 'dump_test' ORDER BY c.relname`)
+	r.NoError(err)
+	r.Len(result.Rows, 3)
+	r.Equal(client.Row{"relname": "u_id_seq", "type": "integer", "seqincrement": int64(10), "seqmax": int64(2147483647), "seqcache": int64(1), "seqcycle": false}, result.Rows[1], "Expected the identity options to be restored")
+	r.Equal(client.Row{"relname": "v_id_seq", "type": "smallint", "seqincrement": int64(5), "seqmax": int64(1000), "seqcache": int64(2), "seqcycle": true}, result.Rows[2], "Expected the sequence options to be restored")
+}
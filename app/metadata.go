@@ -2,6 +2,7 @@ package app
 
 import (
 	"database/sql"
+	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -27,6 +28,11 @@ func InitMetadataDB(path string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	err = createMasterPasswordTable(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -48,9 +54,59 @@ CREATE TABLE IF NOT EXISTS connection (
 		return err
 	}
 
+	err = addColumnIfNotExists(db, "connection", "statement_timeout", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists(db, "connection", "max_rows", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	// NOTE: rows of older versions keep their connection string in plain text
+	// until the secret storage is available
+	err = addColumnIfNotExists(db, "connection", "secret_storage", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	for _, column := range []struct{ name, definition string }{
+		{"ssh_host", "TEXT NOT NULL DEFAULT ''"},
+		{"ssh_port", "INTEGER NOT NULL DEFAULT 0"},
+		{"ssh_user", "TEXT NOT NULL DEFAULT ''"},
+		{"ssh_key_file", "TEXT NOT NULL DEFAULT ''"},
+		{"ssh_known_hosts", "TEXT NOT NULL DEFAULT ''"},
+		{"tls_ca", "TEXT NOT NULL DEFAULT ''"},
+		{"tls_cert", "TEXT NOT NULL DEFAULT ''"},
+		{"tls_key", "TEXT NOT NULL DEFAULT ''"},
+		{"tls_verify_mode", "TEXT NOT NULL DEFAULT ''"},
+		{"tls_server_name", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		err = addColumnIfNotExists(db, "connection", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// addColumnIfNotExists migrates metadata databases created by older versions.
+func addColumnIfNotExists(db *sql.DB, table string, column string, definition string) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
 func createPastQueryTable(db *sql.DB) error {
 	_, err := db.Exec(`
 CREATE TABLE IF NOT EXISTS past_query (
@@ -64,3 +120,19 @@ CREATE TABLE IF NOT EXISTS past_query (
 
 	return nil
 }
+
+// createMasterPasswordTable holds the salt of the master password key and a
+// value encrypted with it to check the password.
+func createMasterPasswordTable(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS master_password (
+  id INTEGER NOT NULL PRIMARY KEY CHECK (id = 1),
+  salt BLOB NOT NULL,
+  check_value BLOB NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
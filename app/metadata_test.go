@@ -1,6 +1,7 @@
 package app
 
 import (
+	"database/sql"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -22,3 +23,36 @@ func TestMetadata(t *testing.T) {
 	err = createPastQueryTable(db)
 	r.NoError(err)
 }
+
+func TestMetadataMigration(t *testing.T) {
+	r := require.New(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// NOTE: connection table as created by previous versions
+	_, err = db.Exec(`
+CREATE TABLE connection (
+  id TEXT NOT NULL PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  name TEXT NOT NULL,
+  type TEXT NOT NULL,
+  connection_string TEXT NOT NULL
+)`)
+	r.NoError(err)
+	_, err = db.Exec(`INSERT INTO connection (id, name, type, connection_string) VALUES ('old', 'Old', 'sqlite', ':memory:')`)
+	r.NoError(err)
+
+	err = createConnectionTable(db)
+	r.NoError(err)
+	err = createConnectionTable(db)
+	r.NoError(err, "Migration should be idempotent")
+
+	connections, err := getConnections(db)
+	r.NoError(err)
+	r.Len(connections, 1)
+	r.Equal(0, connections[0].StatementTimeout)
+	r.Equal(0, connections[0].MaxRows)
+}
@@ -1,52 +1,146 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"dbisous/app/client"
 	"fmt"
+	"io"
+	"sync"
 )
 
+var runningQueriesMu sync.Mutex
+var runningQueries = make(map[string]map[string]context.CancelFunc)
+
+// startQuery registers a cancellable query for the connection, the returned
+// func must be called once the query is done to release it.
+func startQuery(id string, queryID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runningQueriesMu.Lock()
+	defer runningQueriesMu.Unlock()
+	if runningQueries[id] == nil {
+		runningQueries[id] = make(map[string]context.CancelFunc)
+	}
+	runningQueries[id][queryID] = cancel
+
+	return ctx, func() {
+		runningQueriesMu.Lock()
+		defer runningQueriesMu.Unlock()
+		delete(runningQueries[id], queryID)
+		if len(runningQueries[id]) == 0 {
+			delete(runningQueries, id)
+		}
+		cancel()
+	}
+}
+
+func cancelQuery(id string, queryID string) error {
+	runningQueriesMu.Lock()
+	defer runningQueriesMu.Unlock()
+
+	cancel, exists := runningQueries[id][queryID]
+	if !exists {
+		return fmt.Errorf("no running query %s for database ID: %s", queryID, id)
+	}
+	cancel()
+
+	return nil
+}
+
+func cancelQueries(id string) {
+	runningQueriesMu.Lock()
+	defer runningQueriesMu.Unlock()
+
+	for _, cancel := range runningQueries[id] {
+		cancel()
+	}
+}
+
 func getConnectionDatabases(id string, params client.QueryParams) (client.QueryResult, error) {
 	dbClient, exists := dbClients[id]
 	if !exists {
 		return client.QueryResult{}, fmt.Errorf("no database client for database ID: %s", id)
 	}
 
-	return dbClient.GetConnectionDatabases(params)
+	return dbClient.GetConnectionDatabases(context.Background(), params)
 }
 
 func useDatabase(id string, connectionString string) error {
-	var dbType string
-	err := metadataDB.QueryRow(`SELECT type FROM connection WHERE id = ?`, id).Scan(&dbType)
+	var connection Connection
+	err := metadataDB.QueryRow(`SELECT type, statement_timeout, max_rows, tls_ca, tls_cert, tls_key, tls_verify_mode, tls_server_name FROM connection WHERE id = ?`, id).Scan(&connection.Type, &connection.StatementTimeout, &connection.MaxRows, &connection.TLS.CA, &connection.TLS.Cert, &connection.TLS.Key, &connection.TLS.VerifyMode, &connection.TLS.ServerName)
 	if err != nil {
 		return err
 	}
 
+	tunnelsMu.Lock()
+	t, tunneled := tunnels[id]
+	tunnelsMu.Unlock()
+	connectionString = driverConnectionString(connection.Type, connectionString)
+	connectionString, err = applyTLS(connection.Type, connectionString, connection.TLS, tlsConfigName(id), tunneled)
+	if err != nil {
+		return err
+	}
+	if tunneled {
+		settings, err := parseConnectionString(connection.Type, connectionString)
+		if err != nil {
+			return err
+		}
+		connectionString, err = throughTunnel(connection.Type, settings, t)
+		if err != nil {
+			return err
+		}
+	}
+
 	var db *sql.DB
-	switch dbType {
-	case string(MySQL):
+	var dbClient client.DatabaseClient
+	switch connection.Type {
+	case MySQL:
 		db, err = sql.Open("mysql", connectionString)
-		dbClients[id] = &client.MysqlClient{Db: db}
-	case string(PostgreSQL):
+		dbClient = &client.MysqlClient{Db: db, Limits: connection.limits()}
+	case PostgreSQL:
 		db, err = sql.Open("postgres", connectionString)
-		dbClients[id] = &client.PostgresClient{Db: db}
+		dbClient = &client.PostgresClient{Db: db, Limits: connection.limits()}
 	default:
-		return fmt.Errorf("unsupported database type: %s", dbType)
+		return fmt.Errorf("unsupported database type: %s", connection.Type)
+	}
+	if err != nil {
+		return err
 	}
+	// NOTE: keep the current database when the new one can't be reached
+	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return err
 	}
 
+	replaceClient(id, dbClient, db)
 	return nil
 }
 
+// replaceClient switches the connection to another pool, the running
+// queries, change set and sessions of the previous one being dropped before
+// it is closed.
+func replaceClient(id string, dbClient client.DatabaseClient, db *sql.DB) {
+	cancelQueries(id)
+	discardChanges(id)
+	// NOTE: before closing the pool, which waits for the pinned connections
+	closeSessions(id)
+	previous := activeConnections[id]
+	dbClients[id] = dbClient
+	activeConnections[id] = db
+	if previous != nil {
+		previous.Close()
+	}
+}
+
 func getDatabaseSchemas(id string, params client.QueryParams) (client.QueryResult, error) {
 	dbClient, exists := dbClients[id]
 	if !exists {
 		return client.QueryResult{}, fmt.Errorf("no database client for database ID: %s", id)
 	}
 
-	return dbClient.GetDatabaseSchemas(params)
+	return dbClient.GetDatabaseSchemas(context.Background(), params)
 }
 
 func getSchemaTables(id string, params client.QueryParams, schema string) (client.QueryResult, error) {
@@ -56,25 +150,101 @@ func getSchemaTables(id string, params client.QueryParams, schema string) (clien
 		return client.QueryResult{}, fmt.Errorf("no database client for database ID: %s", id)
 	}
 
-	return dbClient.GetSchemaTables(params, schema)
+	return dbClient.GetSchemaTables(context.Background(), params, schema)
 }
 
-func getTableRows(id string, params client.QueryParams, schema string, table string) (client.QueryResult, error) {
+func getTableRows(id string, queryID string, params client.QueryParams, schema string, table string) (client.QueryResult, error) {
 	dbClient, exists := dbClients[id]
 	if !exists {
 		return client.QueryResult{}, fmt.Errorf("no database client for database ID: %s", id)
 	}
 
-	return dbClient.GetTableRows(params, schema, table)
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	return dbClient.GetTableRows(ctx, params, schema, table)
+}
+
+func getTableMetadata(id string, schema string, table string) (client.TableMetadata, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return client.TableMetadata{}, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	return dbClient.GetTableMetadata(context.Background(), schema, table)
+}
+
+func getTableDDL(id string, schema string, table string) (string, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return "", fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	return dbClient.GetTableDDL(context.Background(), schema, table)
+}
+
+func getSchemaMetadata(id string, schema string) (client.SchemaMetadata, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return client.SchemaMetadata{}, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	return dbClient.GetSchemaMetadata(context.Background(), schema)
+}
+
+func diffSchemas(sourceID string, sourceSchema string, targetID string, targetSchema string) (client.SchemaDiff, error) {
+	source, exists := dbClients[sourceID]
+	if !exists {
+		return client.SchemaDiff{}, fmt.Errorf("no database client for database ID: %s", sourceID)
+	}
+	target, exists := dbClients[targetID]
+	if !exists {
+		return client.SchemaDiff{}, fmt.Errorf("no database client for database ID: %s", targetID)
+	}
+
+	return client.DiffSchemas(context.Background(), source, sourceSchema, target, targetSchema)
+}
+
+// diffTableData compares the table data, saving the sync script to file
+// unless it is empty.
+func diffTableData(sourceID string, sourceSchema string, targetID string, targetSchema string, table string, options client.DataDiffOptions, file string) (client.DataDiff, error) {
+	source, exists := dbClients[sourceID]
+	if !exists {
+		return client.DataDiff{}, fmt.Errorf("no database client for database ID: %s", sourceID)
+	}
+	target, exists := dbClients[targetID]
+	if !exists {
+		return client.DataDiff{}, fmt.Errorf("no database client for database ID: %s", targetID)
+	}
+
+	if file == "" {
+		return client.DiffTableData(context.Background(), source, sourceSchema, target, targetSchema, table, options, nil)
+	}
+
+	var diff client.DataDiff
+	err := exportToFile(file, func(w io.Writer) error {
+		var err error
+		diff, err = client.DiffTableData(context.Background(), source, sourceSchema, target, targetSchema, table, options, w)
+		return err
+	})
+	if err != nil {
+		return diff, err
+	}
+	diff.Script = file
+
+	return diff, nil
 }
 
-func executeQuery(id string, query string) (client.QueryResult, error) {
+func executeQuery(id string, queryID string, query string) (client.QueryResult, error) {
 	dbClient, exists := dbClients[id]
 	if !exists {
 		return client.QueryResult{}, fmt.Errorf("no database client for database ID: %s", id)
 	}
 
-	result, err := dbClient.ExecuteQuery(query)
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	result, err := dbClient.ExecuteQuery(ctx, query)
 	if err != nil {
 		return result, err
 	}
@@ -87,16 +257,77 @@ func executeQuery(id string, query string) (client.QueryResult, error) {
 	return result, nil
 }
 
-func execute(id string, query string) error {
+func executeScript(id string, queryID string, script string, stopOnError bool) ([]client.ScriptResult, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return nil, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	results, err := dbClient.ExecuteScript(ctx, script, stopOnError)
+	if err != nil {
+		return results, err
+	}
+
+	err = insertPastQuery(metadataDB, script)
+	if err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+func execute(id string, queryID string, query string) error {
 	dbClient, exists := dbClients[id]
 	if !exists {
 		return fmt.Errorf("no database client for database ID: %s", id)
 	}
 
-	err := dbClient.Execute(query)
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	err := dbClient.Execute(ctx, query)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func updateRows(id string, queryID string, schema string, table string, changes []client.RowChange) ([]int64, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return nil, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	return client.UpdateRows(ctx, dbClient, schema, table, changes)
+}
+
+func insertRows(id string, queryID string, schema string, table string, rows []client.Row) ([]int64, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return nil, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	return client.InsertRows(ctx, dbClient, schema, table, rows)
+}
+
+func deleteRows(id string, queryID string, schema string, table string, keys []client.Row) ([]int64, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return nil, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	return client.DeleteRows(ctx, dbClient, schema, table, keys)
+}
@@ -1,17 +1,20 @@
 package app
 
 import (
+	"database/sql"
 	"dbisous/app/client"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestGetConnectionDatabases(t *testing.T) {
 	r := require.New(t)
-	db, err := InitMetadataDB(":memory:")
-	r.NoError(err)
-	defer db.Close()
+	db := setupTestDB(t)
 
 	_ = createConnection(db, Connection{Type: PostgreSQL, Name: testConnectionName, ConnectionString: testPostgresConnectionString})
 	connections, err := getConnections(db)
@@ -19,10 +22,117 @@ func TestGetConnectionDatabases(t *testing.T) {
 	connect(activeConnections, db, connection.ID)
 
 	filters := make([]client.QueryFilter, 0)
-	filters = append(filters, client.QueryFilter{Column: "datname", Value: "'dbisous_test'"})
+	filters = append(filters, client.QueryFilter{Column: "datname", Operator: client.Equal, Value: "dbisous_test"})
 	result, err := getConnectionDatabases(connection.ID, client.QueryParams{Offset: 0, Limit: 10, Filter: filters})
 	r.NoError(err)
 	r.Equal(1, len(result.Rows), "Couldn't get databases")
 
 	// TODO: add separate tests for each param (offset, limit, filters, order)
 }
+
+func TestCancelQuery(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+
+	connection := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName, ConnectionString: ":memory:"})
+	_, err := connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	defer disconnect(activeConnections, connection.ID)
+
+	err = cancelQuery(connection.ID, "unknown")
+	r.Error(err, "Expected an error when cancelling a query that is not running")
+
+	errs := make(chan error)
+	go func() {
+		_, err := getTableRows(connection.ID, "endless", client.QueryParams{Limit: 1}, "main", "(WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n) SELECT x FROM n ORDER BY x DESC)")
+		errs <- err
+	}()
+
+	r.Eventually(func() bool {
+		return cancelQuery(connection.ID, "endless") == nil
+	}, time.Second, 10*time.Millisecond, "Query never started")
+
+	select {
+	case err := <-errs:
+		r.Error(err, "Expected the cancelled query to fail")
+	case <-time.After(5 * time.Second):
+		r.FailNow("Query was not interrupted after cancel")
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+
+	connection := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName, ConnectionString: ":memory:", StatementTimeout: 1, MaxRows: 5})
+	r.Equal(1, connection.StatementTimeout)
+	r.Equal(5, connection.MaxRows)
+
+	_, err := connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	defer disconnect(activeConnections, connection.ID)
+
+	result, err := getTableRows(connection.ID, "limited", client.QueryParams{Limit: 100}, "main", "(WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n LIMIT 100) SELECT x FROM n)")
+	r.NoError(err)
+	r.Len(result.Rows, 5, "Expected rows to be capped to max_rows")
+	r.True(result.Truncated, "Expected result to be flagged as truncated")
+
+	start := time.Now()
+	_, err = getTableRows(connection.ID, "endless", client.QueryParams{Limit: 1}, "main", "(WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n) SELECT x FROM n ORDER BY x DESC)")
+	r.Error(err, "Expected the query to time out")
+	r.Less(time.Since(start), 5*time.Second, "Query was not interrupted by the statement timeout")
+}
+
+func TestDiffTableDataScript(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+	dir := t.TempDir()
+
+	source := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName, ConnectionString: filepath.Join(dir, "source.db")})
+	target := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName + " target", ConnectionString: filepath.Join(dir, "target.db")})
+	for _, connection := range []Connection{source, target} {
+		_, err := connect(activeConnections, db, connection.ID)
+		r.NoError(err)
+		defer disconnect(activeConnections, connection.ID)
+		err = execute(connection.ID, "setup", "CREATE TABLE t (id INTEGER PRIMARY KEY)")
+		r.NoError(err)
+	}
+	err := execute(source.ID, "setup", "INSERT INTO t VALUES (1), (2), (3)")
+	r.NoError(err)
+
+	file := filepath.Join(dir, "sync.sql")
+	diff, err := diffTableData(source.ID, "main", target.ID, "main", "t", client.DataDiffOptions{Limit: 1}, file)
+	r.NoError(err)
+	r.Equal(file, diff.Script)
+	r.Len(diff.Rows, 1)
+	contents, err := os.ReadFile(file)
+	r.NoError(err)
+	r.Equal(3, strings.Count(string(contents), "INSERT INTO"), "Expected the script to be written to the file, past the limit")
+
+	diff, err = diffTableData(source.ID, "main", target.ID, "main", "t", client.DataDiffOptions{}, "")
+	r.NoError(err)
+	r.Empty(diff.Script)
+}
+
+func TestReplaceClient(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+	dir := t.TempDir()
+
+	connection := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName, ConnectionString: filepath.Join(dir, "a.db")})
+	_, err := connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	defer disconnect(activeConnections, connection.ID)
+	previous := activeConnections[connection.ID]
+	_, err = beginSession(connection.ID, "tab")
+	r.NoError(err)
+
+	other, err := sql.Open("sqlite3", filepath.Join(dir, "b.db"))
+	r.NoError(err)
+	replaceClient(connection.ID, &client.SqliteClient{Db: other}, other)
+	r.Same(other, activeConnections[connection.ID])
+	r.Same(other, dbClients[connection.ID].(*client.SqliteClient).Db)
+	r.Error(previous.Ping(), "Expected the previous pool to be closed")
+	r.False(inTransaction(connection.ID, "tab"), "Expected the sessions of the previous pool to be closed")
+	r.NoError(execute(connection.ID, "check", "CREATE TABLE b (id INTEGER)"))
+}
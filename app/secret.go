@@ -0,0 +1,302 @@
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// secretStorage tells where the connection string of a connection, which
+// holds its credentials, is kept.
+type secretStorage string
+
+const (
+	plainStorage          secretStorage = ""                // written by older versions, moved on unlock
+	keyringStorage        secretStorage = "keyring"         // in the system keyring, nothing in the metadata database
+	masterPasswordStorage secretStorage = "master_password" // encrypted in the metadata database
+)
+
+// SecretsStatus is what the frontend needs to ask for the master password.
+type SecretsStatus struct {
+	Keyring           bool   `json:"keyring"`             // secrets go to the system keyring
+	HasMasterPassword bool   `json:"has_master_password"` // false until the first unlock sets it
+	Locked            bool   `json:"locked"`              // the master password is needed to read or save connections
+	MigrationError    string `json:"migration_error"`     // why connection strings were left in plain text, if they were
+}
+
+// keyring stores the secrets of the connections by connection ID.
+type keyring interface {
+	get(id string) (string, error)
+	set(id string, secret string) error
+	delete(id string) error
+}
+
+var errSecretsLocked = errors.New("the master password is required to read the connection credentials")
+
+var secretsMu sync.Mutex
+var systemKeyring keyring // nil when the system has none
+var masterKey []byte      // nil until unlocked
+var migrationErr error    // the last failure to move the plain text connection strings
+
+// NOTE: argon2id parameters recommended by RFC 9106 for memory constrained
+// environments
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	keyLength    = 32
+)
+
+// masterPasswordCheck is encrypted with the key to verify the master password.
+const masterPasswordCheck = "dbisous"
+
+// openSecrets uses the system keyring when there is one, moving the
+// connection strings still in plain text to it.
+func openSecrets(db *sql.DB) error {
+	k := openKeyring()
+	if k == nil {
+		return nil
+	}
+
+	secretsMu.Lock()
+	systemKeyring = k
+	secretsMu.Unlock()
+
+	return migrateSecrets(db)
+}
+
+func getSecretsStatus(db *sql.DB) (SecretsStatus, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM master_password`).Scan(&count)
+	if err != nil {
+		return SecretsStatus{}, err
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	var locked int
+	if masterKey == nil {
+		err = db.QueryRow(`SELECT COUNT(*) FROM connection WHERE secret_storage = ?`, masterPasswordStorage).Scan(&locked)
+		if err != nil {
+			return SecretsStatus{}, err
+		}
+	}
+
+	status := SecretsStatus{
+		Keyring:           systemKeyring != nil,
+		HasMasterPassword: count > 0,
+		Locked:            masterKey == nil && (systemKeyring == nil || locked > 0),
+	}
+	if migrationErr != nil {
+		status.MigrationError = migrationErr.Error()
+	}
+	return status, nil
+}
+
+// unlockSecrets derives the key from the master password, setting it the
+// first time, and moves the connection strings still in plain text.
+func unlockSecrets(db *sql.DB, password string) error {
+	if password == "" {
+		return fmt.Errorf("the master password can't be empty")
+	}
+
+	var salt, check []byte
+	err := db.QueryRow(`SELECT salt, check_value FROM master_password`).Scan(&salt, &check)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		salt = make([]byte, 16)
+		_, err = rand.Read(salt)
+		if err != nil {
+			return err
+		}
+		key := deriveKey(password, salt)
+		check, err = encrypt(key, "master_password", masterPasswordCheck)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`INSERT INTO master_password (id, salt, check_value) VALUES (1, ?, ?)`, salt, check)
+		if err != nil {
+			return err
+		}
+		setMasterKey(key)
+	case err != nil:
+		return err
+	default:
+		key := deriveKey(password, salt)
+		value, err := decrypt(key, "master_password", check)
+		if err != nil || value != masterPasswordCheck {
+			return fmt.Errorf("wrong master password")
+		}
+		setMasterKey(key)
+	}
+
+	return migrateSecrets(db)
+}
+
+func setMasterKey(key []byte) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	masterKey = key
+}
+
+func deriveKey(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, keyLength)
+}
+
+// encrypt seals the secret with AES-GCM, the ID of its connection being
+// authenticated so that a ciphertext can't be moved to another row.
+func encrypt(key []byte, id string, secret string) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, []byte(secret), []byte(id)), nil
+}
+
+func decrypt(key []byte, id string, sealed []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted secret for connection ID: %s", id)
+	}
+	secret, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(id))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// secrets returns the keyring and the master key, the lock being released
+// before the keyring is used as it may wait for the user to unlock it.
+func secrets() (keyring, []byte) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	return systemKeyring, masterKey
+}
+
+// sealSecret stores the secret of the connection and returns where it went
+// and what is left in the connection record.
+func sealSecret(id string, secret string) (secretStorage, string, error) {
+	k, key := secrets()
+	if k != nil {
+		err := k.set(id, secret)
+		if err != nil {
+			return "", "", err
+		}
+		return keyringStorage, "", nil
+	}
+	if key == nil {
+		return "", "", errSecretsLocked
+	}
+	sealed, err := encrypt(key, id, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return masterPasswordStorage, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret reads the secret of the connection from where it was stored.
+func openSecret(id string, storage secretStorage, stored string) (string, error) {
+	k, key := secrets()
+	switch storage {
+	case plainStorage:
+		return stored, nil
+	case keyringStorage:
+		if k == nil {
+			return "", fmt.Errorf("no system keyring for the credentials of connection ID: %s", id)
+		}
+		return k.get(id)
+	case masterPasswordStorage:
+		if key == nil {
+			return "", errSecretsLocked
+		}
+		sealed, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil {
+			return "", err
+		}
+		return decrypt(key, id, sealed)
+	}
+	return "", fmt.Errorf("unknown secret storage: %s", storage)
+}
+
+func deleteSecret(id string, storage secretStorage) error {
+	if storage != keyringStorage {
+		return nil
+	}
+
+	// NOTE: the connection can still be deleted when the keyring is gone
+	k, _ := secrets()
+	if k == nil {
+		return nil
+	}
+	return k.delete(id)
+}
+
+// migrateSecrets moves the connection strings left in plain text by older
+// versions to the secret storage.
+func migrateSecrets(db *sql.DB) (err error) {
+	// NOTE: kept for the frontend, as the migration runs on startup too
+	defer func() {
+		secretsMu.Lock()
+		migrationErr = err
+		secretsMu.Unlock()
+	}()
+
+	rows, err := db.Query(`SELECT id, connection_string FROM connection WHERE secret_storage = ?`, plainStorage)
+	if err != nil {
+		return err
+	}
+	plain := make(map[string]string)
+	for rows.Next() {
+		var id, connectionString string
+		err = rows.Scan(&id, &connectionString)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		plain[id] = connectionString
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, connectionString := range plain {
+		storage, stored, err := sealSecret(id, connectionString)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`UPDATE connection SET connection_string = ?, secret_storage = ? WHERE id = ?`, stored, storage, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+//go:build linux
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// secretService stores the secrets with the Secret Service D-Bus API, which
+// GNOME Keyring and KWallet implement.
+type secretService struct {
+	conn       *dbus.Conn
+	session    dbus.ObjectPath
+	collection dbus.ObjectPath
+}
+
+// secretServiceSecret is the Secret struct of the Secret Service API.
+type secretServiceSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+const (
+	secretServiceName = "org.freedesktop.secrets"
+	secretServicePath = dbus.ObjectPath("/org/freedesktop/secrets")
+	promptTimeout     = 2 * time.Minute
+)
+
+// openKeyring connects to the Secret Service of the session, returning nil
+// when there is none or it has no default collection.
+func openKeyring() keyring {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil
+	}
+	s := &secretService{conn: conn}
+
+	// NOTE: the secrets are only sent in plain text over the session bus
+	var output dbus.Variant
+	err = s.service().Call("org.freedesktop.Secret.Service.OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &s.session)
+	if err != nil {
+		return nil
+	}
+	err = s.service().Call("org.freedesktop.Secret.Service.ReadAlias", 0, "default").Store(&s.collection)
+	if err != nil || s.collection == "/" {
+		return nil
+	}
+
+	return s
+}
+
+func (s *secretService) service() dbus.BusObject {
+	return s.conn.Object(secretServiceName, secretServicePath)
+}
+
+func (s *secretService) attributes(id string) map[string]string {
+	return map[string]string{"application": "dbisous", "connection": id}
+}
+
+// prompt shows the prompt the service asked for, to unlock the keyring, and
+// waits for the user, dismissing it when there is no answer in time.
+func (s *secretService) prompt(prompt dbus.ObjectPath) error {
+	if prompt == "/" {
+		return nil
+	}
+
+	options := []dbus.MatchOption{dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface("org.freedesktop.Secret.Prompt"), dbus.WithMatchMember("Completed")}
+	err := s.conn.AddMatchSignal(options...)
+	if err != nil {
+		return err
+	}
+	defer s.conn.RemoveMatchSignal(options...)
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), promptTimeout)
+	defer cancel()
+	err = s.conn.Object(secretServiceName, prompt).CallWithContext(ctx, "org.freedesktop.Secret.Prompt.Prompt", 0, "").Err
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case signal, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("the Secret Service connection was closed")
+			}
+			if signal.Path != prompt || signal.Name != "org.freedesktop.Secret.Prompt.Completed" || len(signal.Body) == 0 {
+				continue
+			}
+			if dismissed, _ := signal.Body[0].(bool); dismissed {
+				return fmt.Errorf("the keyring was not unlocked")
+			}
+			return nil
+		case <-ctx.Done():
+			s.conn.Object(secretServiceName, prompt).Call("org.freedesktop.Secret.Prompt.Dismiss", 0)
+			return fmt.Errorf("the keyring was not unlocked in time")
+		}
+	}
+}
+
+func (s *secretService) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.service().Call("org.freedesktop.Secret.Service.Unlock", 0, objects).Store(&unlocked, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(prompt)
+}
+
+func (s *secretService) search(id string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.service().Call("org.freedesktop.Secret.Service.SearchItems", 0, s.attributes(id)).Store(&unlocked, &locked)
+	if err != nil {
+		return nil, err
+	}
+	if len(locked) > 0 {
+		err = s.unlock(locked)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(unlocked, locked...), nil
+}
+
+func (s *secretService) get(id string) (string, error) {
+	items, err := s.search(id)
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "", fmt.Errorf("no keyring secret for connection ID: %s", id)
+	}
+
+	var secret secretServiceSecret
+	err = s.conn.Object(secretServiceName, items[0]).Call("org.freedesktop.Secret.Item.GetSecret", 0, s.session).Store(&secret)
+	if err != nil {
+		return "", err
+	}
+	return string(secret.Value), nil
+}
+
+func (s *secretService) set(id string, value string) error {
+	err := s.unlock([]dbus.ObjectPath{s.collection})
+	if err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant("DBisous connection " + id),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(s.attributes(id)),
+	}
+	secret := secretServiceSecret{Session: s.session, Parameters: []byte{}, Value: []byte(value), ContentType: "text/plain; charset=utf8"}
+	var item, prompt dbus.ObjectPath
+	err = s.conn.Object(secretServiceName, s.collection).Call("org.freedesktop.Secret.Collection.CreateItem", 0, properties, secret, true).Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(prompt)
+}
+
+func (s *secretService) delete(id string) error {
+	items, err := s.search(id)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		err = s.conn.Object(secretServiceName, item).Call("org.freedesktop.Secret.Item.Delete", 0).Store(&prompt)
+		if err != nil {
+			return err
+		}
+		err = s.prompt(prompt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
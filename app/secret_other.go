@@ -0,0 +1,9 @@
+//go:build !linux
+
+package app
+
+// openKeyring returns nil as only the Secret Service of Linux is supported,
+// the master password being used on other systems.
+func openKeyring() keyring {
+	return nil
+}
@@ -0,0 +1,248 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKeyring keeps the secrets in memory, standing for the system keyring.
+type fakeKeyring map[string]string
+
+func (k fakeKeyring) get(id string) (string, error) {
+	secret, exists := k[id]
+	if !exists {
+		return "", fmt.Errorf("no keyring secret for connection ID: %s", id)
+	}
+	return secret, nil
+}
+
+func (k fakeKeyring) set(id string, secret string) error {
+	k[id] = secret
+	return nil
+}
+
+func (k fakeKeyring) delete(id string) error {
+	delete(k, id)
+	return nil
+}
+
+// insertPlainConnection adds a connection the way older versions did, with
+// its connection string in plain text.
+func insertPlainConnection(t *testing.T, db *sql.DB, id string, connectionString string) {
+	t.Helper()
+	_, err := db.Exec(`INSERT INTO connection (id, name, type, connection_string) VALUES (?, 'Old', 'postgresql', ?)`, id, connectionString)
+	require.NoError(t, err)
+}
+
+func storedConnection(t *testing.T, db *sql.DB, id string) (string, secretStorage) {
+	t.Helper()
+	var stored string
+	var storage secretStorage
+	err := db.QueryRow(`SELECT connection_string, secret_storage FROM connection WHERE id = ?`, id).Scan(&stored, &storage)
+	require.NoError(t, err)
+	return stored, storage
+}
+
+func TestMasterPassword(t *testing.T) {
+	r := require.New(t)
+	db, err := InitMetadataDB(":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { setMasterKey(nil) })
+
+	insertPlainConnection(t, db, "old", testPostgresConnectionString)
+
+	status, err := getSecretsStatus(db)
+	r.NoError(err)
+	r.Equal(SecretsStatus{Locked: true}, status)
+
+	connections, err := getConnections(db)
+	r.NoError(err, "Plain text rows should be readable before the migration")
+	r.Equal(testPostgresConnectionString, connections[0].ConnectionString)
+
+	err = createConnection(db, Connection{Type: SQLite, Name: "New", ConnectionString: ":memory:"})
+	r.ErrorIs(err, errSecretsLocked)
+
+	err = unlockSecrets(db, "")
+	r.Error(err)
+	err = unlockSecrets(db, "master password")
+	r.NoError(err)
+
+	stored, storage := storedConnection(t, db, "old")
+	r.Equal(masterPasswordStorage, storage)
+	r.NotContains(stored, "postgres:postgres", "The password should be encrypted")
+
+	connections, err = getConnections(db)
+	r.NoError(err)
+	r.Equal(testPostgresConnectionString, connections[0].ConnectionString)
+
+	// NOTE: as after a restart
+	setMasterKey(nil)
+	status, err = getSecretsStatus(db)
+	r.NoError(err)
+	r.Equal(SecretsStatus{HasMasterPassword: true, Locked: true}, status)
+	_, err = getConnections(db)
+	r.ErrorIs(err, errSecretsLocked)
+
+	err = unlockSecrets(db, "wrong password")
+	r.EqualError(err, "wrong master password")
+	err = unlockSecrets(db, "master password")
+	r.NoError(err)
+
+	connections, err = getConnections(db)
+	r.NoError(err)
+	r.Equal(testPostgresConnectionString, connections[0].ConnectionString)
+}
+
+func TestSecretBoundToConnection(t *testing.T) {
+	r := require.New(t)
+	key := deriveKey("master password", []byte("salt"))
+
+	sealed, err := encrypt(key, "a", "secret")
+	r.NoError(err)
+	secret, err := decrypt(key, "a", sealed)
+	r.NoError(err)
+	r.Equal("secret", secret)
+
+	_, err = decrypt(key, "b", sealed)
+	r.Error(err, "A secret moved to another connection should not decrypt")
+	_, err = decrypt(deriveKey("other password", []byte("salt")), "a", sealed)
+	r.Error(err)
+}
+
+func TestKeyring(t *testing.T) {
+	r := require.New(t)
+	db, err := InitMetadataDB(":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	k := fakeKeyring{}
+	systemKeyring = k
+	t.Cleanup(func() { systemKeyring = nil })
+
+	insertPlainConnection(t, db, "old", testPostgresConnectionString)
+	err = migrateSecrets(db)
+	r.NoError(err)
+
+	stored, storage := storedConnection(t, db, "old")
+	r.Equal(keyringStorage, storage)
+	r.Empty(stored, "Nothing should be left in the metadata database")
+	r.Equal(testPostgresConnectionString, k["old"])
+
+	status, err := getSecretsStatus(db)
+	r.NoError(err)
+	r.Equal(SecretsStatus{Keyring: true}, status)
+
+	connection := createTestConnection(t, db, Connection{Type: SQLite, Name: "New", ConnectionString: ":memory:"})
+	r.Equal(":memory:", k[connection.ID])
+
+	connection.ConnectionString = "data.db"
+	err = updateConnection(db, connection)
+	r.NoError(err)
+	r.Equal("data.db", k[connection.ID])
+
+	err = deleteConnection(db, connection.ID)
+	r.NoError(err)
+	r.NotContains(k, connection.ID)
+}
+
+// promptingKeyring waits for the user to answer the unlock prompt before
+// storing a secret.
+type promptingKeyring struct {
+	fakeKeyring
+	prompted chan struct{}
+	answered chan struct{}
+}
+
+func (k promptingKeyring) set(id string, secret string) error {
+	close(k.prompted)
+	<-k.answered
+	return k.fakeKeyring.set(id, secret)
+}
+
+func TestKeyringPrompt(t *testing.T) {
+	r := require.New(t)
+	db, err := InitMetadataDB(":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	k := promptingKeyring{fakeKeyring: fakeKeyring{}, prompted: make(chan struct{}), answered: make(chan struct{})}
+	systemKeyring = k
+	t.Cleanup(func() { systemKeyring = nil })
+
+	sealed := make(chan error)
+	go func() {
+		_, _, err := sealSecret("new", ":memory:")
+		sealed <- err
+	}()
+	<-k.prompted
+
+	// NOTE: the other secrets are still there while the prompt waits
+	done := make(chan error)
+	go func() {
+		_, err := getSecretsStatus(db)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		r.NoError(err)
+	case <-time.After(5 * time.Second):
+		r.FailNow("The secrets should not be locked while the keyring prompt waits")
+	}
+	value, err := openSecret("old", plainStorage, "data.db")
+	r.NoError(err)
+	r.Equal("data.db", value)
+
+	close(k.answered)
+	r.NoError(<-sealed)
+	r.Equal(":memory:", k.fakeKeyring["new"])
+}
+
+// failingKeyring refuses to store any secret.
+type failingKeyring struct {
+	fakeKeyring
+}
+
+func (k failingKeyring) set(id string, secret string) error {
+	return fmt.Errorf("keyring is read-only")
+}
+
+func TestMigrationError(t *testing.T) {
+	r := require.New(t)
+	db, err := InitMetadataDB(":memory:")
+	r.NoError(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	systemKeyring = failingKeyring{fakeKeyring{}}
+	t.Cleanup(func() {
+		systemKeyring = nil
+		migrationErr = nil
+	})
+
+	insertPlainConnection(t, db, "old", testPostgresConnectionString)
+	err = migrateSecrets(db)
+	r.Error(err)
+
+	status, err := getSecretsStatus(db)
+	r.NoError(err)
+	r.Contains(status.MigrationError, "keyring is read-only")
+
+	stored, storage := storedConnection(t, db, "old")
+	r.Equal(plainStorage, storage)
+	r.Equal(testPostgresConnectionString, stored)
+
+	systemKeyring = fakeKeyring{}
+	err = migrateSecrets(db)
+	r.NoError(err)
+	status, err = getSecretsStatus(db)
+	r.NoError(err)
+	r.Empty(status.MigrationError)
+}
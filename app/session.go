@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"dbisous/app/client"
+	"fmt"
+	"sync"
+)
+
+// sessions holds the pinned connections of the editor tabs, by connection ID
+// then session ID.
+var sessionsMu sync.Mutex
+var sessions = make(map[string]map[string]*client.Session)
+
+// getSession returns the session of the editor tab, pinning a connection the
+// first time.
+func getSession(id string, sessionID string) (*client.Session, error) {
+	dbClient, exists := dbClients[id]
+	if !exists {
+		return nil, fmt.Errorf("no database client for database ID: %s", id)
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	if session, exists := sessions[id][sessionID]; exists {
+		return session, nil
+	}
+	session, err := client.NewSession(context.Background(), dbClient)
+	if err != nil {
+		return nil, err
+	}
+	if sessions[id] == nil {
+		sessions[id] = make(map[string]*client.Session)
+	}
+	sessions[id][sessionID] = session
+
+	return session, nil
+}
+
+func beginSession(id string, sessionID string) (bool, error) {
+	session, err := getSession(id, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	err = session.Begin(context.Background())
+	return session.InTransaction(), err
+}
+
+func commitSession(id string, sessionID string) (bool, error) {
+	session, err := getSession(id, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	err = session.Commit(context.Background())
+	return session.InTransaction(), err
+}
+
+func rollbackSession(id string, sessionID string) (bool, error) {
+	session, err := getSession(id, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	err = session.Rollback(context.Background())
+	return session.InTransaction(), err
+}
+
+// inTransaction tells whether the session has an open transaction, without
+// pinning a connection for it.
+func inTransaction(id string, sessionID string) bool {
+	sessionsMu.Lock()
+	session, exists := sessions[id][sessionID]
+	sessionsMu.Unlock()
+
+	return exists && session.InTransaction()
+}
+
+func executeSessionQuery(id string, sessionID string, queryID string, query string) (client.QueryResult, error) {
+	session, err := getSession(id, sessionID)
+	if err != nil {
+		return client.QueryResult{}, err
+	}
+
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	result, err := session.ExecuteQuery(ctx, query)
+	if err != nil {
+		return result, err
+	}
+
+	err = insertPastQuery(metadataDB, query)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func executeSessionScript(id string, sessionID string, queryID string, script string, stopOnError bool) ([]client.ScriptResult, error) {
+	session, err := getSession(id, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, done := startQuery(id, queryID)
+	defer done()
+
+	results := session.ExecuteScript(ctx, script, stopOnError)
+
+	err = insertPastQuery(metadataDB, script)
+	if err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+// closeSession releases the connection of the editor tab, rolling back its
+// open transaction.
+func closeSession(id string, sessionID string) error {
+	sessionsMu.Lock()
+	session, exists := sessions[id][sessionID]
+	delete(sessions[id], sessionID)
+	if len(sessions[id]) == 0 {
+		delete(sessions, id)
+	}
+	sessionsMu.Unlock()
+
+	if !exists {
+		return nil
+	}
+	return session.Close()
+}
+
+// closeSessions releases every session of the connection.
+func closeSessions(id string) {
+	sessionsMu.Lock()
+	closing := sessions[id]
+	delete(sessions, id)
+	sessionsMu.Unlock()
+
+	for _, session := range closing {
+		session.Close()
+	}
+}
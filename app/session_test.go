@@ -0,0 +1,45 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionRollbackOnDisconnect(t *testing.T) {
+	r := require.New(t)
+	db := setupTestDB(t)
+
+	connection := createTestConnection(t, db, Connection{Type: SQLite, Name: testConnectionName, ConnectionString: filepath.Join(t.TempDir(), "data.db")})
+	_, err := connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	err = execute(connection.ID, "setup", "CREATE TABLE t (id INTEGER)")
+	r.NoError(err)
+
+	r.False(inTransaction(connection.ID, "tab"))
+	open, err := beginSession(connection.ID, "tab")
+	r.NoError(err)
+	r.True(open)
+	r.True(inTransaction(connection.ID, "tab"))
+	session, err := getSession(connection.ID, "tab")
+	r.NoError(err)
+	_, err = session.ExecuteQuery(context.Background(), "INSERT INTO t VALUES (1)")
+	r.NoError(err)
+
+	r.NoError(disconnect(activeConnections, connection.ID))
+	r.False(inTransaction(connection.ID, "tab"))
+
+	_, err = connect(activeConnections, db, connection.ID)
+	r.NoError(err)
+	defer disconnect(activeConnections, connection.ID)
+	result, err := dbClients[connection.ID].ExecuteQuery(context.Background(), "SELECT count(*) AS n FROM t")
+	r.NoError(err)
+	r.Equal(int64(0), result.Rows[0]["n"], "Expected the open transaction to be rolled back")
+
+	open, err = rollbackSession(connection.ID, "tab")
+	r.Error(err, "Expected no transaction in a new session")
+	r.False(open)
+	r.NoError(closeSession(connection.ID, "tab"))
+}
@@ -0,0 +1,212 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type TLSVerifyMode string
+
+const (
+	TLSDisabled   TLSVerifyMode = ""            // the TLS settings are not used, the connection string decides
+	TLSRequire    TLSVerifyMode = "require"     // encrypted, the server certificate isn't verified
+	TLSVerifyCA   TLSVerifyMode = "verify-ca"   // the server certificate is signed by the CA
+	TLSVerifyFull TLSVerifyMode = "verify-full" // and issued for the server name
+)
+
+var AllTLSVerifyModes = []struct {
+	Value  TLSVerifyMode
+	TSName string
+}{
+	{TLSDisabled, "Disabled"},
+	{TLSRequire, "Require"},
+	{TLSVerifyCA, "VerifyCA"},
+	{TLSVerifyFull, "VerifyFull"},
+}
+
+// TLSSettings configure the TLS connection to the database, the files being
+// PEM encoded.
+type TLSSettings struct {
+	CA         string        `json:"ca"`   // the system roots are used when empty
+	Cert       string        `json:"cert"` // client certificate, with Key
+	Key        string        `json:"key"`
+	VerifyMode TLSVerifyMode `json:"verify_mode"`
+	ServerName string        `json:"server_name"` // the host when empty
+}
+
+// tlsConfigName is the name the TLS config of the connection is registered
+// with in the mysql driver.
+func tlsConfigName(id string) string {
+	return "dbisous-" + id
+}
+
+// validate checks the settings and their files, to report what is wrong
+// before the driver fails with a less helpful error.
+func (s TLSSettings) validate(dbType ConnectionType, tunneled bool) error {
+	switch s.VerifyMode {
+	case TLSDisabled:
+		if s.CA != "" || s.Cert != "" || s.Key != "" || s.ServerName != "" {
+			return fmt.Errorf("choose a TLS verify mode to use the TLS settings")
+		}
+		return nil
+	case TLSRequire, TLSVerifyCA, TLSVerifyFull:
+	default:
+		return fmt.Errorf("unknown TLS verify mode: %s", s.VerifyMode)
+	}
+
+	switch dbType {
+	case PostgreSQL:
+		// NOTE: lib/pq always checks the certificate against the host
+		if s.ServerName != "" {
+			return fmt.Errorf("the TLS server name can't be set for PostgreSQL connections, use verify-ca instead")
+		}
+		// NOTE: so it would check the certificate against the local end of the tunnel
+		if s.VerifyMode == TLSVerifyFull && tunneled {
+			return fmt.Errorf("verify-full can't be used for PostgreSQL connections through an SSH tunnel, use verify-ca instead")
+		}
+	case MySQL:
+	default:
+		return fmt.Errorf("no TLS for %s databases", dbType)
+	}
+
+	if s.CA != "" {
+		_, err := s.rootCAs()
+		if err != nil {
+			return err
+		}
+	}
+	if s.Cert != "" || s.Key != "" {
+		_, err := s.certificate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s TLSSettings) rootCAs() (*x509.CertPool, error) {
+	ca, err := os.ReadFile(s.CA)
+	if err != nil {
+		return nil, fmt.Errorf("TLS CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no PEM certificate in the TLS CA file %s", s.CA)
+	}
+	return roots, nil
+}
+
+func (s TLSSettings) certificate() (tls.Certificate, error) {
+	if s.Cert == "" || s.Key == "" {
+		return tls.Certificate{}, fmt.Errorf("the TLS client certificate and key have to be set together")
+	}
+	certificate, err := tls.LoadX509KeyPair(s.Cert, s.Key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("TLS client certificate: %w", err)
+	}
+	return certificate, nil
+}
+
+// verifyCA verifies the chain of the server certificate without checking
+// the name it was issued for.
+func verifyCA(roots *x509.CertPool) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("no TLS certificate from the server")
+		}
+		certificates := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			certificate, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certificates[i] = certificate
+		}
+		intermediates := x509.NewCertPool()
+		for _, certificate := range certificates[1:] {
+			intermediates.AddCert(certificate)
+		}
+		_, err := certificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
+
+// mysqlTLSConfig builds the config registered in the mysql driver, host
+// being the server name by default.
+func (s TLSSettings) mysqlTLSConfig(host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: s.ServerName}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if s.CA != "" {
+		roots, err := s.rootCAs()
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = roots
+	}
+	if s.Cert != "" {
+		certificate, err := s.certificate()
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	switch s.VerifyMode {
+	case TLSRequire:
+		config.InsecureSkipVerify = true
+	case TLSVerifyCA:
+		// NOTE: the chain is verified by VerifyPeerCertificate instead
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyCA(config.RootCAs)
+	}
+	return config, nil
+}
+
+// applyTLS validates the TLS settings and sets them in the connection
+// string, registering the TLS config of MySQL connections under name. It has
+// to be called before the connection string goes through the tunnel.
+func applyTLS(dbType ConnectionType, connectionString string, s TLSSettings, name string, tunneled bool) (string, error) {
+	err := s.validate(dbType, tunneled)
+	if err != nil {
+		return "", err
+	}
+	if s.VerifyMode == TLSDisabled {
+		return connectionString, nil
+	}
+
+	settings, err := parseConnectionString(dbType, connectionString)
+	if err != nil {
+		return "", err
+	}
+	switch dbType {
+	case PostgreSQL:
+		settings.SSLMode = string(s.VerifyMode)
+		settings.Params = slices.DeleteFunc(settings.Params, func(param ConnectionParam) bool {
+			return param.Name == "sslrootcert" || param.Name == "sslcert" || param.Name == "sslkey"
+		})
+		if s.CA != "" {
+			settings.Params = append(settings.Params, ConnectionParam{Name: "sslrootcert", Value: s.CA})
+		}
+		if s.Cert != "" {
+			settings.Params = append(settings.Params, ConnectionParam{Name: "sslcert", Value: s.Cert}, ConnectionParam{Name: "sslkey", Value: s.Key})
+		}
+	case MySQL:
+		config, err := s.mysqlTLSConfig(settings.Host)
+		if err != nil {
+			return "", err
+		}
+		err = mysql.RegisterTLSConfig(name, config)
+		if err != nil {
+			return "", err
+		}
+		settings.SSLMode = name
+	}
+	return buildConnectionString(dbType, settings)
+}
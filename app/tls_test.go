@@ -0,0 +1,174 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	raw         []byte
+}
+
+// issueCertificate signs a certificate for name with the parent, or self
+// signs a CA when there is none.
+func issueCertificate(t *testing.T, name string, parent *testCertificate) testCertificate {
+	t.Helper()
+	r := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	r.NoError(err)
+	certificate, err := x509.ParseCertificate(raw)
+	r.NoError(err)
+	return testCertificate{certificate: certificate, key: key, raw: raw}
+}
+
+// writeCertificate writes the certificate and its key as PEM files and
+// returns their paths.
+func writeCertificate(t *testing.T, c testCertificate, name string) (string, string) {
+	t.Helper()
+	r := require.New(t)
+	dir := t.TempDir()
+
+	certFile := filepath.Join(dir, name+".crt")
+	err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.raw}), 0600)
+	r.NoError(err)
+
+	key, err := x509.MarshalECPrivateKey(c.key)
+	r.NoError(err)
+	keyFile := filepath.Join(dir, name+".key")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600)
+	r.NoError(err)
+
+	return certFile, keyFile
+}
+
+func TestTLSValidation(t *testing.T) {
+	ca := issueCertificate(t, "ca", nil)
+	caFile, _ := writeCertificate(t, ca, "ca")
+	certFile, keyFile := writeCertificate(t, issueCertificate(t, "client", &ca), "client")
+	notPEM := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	testCases := []struct {
+		name     string
+		dbType   ConnectionType
+		settings TLSSettings
+		tunneled bool
+		expected string
+	}{
+		{"Disabled", PostgreSQL, TLSSettings{}, false, ""},
+		{"Full", MySQL, TLSSettings{CA: caFile, Cert: certFile, Key: keyFile, VerifyMode: TLSVerifyFull, ServerName: "db"}, false, ""},
+		{"Files Without Mode", PostgreSQL, TLSSettings{CA: caFile}, false, "choose a TLS verify mode to use the TLS settings"},
+		{"Unknown Mode", PostgreSQL, TLSSettings{VerifyMode: "verify"}, false, "unknown TLS verify mode: verify"},
+		{"SQLite", SQLite, TLSSettings{VerifyMode: TLSRequire}, false, "no TLS for sqlite databases"},
+		{"PostgreSQL Server Name", PostgreSQL, TLSSettings{VerifyMode: TLSVerifyFull, ServerName: "db"}, false, "the TLS server name can't be set for PostgreSQL connections, use verify-ca instead"},
+		{"PostgreSQL Verify Full Through Tunnel", PostgreSQL, TLSSettings{VerifyMode: TLSVerifyFull}, true, "verify-full can't be used for PostgreSQL connections through an SSH tunnel, use verify-ca instead"},
+		{"PostgreSQL Verify CA Through Tunnel", PostgreSQL, TLSSettings{CA: caFile, VerifyMode: TLSVerifyCA}, true, ""},
+		{"MySQL Verify Full Through Tunnel", MySQL, TLSSettings{CA: caFile, VerifyMode: TLSVerifyFull}, true, ""},
+		{"Missing CA", MySQL, TLSSettings{CA: filepath.Join(t.TempDir(), "missing.crt"), VerifyMode: TLSVerifyCA}, false, "TLS CA: open"},
+		{"Invalid CA", MySQL, TLSSettings{CA: notPEM, VerifyMode: TLSVerifyCA}, false, "no PEM certificate in the TLS CA file"},
+		{"Cert Without Key", PostgreSQL, TLSSettings{Cert: certFile, VerifyMode: TLSRequire}, false, "the TLS client certificate and key have to be set together"},
+		{"Mismatched Key", MySQL, TLSSettings{Cert: caFile, Key: keyFile, VerifyMode: TLSRequire}, false, "TLS client certificate: "},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.settings.validate(tc.dbType, tc.tunneled)
+			if tc.expected == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestApplyTLS(t *testing.T) {
+	r := require.New(t)
+	ca := issueCertificate(t, "ca", nil)
+	caFile, _ := writeCertificate(t, ca, "ca")
+	certFile, keyFile := writeCertificate(t, issueCertificate(t, "client", &ca), "client")
+	settings := TLSSettings{CA: caFile, Cert: certFile, Key: keyFile, VerifyMode: TLSVerifyCA}
+
+	connectionString, err := applyTLS(PostgreSQL, "postgres://postgres:postgres@db:5432/dbisous_test?sslmode=disable&sslrootcert=old.crt", settings, "", false)
+	r.NoError(err)
+	parsed, err := parseConnectionString(PostgreSQL, connectionString)
+	r.NoError(err)
+	r.Equal("verify-ca", parsed.SSLMode)
+	r.Equal([]ConnectionParam{{"sslrootcert", caFile}, {"sslcert", certFile}, {"sslkey", keyFile}}, parsed.Params)
+
+	name := tlsConfigName("test")
+	defer mysql.DeregisterTLSConfig(name)
+	connectionString, err = applyTLS(MySQL, "root:mysql@tcp(db:3306)/dbisous_test", settings, name, false)
+	r.NoError(err)
+	r.Equal("root:mysql@tcp(db:3306)/dbisous_test?tls="+name, connectionString)
+
+	config, err := mysql.ParseDSN(connectionString)
+	r.NoError(err)
+	r.Equal("db", config.TLS.ServerName, "The server name should default to the host")
+	r.Len(config.TLS.Certificates, 1)
+	r.NotNil(config.TLS.RootCAs)
+	r.NotNil(config.TLS.VerifyPeerCertificate)
+
+	connectionString, err = applyTLS(MySQL, "root:mysql@tcp(db:3306)/dbisous_test?tls=true", TLSSettings{}, name, false)
+	r.NoError(err)
+	r.Equal("root:mysql@tcp(db:3306)/dbisous_test?tls=true", connectionString, "The connection string should be kept without TLS settings")
+
+	err = testConnection(Connection{Type: MySQL, ConnectionString: "root:mysql@tcp(db:3306)/dbisous_test", TLS: TLSSettings{Cert: certFile, VerifyMode: TLSRequire}})
+	r.EqualError(err, "the TLS client certificate and key have to be set together")
+
+	// NOTE: rejected before the tunnel is opened
+	err = testConnection(Connection{Type: PostgreSQL, ConnectionString: "postgres://postgres:postgres@db:5432/dbisous_test", TLS: TLSSettings{VerifyMode: TLSVerifyFull}, SSH: SSHTunnel{Host: "bastion"}})
+	r.EqualError(err, "verify-full can't be used for PostgreSQL connections through an SSH tunnel, use verify-ca instead")
+}
+
+func TestVerifyCA(t *testing.T) {
+	r := require.New(t)
+	ca := issueCertificate(t, "ca", nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+
+	// NOTE: the name doesn't matter with verify-ca
+	server := issueCertificate(t, "elsewhere", &ca)
+	err := verifyCA(roots)([][]byte{server.raw}, nil)
+	r.NoError(err)
+
+	other := issueCertificate(t, "other", nil)
+	err = verifyCA(roots)([][]byte{issueCertificate(t, "db", &other).raw}, nil)
+	r.Error(err)
+
+	err = verifyCA(roots)(nil, nil)
+	r.Error(err)
+}
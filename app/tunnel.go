@@ -0,0 +1,268 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHTunnel is the bastion the database is reached through, no tunnel being
+// opened when Host is empty.
+type SSHTunnel struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"` // 0 means 22
+	User       string `json:"user"`
+	KeyFile    string `json:"key_file"`    // private key, the SSH agent is used when empty
+	KnownHosts string `json:"known_hosts"` // ~/.ssh/known_hosts when empty
+}
+
+// tunnel forwards the connections to a local port to the database, through
+// the SSH connection to the bastion.
+type tunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	remote   string
+}
+
+// tunnels holds the tunnels of the active connections, by connection ID.
+var tunnelsMu sync.Mutex
+var tunnels = make(map[string]*tunnel)
+
+// expandHome resolves the paths starting with ~/ as in the SSH config.
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[2:]), nil
+}
+
+// auth returns the SSH auth method and the connection to the SSH agent when
+// it is used, to close once the handshake is done.
+func (s SSHTunnel) auth() (ssh.AuthMethod, io.Closer, error) {
+	if s.KeyFile == "" {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, fmt.Errorf("no SSH key file and no SSH agent running")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, err
+		}
+		// NOTE: the agent signs during the handshake, the connection has to stay open
+		return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), conn, nil
+	}
+
+	path, err := expandHome(s.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, nil, fmt.Errorf("the SSH key %s is encrypted, add it to the SSH agent instead", s.KeyFile)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return ssh.PublicKeys(signer), nil, nil
+}
+
+func (s SSHTunnel) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	path := s.KnownHosts
+	if path == "" {
+		path = "~/.ssh/known_hosts"
+	}
+	path, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return fmt.Errorf("the host key of %s is not in %s", hostname, path)
+		}
+		if errors.As(err, &keyErr) {
+			return fmt.Errorf("the host key of %s doesn't match the one in %s", hostname, path)
+		}
+		return err
+	}, nil
+}
+
+// openTunnel connects to the bastion and listens on a local port forwarded
+// to remote.
+func openTunnel(s SSHTunnel, remote string) (*tunnel, error) {
+	auth, agentConn, err := s.auth()
+	if err != nil {
+		return nil, err
+	}
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+	hostKeyCallback, err := s.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	port := s.Port
+	if port == 0 {
+		port = 22
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(s.Host, strconv.Itoa(port)), &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	t := &tunnel{client: client, listener: listener, remote: remote}
+	go t.serve()
+	return t, nil
+}
+
+func (t *tunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			// NOTE: the listener is closed with the tunnel
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+func (t *tunnel) forward(local net.Conn) {
+	defer local.Close()
+	remote, err := t.client.Dial("tcp", t.remote)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (t *tunnel) addr() string {
+	return t.listener.Addr().String()
+}
+
+func (t *tunnel) Close() error {
+	t.listener.Close()
+	return t.client.Close()
+}
+
+// tunnelConnection opens the tunnel to the database of the connection string
+// and returns the connection string going through it.
+func tunnelConnection(dbType ConnectionType, connectionString string, s SSHTunnel) (*tunnel, string, error) {
+	settings, err := parseConnectionString(dbType, connectionString)
+	if err != nil {
+		return nil, "", err
+	}
+	remote, err := tunnelRemote(dbType, settings)
+	if err != nil {
+		return nil, "", err
+	}
+
+	t, err := openTunnel(s, remote)
+	if err != nil {
+		return nil, "", fmt.Errorf("SSH tunnel to %s: %w", s.Host, err)
+	}
+	connectionString, err = throughTunnel(dbType, settings, t)
+	if err != nil {
+		t.Close()
+		return nil, "", err
+	}
+	return t, connectionString, nil
+}
+
+// tunnelRemote is the address of the database as seen from the bastion.
+func tunnelRemote(dbType ConnectionType, settings ConnectionSettings) (string, error) {
+	var port int
+	switch dbType {
+	case PostgreSQL:
+		port = 5432
+	case MySQL:
+		port = 3306
+	default:
+		return "", fmt.Errorf("no SSH tunnel for %s databases", dbType)
+	}
+	if strings.HasPrefix(settings.Host, "/") {
+		return "", fmt.Errorf("no SSH tunnel to the unix socket %s", settings.Host)
+	}
+
+	host := settings.Host
+	if host == "" {
+		host = "localhost"
+	}
+	if settings.Port != 0 {
+		port = settings.Port
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func throughTunnel(dbType ConnectionType, settings ConnectionSettings, t *tunnel) (string, error) {
+	host, port, err := net.SplitHostPort(t.addr())
+	if err != nil {
+		return "", err
+	}
+	settings.Host = host
+	settings.Port, err = parsePort(port)
+	if err != nil {
+		return "", err
+	}
+	return buildConnectionString(dbType, settings)
+}
+
+// closeTunnel closes the tunnel of the connection, if it has one.
+func closeTunnel(id string) {
+	tunnelsMu.Lock()
+	t, exists := tunnels[id]
+	delete(tunnels, id)
+	tunnelsMu.Unlock()
+
+	if exists {
+		t.Close()
+	}
+}
@@ -0,0 +1,275 @@
+package app
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startSSHServer runs a bastion accepting the user key and forwarding the
+// direct-tcpip channels, and returns its address.
+func startSSHServer(t *testing.T, hostKey ssh.Signer, userKey ssh.PublicKey) string {
+	t.Helper()
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "bastion" && bytes.Equal(key.Marshal(), userKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for newChannel := range channels {
+					if newChannel.ChannelType() != "direct-tcpip" {
+						newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+						continue
+					}
+					var target struct {
+						Host     string
+						Port     uint32
+						OrigHost string
+						OrigPort uint32
+					}
+					err := ssh.Unmarshal(newChannel.ExtraData(), &target)
+					if err != nil {
+						newChannel.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+					if err != nil {
+						newChannel.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					channel, channelRequests, err := newChannel.Accept()
+					if err != nil {
+						remote.Close()
+						continue
+					}
+					go ssh.DiscardRequests(channelRequests)
+					go func() {
+						defer channel.Close()
+						defer remote.Close()
+						go io.Copy(remote, channel)
+						io.Copy(channel, remote)
+					}()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// startEchoServer stands for the database behind the bastion.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func generateKey(t *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return key, signer
+}
+
+// setupTunnel starts a bastion and writes the user key and known_hosts files
+// to reach it.
+func setupTunnel(t *testing.T) SSHTunnel {
+	t.Helper()
+	r := require.New(t)
+	dir := t.TempDir()
+
+	_, hostKey := generateKey(t)
+	userKey, userSigner := generateKey(t)
+	addr := startSSHServer(t, hostKey, userSigner.PublicKey())
+
+	block, err := ssh.MarshalPrivateKey(userKey, "")
+	r.NoError(err)
+	keyFile := filepath.Join(dir, "id_ed25519")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600)
+	r.NoError(err)
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	err = os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{addr}, hostKey.PublicKey())+"\n"), 0600)
+	r.NoError(err)
+
+	host, port, err := net.SplitHostPort(addr)
+	r.NoError(err)
+	p, err := strconv.Atoi(port)
+	r.NoError(err)
+	return SSHTunnel{Host: host, Port: p, User: "bastion", KeyFile: keyFile, KnownHosts: knownHosts}
+}
+
+func TestTunnel(t *testing.T) {
+	r := require.New(t)
+	config := setupTunnel(t)
+	remote := startEchoServer(t)
+
+	tun, err := openTunnel(config, remote)
+	r.NoError(err)
+
+	for range 2 {
+		conn, err := net.Dial("tcp", tun.addr())
+		r.NoError(err)
+		_, err = conn.Write([]byte("ping"))
+		r.NoError(err)
+		buffer := make([]byte, 4)
+		_, err = io.ReadFull(conn, buffer)
+		r.NoError(err)
+		r.Equal("ping", string(buffer))
+		conn.Close()
+	}
+
+	err = tun.Close()
+	r.NoError(err)
+	_, err = net.Dial("tcp", tun.addr())
+	r.Error(err, "The local port should be closed with the tunnel")
+}
+
+func TestTunnelAgent(t *testing.T) {
+	r := require.New(t)
+	config := setupTunnel(t)
+	remote := startEchoServer(t)
+
+	key, err := os.ReadFile(config.KeyFile)
+	r.NoError(err)
+	privateKey, err := ssh.ParseRawPrivateKey(key)
+	r.NoError(err)
+	keyring := agent.NewKeyring()
+	err = keyring.Add(agent.AddedKey{PrivateKey: privateKey})
+	r.NoError(err)
+
+	// NOTE: unix socket paths are limited in length, t.TempDir may be too long
+	dir, err := os.MkdirTemp("", "agent")
+	r.NoError(err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	r.NoError(err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+
+	config.KeyFile = ""
+	tun, err := openTunnel(config, remote)
+	r.NoError(err)
+	defer tun.Close()
+
+	conn, err := net.Dial("tcp", tun.addr())
+	r.NoError(err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	r.NoError(err)
+	buffer := make([]byte, 4)
+	_, err = io.ReadFull(conn, buffer)
+	r.NoError(err)
+	r.Equal("ping", string(buffer))
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	_, err = openTunnel(config, remote)
+	r.EqualError(err, "no SSH key file and no SSH agent running")
+}
+
+func TestTunnelHostKey(t *testing.T) {
+	r := require.New(t)
+	config := setupTunnel(t)
+	remote := startEchoServer(t)
+
+	_, otherKey := generateKey(t)
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	err := os.WriteFile(config.KnownHosts, []byte(knownhosts.Line([]string{addr}, otherKey.PublicKey())+"\n"), 0600)
+	r.NoError(err)
+	_, err = openTunnel(config, remote)
+	r.ErrorContains(err, "doesn't match")
+
+	err = os.WriteFile(config.KnownHosts, []byte{}, 0600)
+	r.NoError(err)
+	_, err = openTunnel(config, remote)
+	r.ErrorContains(err, "is not in")
+}
+
+func TestTunnelConnection(t *testing.T) {
+	r := require.New(t)
+	config := setupTunnel(t)
+	remote := startEchoServer(t)
+	host, port, err := net.SplitHostPort(remote)
+	r.NoError(err)
+
+	tun, connectionString, err := tunnelConnection(PostgreSQL, "postgres://postgres:postgres@"+net.JoinHostPort(host, port)+"/dbisous_test?sslmode=disable", config)
+	r.NoError(err)
+	defer tun.Close()
+	r.Equal(remote, tun.remote)
+	r.Equal("postgres://postgres:postgres@"+tun.addr()+"/dbisous_test?sslmode=disable", connectionString)
+
+	_, _, err = tunnelConnection(SQLite, "data.db", config)
+	r.Error(err)
+
+	// NOTE: no database behind the bastion, the ping fails past the tunnel
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	r.NoError(err)
+	listener.Close()
+	err = testConnection(Connection{Type: MySQL, ConnectionString: "root:mysql@tcp(" + listener.Addr().String() + ")/dbisous_test", SSH: config})
+	r.Error(err)
+	r.NotContains(err.Error(), "SSH tunnel")
+}
@@ -9,12 +9,13 @@ import {
   DeleteConnection,
   Disconnect,
   GetConnections,
+  GetSecretsStatus,
+  UnlockSecrets,
   UpdateConnection,
 } from "_/go/app/App";
 import { Route } from "@/router";
 import { useApp } from "./useApp";
 import { useCompletions } from "./useCompletions";
-import { parseConnectionString } from "@/utils/connection";
 
 type DatabaseMetadata = Record<string, Record<string, Array<string>>>;
 
@@ -26,8 +27,18 @@ export const useConnections = createSharedComposable(() => {
   const connections = ref<Array<app.Connection>>([]);
   const activeConnections = ref<Array<string>>([]);
   const metadata = ref<Record<string, { columns: DatabaseMetadata }>>({});
+  const secrets = ref<app.SecretsStatus>();
 
   async function fetchConnections() {
+    const status = await wails(GetSecretsStatus);
+    if (status instanceof Error) {
+      return;
+    }
+    secrets.value = status;
+    if (status.locked) {
+      // NOTE: fetched again once unlocked
+      return;
+    }
     const result = await wails(GetConnections);
     if (result instanceof Error) {
       return;
@@ -35,6 +46,15 @@ export const useConnections = createSharedComposable(() => {
     connections.value = result;
   }
 
+  async function unlock(password: string) {
+    const result = await wails(() => UnlockSecrets(password));
+    if (result instanceof Error) {
+      return false;
+    }
+    await fetchConnections();
+    return true;
+  }
+
   async function addConnection(connection: app.Connection) {
     const result = await wails(() => CreateConnection(connection));
     if (result instanceof Error) {
@@ -74,9 +94,7 @@ export const useConnections = createSharedComposable(() => {
       activeConnections.value.some((c) => c === id) &&
       connection.value !== id
     ) {
-      const { database: db } = parseConnectionString(
-        currentConnection.connection_string,
-      );
+      const db = currentConnection.settings.database;
       register(metadata.value[id].columns);
       connection.value = id;
       table.value = "";
@@ -148,5 +166,7 @@ export const useConnections = createSharedComposable(() => {
     getConnectionName,
     isConnected,
     metadata,
+    secrets,
+    unlock,
   };
 });
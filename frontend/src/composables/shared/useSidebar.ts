@@ -5,7 +5,7 @@ import { ref } from "vue";
 export const useSidebar = createSharedComposable(() => {
   const slideoverOpen = ref(false);
   const editedConnection = ref<
-    Omit<app.Connection, "id" | "created_at" | "updated_at"> & {
+    Omit<app.Connection, "id" | "created_at" | "updated_at" | "settings"> & {
       id?: string;
       created_at?: string;
       updated_at?: string;
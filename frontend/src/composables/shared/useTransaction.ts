@@ -1,10 +1,10 @@
 import {
   ChangeType,
   DeleteChange,
-  formatDeleteChangeToSql,
-  formatInsertChangeToSql,
-  formatUpdateChangeToSql,
   InsertChange,
+  toDeleteChange,
+  toInsertChange,
+  toUpdateChange,
   UpdateChange,
 } from "@/utils/transaction";
 import { createSharedComposable } from "@vueuse/core";
@@ -16,46 +16,28 @@ export const useTransaction = createSharedComposable(() => {
   const updateChanges = ref<Array<UpdateChange>>([]);
   const deleteChanges = ref<Array<DeleteChange>>([]);
 
-  function commit() {
-    const insertsStr = insertChanges.value
-      .filter(
-        (c) =>
-          !deleteChanges.value.find(
-            (d) => d.table === c.table && d.rowKey === c.id,
-          ),
-      )
-      .map(formatInsertChangeToSql)
-      .join("\n");
-    const updatesStr = updateChanges.value
-      .filter(
-        (c) =>
-          !deleteChanges.value.find(
-            (d) => d.table === c.table && d.rowKey === c.rowKey,
-          ),
-      )
-      .map(formatUpdateChangeToSql)
-      .join("\n");
-    const deletesStr = deleteChanges.value
-      .map(formatDeleteChangeToSql)
-      .join("\n");
-
-    const fullInsertStr =
-      insertChanges.value.length > 0
-        ? `-- ${insertChanges.value.length.toString()} insert${insertChanges.value.length > 1 ? "s" : ""}\n${insertsStr}\n`
-        : "";
-    const fullUpdateStr =
-      updateChanges.value.length > 0
-        ? `-- ${updateChanges.value.length.toString()} update${updateChanges.value.length > 1 ? "s" : ""}\n${updatesStr}\n`
-        : "";
-    const fullDeleteStr =
-      deleteChanges.value.length > 0
-        ? `-- ${deleteChanges.value.length.toString()} delete${deleteChanges.value.length > 1 ? "s" : ""}\n${deletesStr}\n`
-        : "";
-
-    const sql =
-      "BEGIN;\n" + fullInsertStr + fullUpdateStr + fullDeleteStr + "COMMIT;\n";
-
-    return sql;
+  // changes lists the pending changes in the order they are applied, rows
+  // that are deleted anyway being neither inserted nor updated.
+  function changes(schema: string) {
+    return [
+      ...insertChanges.value
+        .filter(
+          (c) =>
+            !deleteChanges.value.find(
+              (d) => d.table === c.table && d.rowKey === c.id,
+            ),
+        )
+        .map((c) => toInsertChange(schema, c)),
+      ...updateChanges.value
+        .filter(
+          (c) =>
+            !deleteChanges.value.find(
+              (d) => d.table === c.table && d.rowKey === c.rowKey,
+            ),
+        )
+        .map((c) => toUpdateChange(schema, c)),
+      ...deleteChanges.value.map((c) => toDeleteChange(schema, c)),
+    ];
   }
 
   function abort() {
@@ -175,7 +157,7 @@ export const useTransaction = createSharedComposable(() => {
     insertChanges,
     updateChanges,
     deleteChanges,
-    commit,
+    changes,
     abort,
     addUpdate,
     removeUpdate,
@@ -0,0 +1,34 @@
+import { client } from "_/go/models";
+
+export function toQueryFilter(filter: {
+  id: string;
+  value: unknown;
+}): client.QueryFilter {
+  const { id: column, value } = filter;
+
+  if (value === null) {
+    return new client.QueryFilter({
+      column,
+      operator: client.FilterOperator.Is_null,
+    });
+  }
+  if (Array.isArray(value)) {
+    return new client.QueryFilter({
+      column,
+      operator: client.FilterOperator.In,
+      values: value,
+    });
+  }
+  if (typeof value === "string") {
+    return new client.QueryFilter({
+      column,
+      operator: client.FilterOperator.Like,
+      value,
+    });
+  }
+  return new client.QueryFilter({
+    column,
+    operator: client.FilterOperator.Equal,
+    value: value instanceof Date ? value.toISOString() : value,
+  });
+}
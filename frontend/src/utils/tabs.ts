@@ -4,4 +4,6 @@ export enum Tab {
   Query = "query",
   Export = "export",
   Import = "import",
+  Compare = "compare",
+  Copy = "copy",
 }
@@ -1,3 +1,5 @@
+import { client } from "_/go/models";
+
 export enum ChangeType {
   Insert = "INSERT",
   Update = "UPDATE",
@@ -31,49 +33,43 @@ export interface DeleteChange extends Change {
   rowKey: unknown;
 }
 
-export function toSqlValue(value: unknown): string {
-  if (value === null) {
-    return "NULL";
-  }
-
-  switch (typeof value) {
-    case "boolean":
-      return value ? "TRUE" : "FALSE";
-    case "number":
-      return value.toString();
-    case "string":
-      return `'${value.replace(/'/g, "''")}'`; // Escape single quotes
-    case "object":
-      if (Array.isArray(value)) {
-        return `(${value.map(toSqlValue).join(", ")})`;
-      } else if (value instanceof Date) {
-        return `'${value.toISOString()}'`;
-      } else {
-        throw new Error(`Unsupported object type: ${typeof value}`);
-      }
-    default:
-      throw new Error(`Unsupported data type: ${typeof value}`);
-  }
-}
-
-export function formatInsertChangeToSql(change: InsertChange) {
-  // NOTE: filter out __key and NULL values
+export function toInsertChange(
+  schema: string,
+  change: InsertChange,
+): client.Change {
+  // NOTE: filter out __key and NULL values, which get the column default
   const values = Object.fromEntries(
     Object.entries(change.values).filter(
-      ([key, value]) => key !== "__key" && value !== "NULL",
+      ([key, value]) => key !== "__key" && value !== null,
     ),
   );
-  return `INSERT INTO ${change.table} (${Object.keys(values)
-    .map((column) => `"${column}"`)
-    .join(", ")}) VALUES (${Object.entries(values)
-    .map(([, value]) => toSqlValue(value))
-    .join(", ")});`;
+  return client.Change.createFrom({
+    kind: client.ChangeKind.Insert,
+    schema,
+    table: change.table,
+    values,
+  });
 }
-export function formatUpdateChangeToSql(change: UpdateChange) {
-  return `UPDATE ${change.table} SET ${Object.entries(change.values)
-    .map(([key, value]) => `"${key}" = ${toSqlValue(value)}`)
-    .join(", ")} WHERE ${change.primaryKey} = ${toSqlValue(change.rowKey)};`;
+export function toUpdateChange(
+  schema: string,
+  change: UpdateChange,
+): client.Change {
+  return client.Change.createFrom({
+    kind: client.ChangeKind.Update,
+    schema,
+    table: change.table,
+    key: { [change.primaryKey]: change.rowKey },
+    values: change.values,
+  });
 }
-export function formatDeleteChangeToSql(change: DeleteChange) {
-  return `DELETE FROM ${change.table} WHERE ${change.primaryKey} = ${toSqlValue(change.rowKey)};`;
+export function toDeleteChange(
+  schema: string,
+  change: DeleteChange,
+): client.Change {
+  return client.Change.createFrom({
+    kind: client.ChangeKind.Delete,
+    schema,
+    table: change.table,
+    key: { [change.primaryKey]: change.rowKey },
+  });
 }
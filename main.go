@@ -44,9 +44,17 @@ func main() {
 		},
 		EnumBind: []any{
 			app.AllConnectionTypes,
+			app.AllTLSVerifyModes,
 			client.OrderDirections,
+			client.FilterOperators,
+			client.FilterLogics,
 			client.ExportTypes,
 			client.ExportDrops,
+			client.CSVQuotes,
+			client.CSVEncodings,
+			client.CSVTypes,
+			client.DiffKinds,
+			client.ChangeKinds,
 		},
 		StartHidden: startHidden,
 	})